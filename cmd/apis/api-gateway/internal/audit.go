@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/nhdms/base-go/internal/permissions"
+	"github.com/nhdms/base-go/pkg/common"
+	"github.com/nhdms/base-go/pkg/logger"
+	transhttp "github.com/nhdms/base-go/pkg/transport"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+	"github.com/spf13/cast"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var auditLogsRequirement = permissions.Require(permissions.AuditLogs, permissions.AuditLogsFetchMany)
+
+// ServeAuditEvents returns the audit events newest first, filtered by the user_id, principal_type, principal_id,
+// action and service parameters between from and to (RFC 3339, default the last 24 hours). Pages of limit events
+// are requested with the next_cursor of the previous page as cursor.
+func (p *ReverseProxy) ServeAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		transhttp.RespondJSONFull(w, http.StatusMethodNotAllowed, common.NewErrorHTTPResponse("method not allowed"))
+		return
+	}
+
+	principal, err := p.authenticate(r, []string{transhttp.TokenTypeJWT, transhttp.TokenTypeAPIKey})
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+	if missing := principal.MissingPermissions(auditLogsRequirement); len(missing) > 0 {
+		respondAuthError(w, &common.MissingPermissionError{Missing: missing})
+		return
+	}
+
+	params := r.URL.Query()
+	query := &models.AuditQuery{
+		UserId:        cast.ToInt64(params.Get("user_id")),
+		PrincipalType: params.Get("principal_type"),
+		PrincipalId:   params.Get("principal_id"),
+		Action:        params.Get("action"),
+		Service:       params.Get("service"),
+		Limit:         cast.ToInt64(params.Get("limit")),
+		Cursor:        params.Get("cursor"),
+	}
+	for param, field := range map[string]**timestamppb.Timestamp{"from": &query.From, "to": &query.To} {
+		if value := params.Get(param); len(value) > 0 {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				transhttp.RespondJSONFull(w, http.StatusBadRequest, common.NewErrorHTTPResponse("invalid "+param+", expected RFC 3339"))
+				return
+			}
+			*field = timestamppb.New(t)
+		}
+	}
+
+	result, err := p.auditClient.QueryEvents(r.Context(), query)
+	if common.IsInvalidFieldError(err) {
+		transhttp.RespondJSONFull(w, http.StatusBadRequest, common.NewErrorHTTPResponse("invalid cursor"))
+		return
+	}
+	if err != nil {
+		logger.DefaultLogger.Errorw("Failed to query audit events", "error", err)
+		transhttp.RespondJSONFull(w, http.StatusInternalServerError, common.NewErrorHTTPResponse("server error"))
+		return
+	}
+	transhttp.RespondJSONFull(w, http.StatusOK, common.NewSuccessHTTPResponse(result))
+}
@@ -1,6 +1,16 @@
 package internal
 
-import "net/http"
+import (
+	"errors"
+	"github.com/goccy/go-json"
+	"github.com/nhdms/base-go/internal/permissions"
+	"github.com/nhdms/base-go/internal/token"
+	"github.com/nhdms/base-go/pkg/common"
+	"github.com/nhdms/base-go/pkg/logger"
+	transhttp "github.com/nhdms/base-go/pkg/transport"
+	"github.com/nhdms/base-go/pkg/utils/token_helper"
+	"net/http"
+)
 
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -16,3 +26,161 @@ func AuthMiddleware(next http.Handler) http.Handler {
 func isValidToken(token string) bool {
 	return token == "valid-token_helper"
 }
+
+// ServeLogout revokes the token of the request, with all=true every token of the user is revoked
+func (p *ReverseProxy) ServeLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		transhttp.RespondJSONFull(w, http.StatusMethodNotAllowed, common.NewErrorHTTPResponse("method not allowed"))
+		return
+	}
+
+	tokenString := token_helper.ExtractTokenFromRequest(r)
+	if len(tokenString) == 0 {
+		transhttp.RespondJSONFull(w, http.StatusUnauthorized, common.NewErrorCodeHTTPResponse(common.AuthCodeNoToken))
+		return
+	}
+
+	jwtToken, err := p.tokenProcessor.GetToken(r.Context(), tokenString)
+	if err != nil {
+		transhttp.RespondJSONFull(w, http.StatusUnauthorized, common.NewErrorCodeHTTPResponse(common.AuthCodeInvalidToken))
+		return
+	}
+
+	userID := token.GetJWTClaimFromToken(jwtToken).UserId
+	if r.URL.Query().Get("all") == "true" {
+		err = p.tokenProcessor.RevokeUserTokens(r.Context(), userID)
+	} else if sessionID := token.GetSessionID(jwtToken); len(sessionID) > 0 {
+		// refresh tokens of the device are revoked too
+		err = p.tokenProcessor.RevokeSession(r.Context(), userID, sessionID)
+	} else {
+		err = p.tokenProcessor.RevokeToken(r.Context(), jwtToken)
+	}
+	if err != nil {
+		logger.DefaultLogger.Errorw("Failed to revoke token", "error", err)
+		transhttp.RespondJSONFull(w, http.StatusInternalServerError, common.NewErrorHTTPResponse("server error"))
+		return
+	}
+
+	transhttp.RespondJSONFull(w, http.StatusOK, common.NewSuccessHTTPResponse(nil))
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// ServeRefresh rotates the refresh token of the body and returns the new token pair
+func (p *ReverseProxy) ServeRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		transhttp.RespondJSONFull(w, http.StatusMethodNotAllowed, common.NewErrorHTTPResponse("method not allowed"))
+		return
+	}
+
+	req := &refreshRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || len(req.RefreshToken) == 0 {
+		transhttp.RespondJSONFull(w, http.StatusBadRequest, common.NewErrorHTTPResponse("refresh_token is required"))
+		return
+	}
+
+	pair, err := p.tokenProcessor.RefreshTokens(r.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, common.UnauthorizedError) {
+			transhttp.RespondJSONFull(w, http.StatusUnauthorized, common.NewErrorCodeHTTPResponse(common.AuthCodeInvalidToken))
+			return
+		}
+		logger.DefaultLogger.Errorw("Failed to refresh token", "error", err)
+		transhttp.RespondJSONFull(w, http.StatusInternalServerError, common.NewErrorHTTPResponse("server error"))
+		return
+	}
+
+	transhttp.RespondJSONFull(w, http.StatusOK, common.NewSuccessHTTPResponse(pair))
+}
+
+// ServeSessions lists the sessions (devices) of the user of the token, DELETE with id revokes one of them
+func (p *ReverseProxy) ServeSessions(w http.ResponseWriter, r *http.Request) {
+	tokenString := token_helper.ExtractTokenFromRequest(r)
+	if len(tokenString) == 0 {
+		transhttp.RespondJSONFull(w, http.StatusUnauthorized, common.NewErrorCodeHTTPResponse(common.AuthCodeNoToken))
+		return
+	}
+
+	jwtToken, err := p.tokenProcessor.GetToken(r.Context(), tokenString)
+	if err != nil {
+		transhttp.RespondJSONFull(w, http.StatusUnauthorized, common.NewErrorCodeHTTPResponse(common.AuthCodeInvalidToken))
+		return
+	}
+	userID := token.GetJWTClaimFromToken(jwtToken).UserId
+
+	switch r.Method {
+	case http.MethodGet:
+		sessions, err := p.tokenProcessor.ListSessions(r.Context(), userID)
+		if err != nil {
+			logger.DefaultLogger.Errorw("Failed to list sessions", "user_id", userID, "error", err)
+			transhttp.RespondJSONFull(w, http.StatusInternalServerError, common.NewErrorHTTPResponse("server error"))
+			return
+		}
+		transhttp.RespondJSONFull(w, http.StatusOK, common.NewSuccessHTTPResponse(sessions))
+	case http.MethodDelete:
+		sessionID := r.URL.Query().Get("id")
+		if len(sessionID) == 0 {
+			transhttp.RespondJSONFull(w, http.StatusBadRequest, common.NewErrorHTTPResponse("id is required"))
+			return
+		}
+		err = p.tokenProcessor.RevokeSession(r.Context(), userID, sessionID)
+		if errors.Is(err, token.ErrSessionNotFound) {
+			transhttp.RespondJSONFull(w, http.StatusNotFound, common.NewErrorHTTPResponse("session not found"))
+			return
+		}
+		if err != nil {
+			logger.DefaultLogger.Errorw("Failed to revoke session", "user_id", userID, "error", err)
+			transhttp.RespondJSONFull(w, http.StatusInternalServerError, common.NewErrorHTTPResponse("server error"))
+			return
+		}
+		transhttp.RespondJSONFull(w, http.StatusOK, common.NewSuccessHTTPResponse(nil))
+	default:
+		transhttp.RespondJSONFull(w, http.StatusMethodNotAllowed, common.NewErrorHTTPResponse("method not allowed"))
+	}
+}
+
+// ServeJWKS returns the public keys verifying the tokens, verifiers load them from jwt.jwks_url
+func (p *ReverseProxy) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		transhttp.RespondJSONFull(w, http.StatusMethodNotAllowed, common.NewErrorHTTPResponse("method not allowed"))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	transhttp.RespondJSONFull(w, http.StatusOK, p.tokenProcessor.JWKS())
+}
+
+var permissionTreeRequirement = permissions.Any(
+	permissions.Require(permissions.Roles, permissions.RolesFetchMany),
+	permissions.Require(permissions.Roles, permissions.RolesFetchOne),
+)
+
+// ServePermissions returns the permission tree (modules with their permission keys and bits) for the role editor,
+// the user of the token needs to read roles
+func (p *ReverseProxy) ServePermissions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		transhttp.RespondJSONFull(w, http.StatusMethodNotAllowed, common.NewErrorHTTPResponse("method not allowed"))
+		return
+	}
+
+	tokenString := token_helper.ExtractTokenFromRequest(r)
+	if len(tokenString) == 0 {
+		transhttp.RespondJSONFull(w, http.StatusUnauthorized, common.NewErrorCodeHTTPResponse(common.AuthCodeNoToken))
+		return
+	}
+
+	jwtToken, err := p.tokenProcessor.GetToken(r.Context(), tokenString)
+	if err != nil {
+		transhttp.RespondJSONFull(w, http.StatusUnauthorized, common.NewErrorCodeHTTPResponse(common.AuthCodeInvalidToken))
+		return
+	}
+
+	if missing := p.tokenProcessor.MissingPermissions(jwtToken, permissionTreeRequirement); len(missing) > 0 {
+		respondAuthError(w, &common.MissingPermissionError{Missing: missing})
+		return
+	}
+
+	transhttp.RespondJSONFull(w, http.StatusOK, common.NewSuccessHTTPResponse(permissions.Tree()))
+}
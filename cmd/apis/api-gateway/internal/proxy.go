@@ -9,12 +9,18 @@ import (
 	"github.com/goccy/go-json"
 	"github.com/gorilla/mux"
 	"github.com/nhdms/base-go/internal"
+	"github.com/nhdms/base-go/internal/permissions"
 	"github.com/nhdms/base-go/internal/token"
 	"github.com/nhdms/base-go/pkg/app"
+	"github.com/nhdms/base-go/pkg/audit"
 	"github.com/nhdms/base-go/pkg/common"
 	"github.com/nhdms/base-go/pkg/logger"
+	middleware "github.com/nhdms/base-go/pkg/middlewares"
 	transhttp "github.com/nhdms/base-go/pkg/transport"
 	"github.com/nhdms/base-go/pkg/utils/token_helper"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+	"github.com/nhdms/base-go/proto/exmsg/services"
+	"github.com/spf13/cast"
 	"go-micro.dev/v5/registry"
 	"go-micro.dev/v5/selector"
 	"net/http"
@@ -28,6 +34,9 @@ type ReverseProxy struct {
 	reg            registry.Registry
 	balancer       selector.Selector
 	tokenProcessor token.Processor
+	policy         *middleware.PolicyEngine
+	auditEmitter   *audit.Emitter
+	auditClient    services.AuditService
 }
 
 const (
@@ -38,14 +47,55 @@ const (
 
 var pxyTransport = getDefaultTransport()
 
+var errNoToken = fmt.Errorf("%w: no token", common.UnauthorizedError)
+
 func NewReverseProxy(redis *redis.Client, reg registry.Registry, balancer selector.Selector) *ReverseProxy {
 	if balancer == nil {
 		balancer = selector.NewSelector(selector.Registry(reg))
 	}
 	userClient := internal.CreateNewUserServiceClient(nil)
 	tp := token.NewTokenProcessor(redis, userClient)
+	policy, err := middleware.LoadPolicyEngine()
+	if err != nil {
+		logger.DefaultLogger.Fatalf("Failed to load access policy: %v", err)
+	}
+
+	return &ReverseProxy{reg: reg, balancer: balancer, tokenProcessor: tp, policy: policy, auditClient: internal.CreateAuditClient(nil)}
+}
 
-	return &ReverseProxy{reg: reg, balancer: balancer, tokenProcessor: tp}
+// SetAuditEmitter enables the audit events of the routes flagged with Audit
+func (p *ReverseProxy) SetAuditEmitter(emitter *audit.Emitter) {
+	p.auditEmitter = emitter
+}
+
+// ApplyPolicy applies the access policy (see middleware.PolicyEngine) to the handlers of the gateway: denied requests
+// are rejected, every decision is logged with its rule and kept in the request context
+func (p *ReverseProxy) ApplyPolicy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision := p.policy.Evaluate(r)
+		rule := decision.Rule
+		if len(rule) == 0 {
+			rule = "default"
+		}
+		fields := []interface{}{"action", decision.Action, "rule", rule, "client_ip", decision.ClientIP,
+			"method", r.Method, "request_uri", r.RequestURI}
+		switch {
+		case decision.Action == middleware.PolicyActionDeny:
+			// denials are always logged, whether a rule or the default action denied the request
+			logger.DefaultLogger.Warnw("Access policy decision", fields...)
+		case len(decision.Rule) > 0:
+			logger.DefaultLogger.Infow("Access policy decision", fields...)
+		default:
+			// requests allowed by the default action are the bulk of the traffic
+			logger.DefaultLogger.Debugw("Access policy decision", fields...)
+		}
+
+		if decision.Action == middleware.PolicyActionDeny {
+			transhttp.RespondJSONFull(w, http.StatusForbidden, common.NewErrorCodeHTTPResponse(common.AuthCodeAccessDenied))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(middleware.WithPolicyDecision(r.Context(), decision)))
+	})
 }
 
 func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -86,14 +136,16 @@ func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if matchedEndpoint.Audit && p.auditEmitter != nil {
+		recorder := transhttp.NewRecorderResponseWriter(w, http.StatusOK)
+		w = recorder
+		defer p.emitAuditEvent(r, recorder, matchedEndpoint, serviceName, r.URL.Path, timeStart)
+	}
+
 	p.cleanPrivateRequestHeader(r) // to prevent user fake header
 	err = p.extractAndVerifyTokenInfo(r, matchedEndpoint)
 	if err != nil {
-		if errors.Is(err, common.UnauthorizedError) {
-			transhttp.RespondJSONFull(w, http.StatusUnauthorized, common.NewErrorCodeHTTPResponse(common.AuthCodeUnauthorized))
-			return
-		}
-		transhttp.RespondJSONFull(w, http.StatusInternalServerError, common.NewErrorHTTPResponse(err.Error()))
+		respondAuthError(w, err)
 		return
 	}
 
@@ -160,25 +212,38 @@ func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	)
 }
 
+// emitAuditEvent emits the event of a request of an audited route, denied requests included
+func (p *ReverseProxy) emitAuditEvent(r *http.Request, w http.ResponseWriter, endpoint *transhttp.Route, serviceName, path string, start time.Time) {
+	event := &models.AuditEvent{
+		PrincipalType: r.Header.Get(common.HeaderPrincipalType),
+		PrincipalId:   r.Header.Get(common.HeaderPrincipalId),
+		UserId:        cast.ToInt64(r.Header.Get(common.HeaderUserId)),
+		Action:        endpoint.Name,
+		Service:       serviceName,
+		Method:        r.Method,
+		Path:          path,
+		LatencyMs:     time.Since(start).Milliseconds(),
+		ClientIp:      p.getOriginClientIP(r),
+		RequestId:     w.Header().Get(middleware.HeaderXRequestID),
+	}
+	if len(event.Action) == 0 {
+		event.Action = endpoint.Method + " " + endpoint.Pattern
+	}
+	if recorder, ok := w.(interface{ Status() int }); ok {
+		event.Status = int32(recorder.Status())
+	}
+	p.auditEmitter.Emit(event)
+}
+
 func (p *ReverseProxy) getServiceAddress(node *registry.Node, path string) string {
 	return fmt.Sprintf("http://%s", node.Address)
 }
 
 func (p *ReverseProxy) getOriginClientIP(r *http.Request) string {
-	// todo handle IP from Cloudflare here
-	if realIP := r.Header.Get("X-Real-IP"); len(realIP) > 0 {
-		return realIP
-	}
-
-	if realIP := r.Header.Get("X-Forwarded-For"); len(realIP) > 0 {
-		if strings.Contains(realIP, ",") {
-			tmp := strings.Split(realIP, ",")
-			return strings.TrimSpace(tmp[len(tmp)-1])
-		}
-
-		return realIP
+	if decision, ok := middleware.PolicyDecisionFromContext(r.Context()); ok {
+		return decision.ClientIP
 	}
-	return ""
+	return p.policy.ClientIP(r)
 }
 
 func (p *ReverseProxy) getNode(serviceName string) (*registry.Node, error) {
@@ -205,32 +270,87 @@ func (p *ReverseProxy) extractAndVerifyTokenInfo(r *http.Request, endpoint *tran
 		return nil
 	}
 
-	tokenString := token_helper.ExtractTokenFromRequest(r)
-	if len(tokenString) == 0 {
-		return common.UnauthorizedError
-	}
-
-	jwtToken, err := p.tokenProcessor.GetToken(r.Context(), tokenString)
+	principal, err := p.authenticate(r, endpoint.AuthInfo.TokenTypes())
 	if err != nil {
 		return err
 	}
 
-	if jwtToken == nil {
-		return common.UnauthorizedError
+	if granted := principal.CheckPermissions(endpoint.AuthInfo.RequirePermissions); !granted {
+		// one of the bits of each denied module is required
+		denied := make(map[int64]int64)
+		for module, bits := range endpoint.AuthInfo.RequirePermissions {
+			if !principal.CheckPermissions(map[int64]int64{module: bits}) {
+				denied[module] = bits
+			}
+		}
+		return &common.MissingPermissionError{Missing: permissions.Encode(denied)}
 	}
 
-	if granted := p.tokenProcessor.CheckPermissions(jwtToken, endpoint.AuthInfo.RequirePermissions); !granted {
-		return common.UnauthorizedError
+	if endpoint.AuthInfo.Permissions != nil {
+		if missing := principal.MissingPermissions(*endpoint.AuthInfo.Permissions); len(missing) > 0 {
+			return &common.MissingPermissionError{Missing: missing}
+		}
 	}
 
-	metadataToSet := p.tokenProcessor.ExtractMetadata(jwtToken)
-	p.setMetadataToHeader(r, metadataToSet)
+	p.setMetadataToHeader(r, principal.Metadata())
 
 	return nil
 }
 
+// authenticate verifies the credential of the first token type of the route found in the request
+func (p *ReverseProxy) authenticate(r *http.Request, tokenTypes []string) (*token.Principal, error) {
+	for _, tokenType := range tokenTypes {
+		switch tokenType {
+		case transhttp.TokenTypeJWT:
+			if tokenString := token_helper.ExtractTokenFromRequest(r); len(tokenString) > 0 {
+				jwtToken, err := p.tokenProcessor.GetToken(r.Context(), tokenString)
+				if err != nil {
+					return nil, err
+				}
+				if jwtToken == nil {
+					return nil, common.UnauthorizedError
+				}
+				return token.PrincipalFromToken(jwtToken), nil
+			}
+		case transhttp.TokenTypeAPIKey:
+			if key := token_helper.ExtractAPIKeyFromRequest(r); len(key) > 0 {
+				return p.tokenProcessor.GetAPIKeyPrincipal(r.Context(), key)
+			}
+		case transhttp.TokenTypeService:
+			if tokenString := token_helper.ExtractServiceTokenFromRequest(r); len(tokenString) > 0 {
+				return p.tokenProcessor.GetServicePrincipal(r.Context(), tokenString)
+			}
+		default:
+			logger.DefaultLogger.Warnw("Unknown token type of route", "token_type", tokenType, "request_uri", r.RequestURI)
+		}
+	}
+	return nil, errNoToken
+}
+
+// respondAuthError responds the denial reason of extractAndVerifyTokenInfo with its common.AuthCode*
+func respondAuthError(w http.ResponseWriter, err error) {
+	var missingPermission *common.MissingPermissionError
+	switch {
+	case errors.As(err, &missingPermission):
+		transhttp.RespondJSONFull(w, http.StatusForbidden, common.NewErrorWithDataHTTPResponse(common.AuthCodePermissionDenied,
+			common.Code2Message[common.AuthCodePermissionDenied], map[string][]string{"missing_permissions": missingPermission.Missing}))
+	case errors.Is(err, errNoToken):
+		transhttp.RespondJSONFull(w, http.StatusUnauthorized, common.NewErrorCodeHTTPResponse(common.AuthCodeNoToken))
+	case errors.Is(err, token.ErrTokenRevoked), errors.Is(err, token.ErrSessionExpired):
+		transhttp.RespondJSONFull(w, http.StatusUnauthorized, common.NewErrorCodeHTTPResponse(common.AuthCodeExpiredToken))
+	case errors.Is(err, token.ErrInvalidToken), errors.Is(err, token.ErrInvalidAPIKey), errors.Is(err, token.ErrInvalidServiceToken):
+		transhttp.RespondJSONFull(w, http.StatusUnauthorized, common.NewErrorCodeHTTPResponse(common.AuthCodeInvalidToken))
+	case errors.Is(err, common.UnauthorizedError):
+		transhttp.RespondJSONFull(w, http.StatusUnauthorized, common.NewErrorCodeHTTPResponse(common.AuthCodeUnauthorized))
+	default:
+		transhttp.RespondJSONFull(w, http.StatusInternalServerError, common.NewErrorHTTPResponse(err.Error()))
+	}
+}
+
+// isRequestBeWhiteListed is true when the access policy lets the request skip the authentication (bypass_auth rule)
 func (p *ReverseProxy) isRequestBeWhiteListed(r *http.Request) bool {
-	return false
+	decision, ok := middleware.PolicyDecisionFromContext(r.Context())
+	return ok && decision.Action == middleware.PolicyActionBypassAuth
 }
 
 func (p *ReverseProxy) setMetadataToHeader(r *http.Request, set map[string]string) {
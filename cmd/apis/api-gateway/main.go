@@ -4,8 +4,10 @@ package main
 import (
 	"github.com/nhdms/base-go/cmd/apis/api-gateway/internal"
 	"github.com/nhdms/base-go/pkg/app"
+	"github.com/nhdms/base-go/pkg/audit"
 	"github.com/nhdms/base-go/pkg/config"
 	"github.com/nhdms/base-go/pkg/dbtool"
+	"github.com/spf13/viper"
 	"log"
 	"net/http"
 )
@@ -19,15 +21,31 @@ func main() {
 	}
 
 	proxy := internal.NewReverseProxy(redis, service.Options().Registry, nil)
+	if viper.GetBool("audit.enable") {
+		publisher, err := app.NewPublisher()
+		if err != nil {
+			log.Fatal("Failed to create audit publisher: ", err)
+		}
+		emitter := audit.NewEmitter(publisher, audit.SourceGateway)
+		defer emitter.Close()
+		proxy.SetAuditEmitter(emitter)
+	}
+
 	maxIdleConns := config.ViperGetIntWithDefault("http.max_idle_conns", 120)
 	http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost = maxIdleConns
 
 	// Set up routes with authentication middleware
 	httpHandler := http.NewServeMux()
+	httpHandler.HandleFunc("/auth/logout", proxy.ServeLogout)
+	httpHandler.HandleFunc("/auth/refresh", proxy.ServeRefresh)
+	httpHandler.HandleFunc("/auth/sessions", proxy.ServeSessions)
+	httpHandler.HandleFunc("/.well-known/jwks.json", proxy.ServeJWKS)
+	httpHandler.HandleFunc("/admin/permissions", proxy.ServePermissions)
+	httpHandler.HandleFunc("/admin/audit", proxy.ServeAuditEvents)
 	httpHandler.Handle("/", proxy)
 
 	// Register handler
-	service.Handle("/", httpHandler)
+	service.Handle("/", proxy.ApplyPolicy(httpHandler))
 
 	// Run the service
 	if err := service.Run(); err != nil {
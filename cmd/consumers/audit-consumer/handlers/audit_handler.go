@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/goccy/go-json"
+	"github.com/nhdms/base-go/internal"
+	"github.com/nhdms/base-go/pkg/app"
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+	"github.com/nhdms/base-go/proto/exmsg/services"
+	"go-micro.dev/v5/client"
+)
+
+// AuditHandler stores the audit events published by pkg/audit with the audit service
+type AuditHandler struct {
+	Publisher   app.PublisherInterface
+	AuditClient services.AuditService
+	Name        string
+}
+
+func (h *AuditHandler) GetName() string {
+	return h.Name
+}
+
+func (h *AuditHandler) Init() error {
+	h.AuditClient = internal.CreateAuditClient(nil)
+	return nil
+}
+
+func (h *AuditHandler) HandleMessage(msg *message.Message) error {
+	event := &models.AuditEvent{}
+	if err := json.Unmarshal(msg.Payload, event); err != nil || len(event.EventId) == 0 || event.OccurredAt == nil {
+		// can not be stored, redelivering does not help
+		logger.DefaultLogger.Errorw("Invalid audit event", "message_uuid", msg.UUID, "payload", string(msg.Payload), "error", err)
+		return nil
+	}
+
+	// an event delivered again is stored once (event_id)
+	_, err := h.AuditClient.InsertEvents(
+		context.Background(),
+		&models.AuditEvents{Events: []*models.AuditEvent{event}},
+		client.WithRetries(5),
+	)
+	if err != nil {
+		logger.DefaultLogger.Errorw("Could not insert audit event", "event_id", event.EventId, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (h *AuditHandler) SetPublisher(p app.PublisherInterface) {
+	h.Publisher = p
+}
+
+func (h *AuditHandler) Close() {
+}
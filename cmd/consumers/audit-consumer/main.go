@@ -0,0 +1,18 @@
+package main
+
+import (
+	"github.com/nhdms/base-go/cmd/consumers/audit-consumer/handlers"
+	"github.com/nhdms/base-go/pkg/app"
+	"github.com/nhdms/base-go/pkg/logger"
+)
+
+func main() {
+	auditHandler := &handlers.AuditHandler{
+		Name: "audit_consumer",
+	}
+
+	err := app.StartNewConsumer(auditHandler)
+	if err != nil {
+		logger.DefaultLogger.Fatal("Failed to start consumer: ", err)
+	}
+}
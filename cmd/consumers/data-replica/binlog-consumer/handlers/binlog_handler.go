@@ -1,33 +1,80 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/nhdms/base-go/pkg/app"
+	"github.com/nhdms/base-go/pkg/config"
 	"github.com/nhdms/base-go/pkg/logger"
+	replication "github.com/nhdms/base-go/pkg/replication/defines"
+	"github.com/nhdms/base-go/pkg/replication/sink"
 )
 
 type BinlogHandler struct {
 	Publisher app.PublisherInterface
 	Name      string
+	Router    *sink.Router
 }
 
+// HandleMessage writes the changes to the sinks configured for their table
 func (b *BinlogHandler) HandleMessage(msg *message.Message) error {
 	logger.DefaultLogger.Debug("Received ", string(msg.Payload))
-	return b.Publisher.PublishSimple(
-		b.Name,
-		msg.Payload,
-	)
+	if msg.Metadata.Get(replication.MetadataPayload) == replication.PayloadTransaction {
+		tx, err := replication.UnmarshalTransaction(msg.Payload)
+		if err != nil {
+			return err
+		}
+		return b.Router.WriteTransaction(context.Background(), tx)
+	}
+
+	messages, err := replication.UnmarshalMessages(msg.Payload)
+	if err != nil {
+		return err
+	}
+	return b.Router.Write(context.Background(), messages)
 }
 
 func (b *BinlogHandler) Init() error {
 	return nil
 }
 
+// SetPublisher creates the sinks, they are configured in replication_sinks. Without it every table is
+// published to the exchange Name with the routing key <schema>.<table>[.<partition>] (see the routing config),
+// an invalid replication_sinks stops the consumer.
 func (b *BinlogHandler) SetPublisher(p app.PublisherInterface) {
 	b.Publisher = p
+
+	conf, err := sink.LoadConfig("replication_sinks")
+	if err != nil && !errors.Is(err, sink.ErrConfigNotFound) {
+		logger.DefaultLogger.Fatalf("Failed to load replication sinks: %v", err)
+	}
+	if err != nil {
+		conf = &sink.Config{
+			Sinks:  map[string]sink.SinkConfig{b.Name: {Type: sink.TypeRabbitMQ, RoutingKey: "{schema}.{table}"}},
+			Tables: map[string][]string{"*": {b.Name}},
+		}
+
+		routing := conf.Sinks[b.Name]
+		_ = config.LoadConfigToVar(&routing.Routing, "routing")
+		if routing.Routing.Partitions > 1 {
+			routing.RoutingKey = "{schema}.{table}.{partition}"
+		}
+		conf.Sinks[b.Name] = routing
+	}
+
+	b.Router, err = sink.NewRouter(conf, sink.Dependencies{Publisher: p})
+	if err != nil {
+		logger.DefaultLogger.Fatalf("Failed to create replication sinks: %v", err)
+	}
 }
 
-func (b *BinlogHandler) Close() {}
+func (b *BinlogHandler) Close() {
+	if b.Router != nil {
+		_ = b.Router.Close()
+	}
+}
 
 func (b *BinlogHandler) GetName() string {
 	return b.Name
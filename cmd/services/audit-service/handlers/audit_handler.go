@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/nhdms/base-go/cmd/services/audit-service/tables"
+	"github.com/nhdms/base-go/pkg/common"
+	"github.com/nhdms/base-go/pkg/dbtool"
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+	"github.com/spf13/cast"
+)
+
+const (
+	defaultQueryLimit  = 50
+	maxQueryLimit      = 500
+	defaultQueryWindow = 24 * time.Hour
+)
+
+// errInvalidCursor is an invalid argument, the gateway responds it with 400
+var errInvalidCursor = fmt.Errorf("%w: invalid cursor", common.SQLInvalidFieldError)
+
+type AuditHandler struct {
+	db *dbtool.ConnectionManager
+}
+
+func NewAuditHandler(db *dbtool.ConnectionManager) *AuditHandler {
+	return &AuditHandler{db: db}
+}
+
+// InsertEvents stores the events, an event already stored (same event_id) is skipped
+func (h *AuditHandler) InsertEvents(ctx context.Context, events *models.AuditEvents, result *models.SQLResult) error {
+	if len(events.Events) == 0 {
+		return nil
+	}
+
+	sqlTool := dbtool.NewInsert(ctx, h.db.GetConnection(), tables.GetAuditEventTable(), &models.AuditEvent{})
+	qb := squirrel.
+		Insert(sqlTool.GetTable("")).
+		Columns(sqlTool.GetQueryColumnList("")...)
+
+	for _, event := range events.Events {
+		qb = qb.Values(sqlTool.GetFilledValues(event)...)
+	}
+
+	qb = qb.Suffix("ON CONFLICT (event_id, occurred_at) DO NOTHING")
+
+	inserted, err := sqlTool.Insert(ctx, qb)
+	if err != nil {
+		logger.DefaultLogger.Errorw("Failed to insert audit events", "count", len(events.Events), "error", err)
+		return err
+	}
+	result.LastInsertIds = inserted.LastInsertIds
+	result.RowsAffected = int64(len(inserted.LastInsertIds))
+	return nil
+}
+
+// QueryEvents returns the events of the query newest first, by pages of query.limit
+func (h *AuditHandler) QueryEvents(ctx context.Context, query *models.AuditQuery, result *models.AuditQueryResult) error {
+	to := time.Now()
+	if query.To != nil {
+		to = query.To.AsTime()
+	}
+	from := to.Add(-defaultQueryWindow)
+	if query.From != nil {
+		from = query.From.AsTime()
+	}
+
+	limit := int(query.Limit)
+	if limit <= 0 {
+		limit = defaultQueryLimit
+	}
+	if limit > maxQueryLimit {
+		limit = maxQueryLimit
+	}
+
+	sqlTool := dbtool.NewSelect(ctx, h.db.GetConnection(), tables.GetAuditEventTable(), &models.AuditEvent{})
+	qb := squirrel.
+		Select(sqlTool.GetQueryColumnList("ae")...).
+		From(sqlTool.GetTable("ae")).
+		Where(squirrel.GtOrEq{"ae.occurred_at": from}).
+		Where(squirrel.Lt{"ae.occurred_at": to}).
+		OrderBy("ae.occurred_at DESC", "ae.id DESC").
+		// one more row tells whether there is a next page
+		Limit(uint64(limit + 1))
+
+	if query.UserId > 0 {
+		qb = qb.Where(squirrel.Eq{"ae.user_id": query.UserId})
+	}
+	if len(query.PrincipalType) > 0 {
+		qb = qb.Where(squirrel.Eq{"ae.principal_type": query.PrincipalType})
+	}
+	if len(query.PrincipalId) > 0 {
+		qb = qb.Where(squirrel.Eq{"ae.principal_id": query.PrincipalId})
+	}
+	if len(query.Action) > 0 {
+		qb = qb.Where(squirrel.Eq{"ae.action": query.Action})
+	}
+	if len(query.Service) > 0 {
+		qb = qb.Where(squirrel.Eq{"ae.service": query.Service})
+	}
+	if len(query.Cursor) > 0 {
+		occurredAt, id, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return err
+		}
+		qb = qb.Where("(ae.occurred_at, ae.id) < (?, ?)", occurredAt, id)
+	}
+
+	events := make([]*models.AuditEvent, 0)
+	if err := sqlTool.Select(ctx, &events, qb); err != nil {
+		logger.DefaultLogger.Errorw("Failed to query audit events", "error", err)
+		return err
+	}
+
+	if len(events) > limit {
+		events = events[:limit]
+		result.NextCursor = encodeCursor(events[limit-1])
+	}
+	result.Events = events
+	return nil
+}
+
+// a cursor is the position (occurred_at, id) of the last event of a page
+func encodeCursor(event *models.AuditEvent) string {
+	return fmt.Sprintf("%d_%d", event.GetOccurredAt().AsTime().UnixMicro(), event.GetId())
+}
+
+func decodeCursor(cursor string) (time.Time, int64, error) {
+	occurredAt, id, ok := strings.Cut(cursor, "_")
+	if !ok {
+		return time.Time{}, 0, errInvalidCursor
+	}
+	micros, err := cast.ToInt64E(occurredAt)
+	if err != nil {
+		return time.Time{}, 0, errInvalidCursor
+	}
+	eventID, err := cast.ToInt64E(id)
+	if err != nil {
+		return time.Time{}, 0, errInvalidCursor
+	}
+	return time.UnixMicro(micros), eventID, nil
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nhdms/base-go/pkg/common"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestCursor(t *testing.T) {
+	occurredAt := time.Date(2026, 10, 19, 8, 30, 0, 123456000, time.UTC)
+	cursor := encodeCursor(&models.AuditEvent{Id: 42, OccurredAt: timestamppb.New(occurredAt)})
+
+	decodedAt, id, err := decodeCursor(cursor)
+	if err != nil || id != 42 || !decodedAt.Equal(occurredAt) {
+		t.Fatalf("unexpected cursor %s: %v %d %v", cursor, decodedAt, id, err)
+	}
+
+	for _, invalid := range []string{"", "42", "x_42", "1_x"} {
+		if _, _, err = decodeCursor(invalid); err != errInvalidCursor {
+			t.Errorf("expected invalid cursor for %q, got %v", invalid, err)
+		}
+	}
+
+	// the gateway responds invalid arguments with 400
+	if !common.IsInvalidFieldError(errInvalidCursor) {
+		t.Errorf("expected an invalid field error, got %v", errInvalidCursor)
+	}
+
+	if name := partitionName(monthStart(occurredAt.Add(20 * 24 * time.Hour))); name != "audit_events_2026_11" {
+		t.Fatalf("unexpected partition %s", name)
+	}
+}
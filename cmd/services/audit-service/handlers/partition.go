@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nhdms/base-go/pkg/config"
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/spf13/viper"
+)
+
+const partitionPrefix = "audit_events_"
+
+// MaintainPartitions creates and drops the partitions of audit_events from the audit config, it runs before serving
+// so the events of the current month are not inserted into the default partition
+func (h *AuditHandler) MaintainPartitions(ctx context.Context) error {
+	monthsAhead := config.ViperGetIntWithDefault("audit.partition_months_ahead", 2)
+	retentionMonths := viper.GetInt("audit.retention_months")
+	return h.EnsurePartitions(ctx, time.Now(), monthsAhead, retentionMonths)
+}
+
+// RunPartitionMaintenance runs MaintainPartitions every audit.partition_interval (24h) until ctx is done
+func (h *AuditHandler) RunPartitionMaintenance(ctx context.Context) {
+	interval := config.ViperGetDurationWithDefault("audit.partition_interval", 24*time.Hour)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := h.MaintainPartitions(ctx); err != nil {
+			logger.DefaultLogger.Errorw("Failed to maintain audit partitions", "error", err)
+		}
+	}
+}
+
+// EnsurePartitions creates the monthly partitions from the month of now to monthsAhead months later, and drops the
+// partitions of the months before the last retentionMonths months (0 keeps every partition).
+// A failed month does not stop the others, the errors are returned together.
+func (h *AuditHandler) EnsurePartitions(ctx context.Context, now time.Time, monthsAhead, retentionMonths int) error {
+	var errs []error
+	month := monthStart(now)
+	for i := 0; i <= monthsAhead; i++ {
+		if err := h.createPartition(ctx, month.AddDate(0, i, 0)); err != nil {
+			errs = append(errs, fmt.Errorf("create partition %s: %w", partitionName(month.AddDate(0, i, 0)), err))
+		}
+	}
+
+	if retentionMonths > 0 {
+		if err := h.dropPartitions(ctx, month.AddDate(0, -retentionMonths, 0)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// createPartition creates the partition of month, the events of the month already in the default partition are moved
+// to it, postgres can not create a partition whose rows are in the default partition
+func (h *AuditHandler) createPartition(ctx context.Context, month time.Time) error {
+	db := h.db.GetConnection()
+	name := partitionName(month)
+
+	var exists bool
+	if err := db.GetContext(ctx, &exists, "SELECT to_regclass($1) IS NOT NULL", name); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	from, to := month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339)
+	// inserts of the month wait until the partition is attached
+	if _, err = tx.ExecContext(ctx, "LOCK TABLE audit_events_default IN ACCESS EXCLUSIVE MODE"); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (LIKE audit_events INCLUDING DEFAULTS INCLUDING CONSTRAINTS)", name)); err != nil {
+		return err
+	}
+
+	moved, err := tx.ExecContext(ctx, fmt.Sprintf(`WITH moved AS (
+		DELETE FROM audit_events_default WHERE occurred_at >= $1 AND occurred_at < $2 RETURNING *
+	) INSERT INTO %s SELECT * FROM moved`, name), from, to)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE audit_events ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')", name, from, to)); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	rows, _ := moved.RowsAffected()
+	logger.DefaultLogger.Infow("Created audit partition", "partition", name, "moved_events", rows)
+	return nil
+}
+
+// dropPartitions drops the partitions of the months before oldest
+func (h *AuditHandler) dropPartitions(ctx context.Context, oldest time.Time) error {
+	db := h.db.GetConnection()
+
+	var partitions []string
+	err := db.SelectContext(ctx, &partitions, `SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'audit_events'`)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, partition := range partitions {
+		// the default partition and partitions not created by EnsurePartitions are kept
+		suffix, ok := strings.CutPrefix(partition, partitionPrefix)
+		if !ok {
+			continue
+		}
+		partitionMonth, err := time.Parse("2006_01", suffix)
+		if err != nil || !partitionMonth.Before(oldest) {
+			continue
+		}
+		if _, err = db.ExecContext(ctx, "DROP TABLE "+partition); err != nil {
+			errs = append(errs, fmt.Errorf("drop partition %s: %w", partition, err))
+			continue
+		}
+		logger.DefaultLogger.Infow("Dropped audit partition", "partition", partition)
+	}
+	return errors.Join(errs...)
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func partitionName(month time.Time) string {
+	return partitionPrefix + month.Format("2006_01")
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+
+	"github.com/nhdms/base-go/cmd/services/audit-service/handlers"
+	"github.com/nhdms/base-go/pkg/app"
+	"github.com/nhdms/base-go/pkg/dbtool"
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/nhdms/base-go/proto/exmsg/services"
+)
+
+func main() {
+	svc := app.NewGRPCService()
+	psql, err := dbtool.NewConnectionManager(dbtool.DBTypePostgreSQL, nil)
+	if err != nil {
+		logger.DefaultLogger.Fatal("Failed to connect to database: ", err)
+	}
+
+	grpcSvc := handlers.NewAuditHandler(psql)
+	err = services.RegisterAuditServiceHandler(svc.Server(), grpcSvc)
+	if err != nil {
+		logger.DefaultLogger.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the partitions of the current months exist before the first events are inserted
+	if err = grpcSvc.MaintainPartitions(ctx); err != nil {
+		logger.DefaultLogger.Errorw("Failed to maintain audit partitions", "error", err)
+	}
+	go grpcSvc.RunPartitionMaintenance(ctx)
+
+	err = svc.Run()
+	if err != nil {
+		logger.DefaultLogger.Fatal(err)
+	}
+}
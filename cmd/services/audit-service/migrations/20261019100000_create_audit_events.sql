@@ -0,0 +1,32 @@
+-- migrate:up
+-- monthly partitions audit_events_YYYY_MM are created ahead by the audit service (audit.partition_months_ahead),
+-- the default partition keeps the events of a missing month
+CREATE TABLE audit_events (
+    id             BIGSERIAL,
+    event_id       UUID        NOT NULL,
+    occurred_at    TIMESTAMPTZ NOT NULL,
+    source         TEXT,
+    principal_type TEXT,
+    principal_id   TEXT,
+    user_id        BIGINT,
+    action         TEXT,
+    service        TEXT,
+    method         TEXT,
+    path           TEXT,
+    status         INT,
+    latency_ms     BIGINT,
+    client_ip      TEXT,
+    request_id     TEXT,
+    error          TEXT,
+    PRIMARY KEY (id, occurred_at),
+    UNIQUE (event_id, occurred_at)
+) PARTITION BY RANGE (occurred_at);
+
+CREATE TABLE audit_events_default PARTITION OF audit_events DEFAULT;
+
+CREATE INDEX audit_events_occurred_at_idx ON audit_events (occurred_at DESC, id DESC);
+CREATE INDEX audit_events_user_id_idx ON audit_events (user_id, occurred_at DESC);
+CREATE INDEX audit_events_action_idx ON audit_events (action, occurred_at DESC);
+
+-- migrate:down
+DROP TABLE audit_events;
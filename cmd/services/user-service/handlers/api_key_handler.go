@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+	"github.com/nhdms/base-go/pkg/common"
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/nhdms/base-go/proto/exmsg/services"
+)
+
+// GetAPIKey returns the api key of the hash if it is neither revoked nor expired, and records its last use
+func (u *UserHandler) GetAPIKey(ctx context.Context, request *services.APIKeyRequest, response *services.APIKeyResponse) error {
+	if len(request.KeyHash) == 0 {
+		return common.SQLNotFoundError
+	}
+
+	query, args, err := squirrel.Update("api_keys").
+		Set("last_used_at", squirrel.Expr("now()")).
+		Where(squirrel.Eq{"key_hash": request.KeyHash, "revoked_at": nil}).
+		Where("(expires_at IS NULL OR expires_at > now())").
+		Suffix("RETURNING id, user_id, name, scopes, COALESCE(EXTRACT(EPOCH FROM expires_at)::BIGINT, 0)").
+		PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return err
+	}
+
+	var scopes pq.StringArray
+	err = u.db.GetConnection().QueryRowxContext(ctx, query, args...).
+		Scan(&response.Id, &response.UserId, &response.Name, &scopes, &response.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return common.SQLNotFoundError
+	}
+	if err != nil {
+		logger.DefaultLogger.Errorw("Failed to get api key", "error", err)
+		return err
+	}
+	response.Scopes = scopes
+	return nil
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+	"github.com/nhdms/base-go/proto/exmsg/services"
+)
+
+const profileStatusActive = 1
+
+// GetUserClaims returns the authorization data of the token of the user: the permissions of the roles of the user
+// and of its active profiles merged per module, the data sets (project/country) of the profiles, and the users of
+// the departments below the departments of the user
+func (u *UserHandler) GetUserClaims(ctx context.Context, request *services.UserRequest, response *services.UserClaimsResponse) error {
+	db := u.db.GetConnection()
+
+	roleQuery, args, err := squirrel.Select("permissions").From("roles").
+		Where("id IN (SELECT role_id FROM users WHERE id = ? UNION SELECT role_id FROM user_profiles WHERE user_id = ? AND status = ?)",
+			request.UserId, request.UserId, profileStatusActive).
+		PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.QueryContext(ctx, roleQuery, args...)
+	if err != nil {
+		logger.DefaultLogger.Errorw("Failed to get role permissions", "user_id", request.UserId, "error", err)
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rolePermissions pq.Int64Array
+		if err = rows.Scan(&rolePermissions); err != nil {
+			return err
+		}
+		response.Permissions = mergePermissions(response.Permissions, rolePermissions)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	dataSetQuery, args, err := squirrel.Select("DISTINCT ds.project_id", "ds.country_id").
+		From("user_profiles up").
+		Join("data_sets ds ON ds.id = up.data_set_id").
+		Where(squirrel.Eq{"up.user_id": request.UserId, "up.status": profileStatusActive}).
+		OrderBy("ds.project_id", "ds.country_id").
+		PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return err
+	}
+	dataSetRows, err := db.QueryContext(ctx, dataSetQuery, args...)
+	if err != nil {
+		logger.DefaultLogger.Errorw("Failed to get data sets", "user_id", request.UserId, "error", err)
+		return err
+	}
+	defer dataSetRows.Close()
+	for dataSetRows.Next() {
+		dataSet := &models.JWTDataSet{}
+		if err = dataSetRows.Scan(&dataSet.ProjectId, &dataSet.CountryId); err != nil {
+			return err
+		}
+		response.DataSets = append(response.DataSets, dataSet)
+	}
+	if err = dataSetRows.Err(); err != nil {
+		return err
+	}
+
+	subUserQuery, args, err := squirrel.Select("DISTINCT up.user_id").
+		From("user_profiles up").
+		Join("departments d ON d.id = up.department_id").
+		Where("d.ancestor_ids && ARRAY(SELECT department_id FROM user_profiles WHERE user_id = ? AND status = ?)", request.UserId, profileStatusActive).
+		Where(squirrel.Eq{"up.status": profileStatusActive}).
+		Where(squirrel.NotEq{"up.user_id": request.UserId}).
+		OrderBy("up.user_id").
+		PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return err
+	}
+	if err = db.SelectContext(ctx, &response.SubUserIds, subUserQuery, args...); err != nil {
+		logger.DefaultLogger.Errorw("Failed to get sub users", "user_id", request.UserId, "error", err)
+		return err
+	}
+	return nil
+}
+
+// mergePermissions ORs the bitmasks of a role into permissions, both are indexed by permissions.Permission module
+func mergePermissions(permissions []int64, rolePermissions []int64) []int64 {
+	for len(permissions) < len(rolePermissions) {
+		permissions = append(permissions, 0)
+	}
+	for module, permission := range rolePermissions {
+		permissions[module] |= permission
+	}
+	return permissions
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/nhdms/base-go/pkg/dbtool"
+	"github.com/nhdms/base-go/proto/exmsg/services"
+)
+
+func TestGetUserClaims(t *testing.T) {
+	db := userHandler.db.GetConnection()
+	if _, err := dbtool.NewMigrator(db, "../migrations", "user-service", false).Up(ctx); err != nil {
+		t.Fatal("Failed to migrate", err)
+	}
+
+	insert := func(query string, args ...interface{}) int64 {
+		var id int64
+		if err := db.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id); err != nil {
+			t.Fatal("Failed to insert fixture", err)
+		}
+		return id
+	}
+
+	const userId, subUserId, inactiveUserId = 990000001, 990000002, 990000003
+	adminRole := insert("INSERT INTO roles (name, permissions) VALUES ('claims-admin', $1)", pq.Int64Array{1, 2})
+	saleRole := insert("INSERT INTO roles (name, permissions) VALUES ('claims-sale', $1)", pq.Int64Array{4, 0, 8})
+	dataSet := insert("INSERT INTO data_sets (name, project_id, country_id) VALUES ('claims', 9001, 84)")
+	department := insert("INSERT INTO departments (name) VALUES ('claims')")
+	childDepartment := insert("INSERT INTO departments (name, parent_id) VALUES ('claims-child', $1)", department)
+
+	profile := "INSERT INTO user_profiles (user_id, department_id, status, data_set_id, role_id, created_at, updated_at) " +
+		"VALUES ($1, $2, $3, $4, $5, extract(epoch from now())::bigint, extract(epoch from now())::bigint)"
+	insert(profile, userId, department, profileStatusActive, dataSet, adminRole)
+	insert(profile, userId, department, profileStatusActive, dataSet, saleRole)
+	insert(profile, subUserId, childDepartment, profileStatusActive, dataSet, saleRole)
+	insert(profile, inactiveUserId, childDepartment, profileStatusActive+1, dataSet, saleRole)
+
+	t.Cleanup(func() {
+		_, _ = db.ExecContext(ctx, "DELETE FROM user_profiles WHERE user_id = ANY($1)", pq.Int64Array{userId, subUserId, inactiveUserId})
+		_, _ = db.ExecContext(ctx, "DELETE FROM departments WHERE id = ANY($1)", pq.Int64Array{childDepartment, department})
+		_, _ = db.ExecContext(ctx, "DELETE FROM data_sets WHERE id = $1", dataSet)
+		_, _ = db.ExecContext(ctx, "DELETE FROM roles WHERE id = ANY($1)", pq.Int64Array{adminRole, saleRole})
+	})
+
+	resp := services.UserClaimsResponse{}
+	if err := userHandler.GetUserClaims(ctx, &services.UserRequest{UserId: userId}, &resp); err != nil {
+		t.Fatal("Failed to get user claims", err)
+	}
+
+	if !reflect.DeepEqual(resp.Permissions, []int64{5, 2, 8}) {
+		t.Fatalf("expected permissions of both roles merged, got %v", resp.Permissions)
+	}
+	if len(resp.DataSets) != 1 || resp.DataSets[0].ProjectId != 9001 || resp.DataSets[0].CountryId != 84 {
+		t.Fatalf("unexpected data sets %v", resp.DataSets)
+	}
+	if !reflect.DeepEqual(resp.SubUserIds, []int64{subUserId}) {
+		t.Fatalf("expected the active user of the child department, got %v", resp.SubUserIds)
+	}
+}
@@ -0,0 +1,20 @@
+-- migrate:up
+CREATE TABLE api_keys (
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT      NOT NULL,
+    name         TEXT        NOT NULL DEFAULT '',
+    key_prefix   TEXT        NOT NULL DEFAULT '', -- first characters of the key, to recognize it in the key list
+    key_hash     TEXT        NOT NULL,            -- sha256 hex of the key, the key itself is only shown on creation
+    scopes       TEXT[]      NOT NULL DEFAULT '{}',
+    expires_at   TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX api_keys_key_hash_idx ON api_keys (key_hash);
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);
+
+-- migrate:down
+DROP TABLE api_keys;
@@ -0,0 +1,92 @@
+-- migrate:up
+-- tables read by GetUserClaims, existing tables only get the missing columns
+CREATE TABLE IF NOT EXISTS roles (
+    id         BIGSERIAL PRIMARY KEY,
+    name       TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+-- permission bitmasks indexed by the permissions.Permission module
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS permissions BIGINT[] NOT NULL DEFAULT '{}';
+
+-- a data set is a project in a country, the scope of a user profile
+CREATE TABLE IF NOT EXISTS data_sets (
+    id         BIGSERIAL PRIMARY KEY,
+    name       TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+ALTER TABLE data_sets ADD COLUMN IF NOT EXISTS project_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE data_sets ADD COLUMN IF NOT EXISTS country_id BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS departments (
+    id         BIGSERIAL PRIMARY KEY,
+    name       TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS parent_id BIGINT;
+-- departments above the department (not itself), maintained from parent_id by the triggers below
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS ancestor_ids BIGINT[] NOT NULL DEFAULT '{}';
+CREATE INDEX IF NOT EXISTS departments_ancestor_ids_idx ON departments USING GIN (ancestor_ids);
+
+-- fill the ancestors of the existing departments from the roots down
+WITH RECURSIVE tree AS (
+    SELECT id, ARRAY[]::BIGINT[] AS ancestor_ids FROM departments
+    WHERE parent_id IS NULL OR parent_id NOT IN (SELECT id FROM departments)
+    UNION ALL
+    SELECT d.id, t.ancestor_ids || t.id FROM departments d JOIN tree t ON d.parent_id = t.id
+)
+UPDATE departments d SET ancestor_ids = tree.ancestor_ids FROM tree WHERE d.id = tree.id;
+
+CREATE OR REPLACE FUNCTION departments_set_ancestor_ids() RETURNS trigger AS $$
+BEGIN
+    NEW.ancestor_ids := COALESCE((SELECT d.ancestor_ids || d.id FROM departments d WHERE d.id = NEW.parent_id), '{}');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- the children are updated when a department moves, their triggers update their own children
+CREATE OR REPLACE FUNCTION departments_update_children() RETURNS trigger AS $$
+BEGIN
+    IF NEW.ancestor_ids IS DISTINCT FROM OLD.ancestor_ids THEN
+        UPDATE departments SET parent_id = parent_id WHERE parent_id = NEW.id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS departments_set_ancestor_ids ON departments;
+CREATE TRIGGER departments_set_ancestor_ids BEFORE INSERT OR UPDATE OF parent_id ON departments
+    FOR EACH ROW EXECUTE FUNCTION departments_set_ancestor_ids();
+
+DROP TRIGGER IF EXISTS departments_update_children ON departments;
+CREATE TRIGGER departments_update_children AFTER UPDATE OF ancestor_ids, parent_id ON departments
+    FOR EACH ROW EXECUTE FUNCTION departments_update_children();
+
+-- the profiles of a user, see models.UserProfile
+CREATE TABLE IF NOT EXISTS user_profiles (
+    id            BIGSERIAL PRIMARY KEY,
+    created_at    BIGINT   NOT NULL DEFAULT 0,
+    updated_at    BIGINT   NOT NULL DEFAULT 0,
+    user_id       BIGINT   NOT NULL,
+    department_id BIGINT,
+    status        SMALLINT NOT NULL DEFAULT 0,
+    data_set_id   BIGINT,
+    role_id       BIGINT,
+    type          SMALLINT NOT NULL DEFAULT 0,
+    updated_by    BIGINT
+);
+CREATE INDEX IF NOT EXISTS user_profiles_user_id_idx ON user_profiles (user_id);
+CREATE INDEX IF NOT EXISTS user_profiles_department_id_idx ON user_profiles (department_id);
+
+-- migrate:down
+DROP TRIGGER IF EXISTS departments_update_children ON departments;
+DROP TRIGGER IF EXISTS departments_set_ancestor_ids ON departments;
+DROP FUNCTION IF EXISTS departments_update_children();
+DROP FUNCTION IF EXISTS departments_set_ancestor_ids();
+DROP INDEX IF EXISTS departments_ancestor_ids_idx;
+ALTER TABLE departments DROP COLUMN IF EXISTS ancestor_ids;
+ALTER TABLE data_sets DROP COLUMN IF EXISTS country_id;
+ALTER TABLE data_sets DROP COLUMN IF EXISTS project_id;
+ALTER TABLE roles DROP COLUMN IF EXISTS permissions;
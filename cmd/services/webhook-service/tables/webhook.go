@@ -1,6 +1,13 @@
 package tables
 
-import "github.com/nhdms/base-go/pkg/dbtool"
+import (
+	"github.com/nhdms/base-go/pkg/dbtool"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+)
+
+func init() {
+	dbtool.RegisterTable(GetWebhookEventsTable(), &models.WebhookEvent{})
+}
 
 func GetWebhookEventsTable() *dbtool.Table {
 	return &dbtool.Table{
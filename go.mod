@@ -7,6 +7,7 @@ require (
 	github.com/PuerkitoBio/rehttp v1.4.0
 	github.com/ThreeDotsLabs/watermill v1.3.7
 	github.com/ThreeDotsLabs/watermill-amqp/v3 v3.0.0
+	github.com/bufbuild/protocompile v0.14.0
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/go-sql-driver/mysql v1.8.1
 	github.com/goccy/go-json v0.10.3
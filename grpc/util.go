@@ -6,6 +6,7 @@ import (
 	"os"
 	"sync"
 
+	"github.com/nhdms/base-go/pkg/common"
 	"google.golang.org/grpc/codes"
 )
 
@@ -33,6 +34,10 @@ func convertCode(err error) codes.Code {
 		return codes.NotFound
 	case os.IsPermission(err):
 		return codes.PermissionDenied
+	case common.IsConflictError(err):
+		return codes.Aborted
+	case common.IsInvalidFieldError(err):
+		return codes.InvalidArgument
 	}
 	return codes.Unknown
 }
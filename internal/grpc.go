@@ -65,6 +65,13 @@ func CreateWebhookClient(conn client.Client) services.WebhookService {
 	return services.NewWebhookService(app.GetGRPCServiceName(common.ServiceNameWebhook), conn)
 }
 
+func CreateAuditClient(conn client.Client) services.AuditService {
+	if conn == nil {
+		conn = createGRPCClient()
+	}
+	return services.NewAuditService(app.GetGRPCServiceName(common.ServiceNameAudit), conn)
+}
+
 func CreateEventClient(conn client.Client) services.EventService {
 	if conn == nil {
 		conn = createGRPCClient()
@@ -303,3 +303,8 @@ const (
 	DeviceManagementFetchMany = 1 << 0
 	DeviceManagementCreate    = 1 << 1
 )
+
+// AuditLogs Permissions (Module 31)
+const (
+	AuditLogsFetchMany = 1 << 0
+)
@@ -34,4 +34,5 @@ const (
 	Marketplace                        // 28
 	Currency                           // 29
 	DeviceManagement                   // 30
+	AuditLogs                          // 31
 )
@@ -0,0 +1,222 @@
+// Code generated by gcli gen permissions. DO NOT EDIT.
+// source: internal/permissions
+
+package permissions
+
+var moduleKeys = map[Permission]string{
+	Dashboard:        "dashboard",
+	Order:            "order",
+	Customer:         "customer",
+	Product:          "product",
+	Supplier:         "supplier",
+	Inventory:        "inventory",
+	Inbound:          "inbound",
+	Outbound:         "outbound",
+	Stocktaking:      "stocktaking",
+	ReturnHandling:   "return_handling",
+	Telesales:        "telesales",
+	CarePage:         "care_page",
+	BotManagement:    "bot_management",
+	FanPages:         "fan_pages",
+	Campaigns:        "campaigns",
+	Projects:         "projects",
+	Countries:        "countries",
+	Accounts:         "accounts",
+	Roles:            "roles",
+	Org:              "org",
+	Shift:            "shift",
+	Tags:             "tags",
+	OrderSource:      "order_source",
+	ReportReason:     "report_reason",
+	CancelReason:     "cancel_reason",
+	PrintNotes:       "print_notes",
+	Translation:      "translation",
+	Fulfillment:      "fulfillment",
+	Marketplace:      "marketplace",
+	Currency:         "currency",
+	DeviceManagement: "device_management",
+	AuditLogs:        "audit_logs",
+}
+
+var definitions = []Definition{
+	{Module: Dashboard, Bit: DashboardOrderShipmentOverview, Key: "dashboard.order_shipment_overview"},
+	{Module: Dashboard, Bit: DashboardOrderShipmentCarrier, Key: "dashboard.order_shipment_carrier"},
+	{Module: Dashboard, Bit: DashboardOrderShipmentSaleReps, Key: "dashboard.order_shipment_sale_reps"},
+	{Module: Dashboard, Bit: DashboardOrderShipmentFilter, Key: "dashboard.order_shipment_filter"},
+	{Module: Dashboard, Bit: DashboardCarePageOverview, Key: "dashboard.care_page_overview"},
+	{Module: Dashboard, Bit: DashboardCarePagePerformance, Key: "dashboard.care_page_performance"},
+	{Module: Dashboard, Bit: DashboardCarePageReasons, Key: "dashboard.care_page_reasons"},
+	{Module: Dashboard, Bit: DashboardCarePageFilter, Key: "dashboard.care_page_filter"},
+	{Module: Dashboard, Bit: DashboardTelesalesOverview, Key: "dashboard.telesales_overview"},
+	{Module: Dashboard, Bit: DashboardTelesalesPerformance, Key: "dashboard.telesales_performance"},
+	{Module: Dashboard, Bit: DashboardTelesalesReasons, Key: "dashboard.telesales_reasons"},
+	{Module: Dashboard, Bit: DashboardTelesalesFilter, Key: "dashboard.telesales_filter"},
+	{Module: Dashboard, Bit: DashboardMarketingCarePage, Key: "dashboard.marketing_care_page"},
+	{Module: Dashboard, Bit: DashboardMarketingTelesales, Key: "dashboard.marketing_telesales"},
+	{Module: Order, Bit: OrderFetchMany, Key: "order.fetch_many"},
+	{Module: Order, Bit: OrderBasicSearch, Key: "order.basic_search"},
+	{Module: Order, Bit: OrderAdvanceSearch, Key: "order.advance_search"},
+	{Module: Order, Bit: OrderDuplicateFilter, Key: "order.duplicate_filter"},
+	{Module: Order, Bit: OrderExportOrders, Key: "order.export_orders"},
+	{Module: Order, Bit: OrderCreate, Key: "order.create"},
+	{Module: Order, Bit: OrderBulkCreate, Key: "order.bulk_create"},
+	{Module: Order, Bit: OrderFetchOne, Key: "order.fetch_one"},
+	{Module: Order, Bit: OrderEditProductsAndFees, Key: "order.edit_products_and_fees"},
+	{Module: Order, Bit: OrderEditGeneralInformation, Key: "order.edit_general_information"},
+	{Module: Order, Bit: OrderEditCustomerInformation, Key: "order.edit_customer_information"},
+	{Module: Order, Bit: OrderEditDeliveryInformation, Key: "order.edit_delivery_information"},
+	{Module: Order, Bit: OrderEditTags, Key: "order.edit_tags"},
+	{Module: Order, Bit: OrderUpdateStatus, Key: "order.update_status"},
+	{Module: Order, Bit: OrderCancel, Key: "order.cancel"},
+	{Module: Order, Bit: OrderReadHistories, Key: "order.read_histories"},
+	{Module: Order, Bit: OrderBulkUpdateStatus, Key: "order.bulk_update_status"},
+	{Module: Order, Bit: OrderBulkUpdateSaleReps, Key: "order.bulk_update_sale_reps"},
+	{Module: Order, Bit: OrderBulkUpdateTags, Key: "order.bulk_update_tags"},
+	{Module: Order, Bit: OrderBulkUpdateSource, Key: "order.bulk_update_source"},
+	{Module: Order, Bit: OrderBulkSyncOrderToFFM, Key: "order.bulk_sync_order_to_ffm"},
+	{Module: Customer, Bit: CustomerFetchMany, Key: "customer.fetch_many"},
+	{Module: Customer, Bit: CustomerFetchOne, Key: "customer.fetch_one"},
+	{Module: Customer, Bit: CustomerUpdate, Key: "customer.update"},
+	{Module: Customer, Bit: CustomerCreate, Key: "customer.create"},
+	{Module: Product, Bit: ProductFetchMany, Key: "product.fetch_many"},
+	{Module: Product, Bit: ProductExport, Key: "product.export"},
+	{Module: Product, Bit: ProductImport, Key: "product.import"},
+	{Module: Product, Bit: ProductCreate, Key: "product.create"},
+	{Module: Product, Bit: ProductCreateCombo, Key: "product.create_combo"},
+	{Module: Product, Bit: ProductFetchOne, Key: "product.fetch_one"},
+	{Module: Product, Bit: ProductUpdate, Key: "product.update"},
+	{Module: Supplier, Bit: SupplierFetchMany, Key: "supplier.fetch_many"},
+	{Module: Supplier, Bit: SupplierFetchOne, Key: "supplier.fetch_one"},
+	{Module: Supplier, Bit: SupplierCreate, Key: "supplier.create"},
+	{Module: Supplier, Bit: SupplierUpdate, Key: "supplier.update"},
+	{Module: Inventory, Bit: InventoryFetchMany, Key: "inventory.fetch_many"},
+	{Module: Inbound, Bit: InboundFetchMany, Key: "inbound.fetch_many"},
+	{Module: Inbound, Bit: InboundFetchOne, Key: "inbound.fetch_one"},
+	{Module: Inbound, Bit: InboundCreate, Key: "inbound.create"},
+	{Module: Inbound, Bit: InboundUpdate, Key: "inbound.update"},
+	{Module: Inbound, Bit: InboundUpdateStatus, Key: "inbound.update_status"},
+	{Module: Outbound, Bit: OutboundFetchMany, Key: "outbound.fetch_many"},
+	{Module: Outbound, Bit: OutboundFetchOne, Key: "outbound.fetch_one"},
+	{Module: Outbound, Bit: OutboundCreate, Key: "outbound.create"},
+	{Module: Outbound, Bit: OutboundUpdate, Key: "outbound.update"},
+	{Module: Outbound, Bit: OutboundUpdateStatus, Key: "outbound.update_status"},
+	{Module: Stocktaking, Bit: StocktakingFetchMany, Key: "stocktaking.fetch_many"},
+	{Module: Stocktaking, Bit: StocktakingFetchOne, Key: "stocktaking.fetch_one"},
+	{Module: Stocktaking, Bit: StocktakingCreate, Key: "stocktaking.create"},
+	{Module: Stocktaking, Bit: StocktakingUpdate, Key: "stocktaking.update"},
+	{Module: Stocktaking, Bit: StocktakingUpdateStatus, Key: "stocktaking.update_status"},
+	{Module: ReturnHandling, Bit: ReturnHandlingFetchMany, Key: "return_handling.fetch_many"},
+	{Module: ReturnHandling, Bit: ReturnHandlingFetchOne, Key: "return_handling.fetch_one"},
+	{Module: ReturnHandling, Bit: ReturnHandlingCreate, Key: "return_handling.create"},
+	{Module: ReturnHandling, Bit: ReturnHandlingUpdate, Key: "return_handling.update"},
+	{Module: ReturnHandling, Bit: ReturnHandlingUpdateStatus, Key: "return_handling.update_status"},
+	{Module: Telesales, Bit: TelesalesFetchAssignedLeads, Key: "telesales.fetch_assigned_leads"},
+	{Module: Telesales, Bit: TelesalesAssignedLeadsFilter, Key: "telesales.assigned_leads_filter"},
+	{Module: Telesales, Bit: TelesalesTakeCareLeads, Key: "telesales.take_care_leads"},
+	{Module: Telesales, Bit: TelesalesAppointments, Key: "telesales.appointments"},
+	{Module: Telesales, Bit: TelesalesFetchOne, Key: "telesales.fetch_one"},
+	{Module: Telesales, Bit: TelesalesEditProductsAndFees, Key: "telesales.edit_products_and_fees"},
+	{Module: Telesales, Bit: TelesalesEditGeneralInformation, Key: "telesales.edit_general_information"},
+	{Module: Telesales, Bit: TelesalesEditCustomerInformation, Key: "telesales.edit_customer_information"},
+	{Module: Telesales, Bit: TelesalesEditDeliveryInformation, Key: "telesales.edit_delivery_information"},
+	{Module: Telesales, Bit: TelesalesEditTags, Key: "telesales.edit_tags"},
+	{Module: Telesales, Bit: TelesalesCreateCareReason, Key: "telesales.create_care_reason"},
+	{Module: Telesales, Bit: TelesalesEditSource, Key: "telesales.edit_source"},
+	{Module: Telesales, Bit: TelesalesActionLogs, Key: "telesales.action_logs"},
+	{Module: Telesales, Bit: TelesalesFetchLeads, Key: "telesales.fetch_leads"},
+	{Module: Telesales, Bit: TelesalesLeadsFilter, Key: "telesales.leads_filter"},
+	{Module: Telesales, Bit: TelesalesManualDistribute, Key: "telesales.manual_distribute"},
+	{Module: Telesales, Bit: TelesalesManualRevoke, Key: "telesales.manual_revoke"},
+	{Module: Telesales, Bit: TelesalesExportExcel, Key: "telesales.export_excel"},
+	{Module: Telesales, Bit: TelesalesImportExcel, Key: "telesales.import_excel"},
+	{Module: Telesales, Bit: TelesalesDistributeConfig, Key: "telesales.distribute_config"},
+	{Module: Telesales, Bit: TelesalesProcessingProcedureConfig, Key: "telesales.processing_procedure_config"},
+	{Module: CarePage, Bit: CarePageFetchPageGroups, Key: "care_page.fetch_page_groups"},
+	{Module: CarePage, Bit: CarePageCreatePageGroup, Key: "care_page.create_page_group"},
+	{Module: CarePage, Bit: CarePageUpdatePageGroup, Key: "care_page.update_page_group"},
+	{Module: CarePage, Bit: CarePagePageGroupsAdvanceFilter, Key: "care_page.page_groups_advance_filter"},
+	{Module: CarePage, Bit: CarePageManualDistribute, Key: "care_page.manual_distribute"},
+	{Module: CarePage, Bit: CarePageManualRevoke, Key: "care_page.manual_revoke"},
+	{Module: CarePage, Bit: CarePageBulkUpdate, Key: "care_page.bulk_update"},
+	{Module: CarePage, Bit: CarePageProcess, Key: "care_page.process"},
+	{Module: CarePage, Bit: CarePageCreateOrder, Key: "care_page.create_order"},
+	{Module: CarePage, Bit: CarePageCreateAppointment, Key: "care_page.create_appointment"},
+	{Module: CarePage, Bit: CarePageActionLogs, Key: "care_page.action_logs"},
+	{Module: CarePage, Bit: CarePageFetchConfigGroups, Key: "care_page.fetch_config_groups"},
+	{Module: CarePage, Bit: CarePageCreateConfigGroup, Key: "care_page.create_config_group"},
+	{Module: CarePage, Bit: CarePageUpdateConfigGroup, Key: "care_page.update_config_group"},
+	{Module: CarePage, Bit: CarePageRemoveConfigGroup, Key: "care_page.remove_config_group"},
+	{Module: CarePage, Bit: CarePageLimitationSettings, Key: "care_page.limitation_settings"},
+	{Module: CarePage, Bit: CarePageAIConfigurations, Key: "care_page.ai_configurations"},
+	{Module: CarePage, Bit: CarePageAIProductConfigurations, Key: "care_page.ai_product_configurations"},
+	{Module: BotManagement, Bit: BotManagementFetchMany, Key: "bot_management.fetch_many"},
+	{Module: BotManagement, Bit: BotManagementCreate, Key: "bot_management.create"},
+	{Module: BotManagement, Bit: BotManagementUpdate, Key: "bot_management.update"},
+	{Module: BotManagement, Bit: BotManagementCrawlBotList, Key: "bot_management.crawl_bot_list"},
+	{Module: BotManagement, Bit: BotManagementBotAdsManager, Key: "bot_management.bot_ads_manager"},
+	{Module: FanPages, Bit: FanPagesFetchMany, Key: "fan_pages.fetch_many"},
+	{Module: FanPages, Bit: FanPagesLink, Key: "fan_pages.link"},
+	{Module: Campaigns, Bit: CampaignsFetchMany, Key: "campaigns.fetch_many"},
+	{Module: Campaigns, Bit: CampaignsFetchOne, Key: "campaigns.fetch_one"},
+	{Module: Campaigns, Bit: CampaignsCreate, Key: "campaigns.create"},
+	{Module: Projects, Bit: ProjectsFetchMany, Key: "projects.fetch_many"},
+	{Module: Projects, Bit: ProjectsFetchOne, Key: "projects.fetch_one"},
+	{Module: Projects, Bit: ProjectsCreate, Key: "projects.create"},
+	{Module: Projects, Bit: ProjectsUpdate, Key: "projects.update"},
+	{Module: Projects, Bit: ProjectsUpdateStatus, Key: "projects.update_status"},
+	{Module: Projects, Bit: ProjectsFFMIntegrate, Key: "projects.ffm_integrate"},
+	{Module: Projects, Bit: ProjectsActionLogs, Key: "projects.action_logs"},
+	{Module: Countries, Bit: CountriesFetchMany, Key: "countries.fetch_many"},
+	{Module: Countries, Bit: CountriesCreate, Key: "countries.create"},
+	{Module: Countries, Bit: CountriesUpdateStatus, Key: "countries.update_status"},
+	{Module: Accounts, Bit: AccountsFetchMany, Key: "accounts.fetch_many"},
+	{Module: Accounts, Bit: AccountsFetchOne, Key: "accounts.fetch_one"},
+	{Module: Accounts, Bit: AccountsCreate, Key: "accounts.create"},
+	{Module: Accounts, Bit: AccountsUpdate, Key: "accounts.update"},
+	{Module: Accounts, Bit: AccountsUpdateStatus, Key: "accounts.update_status"},
+	{Module: Accounts, Bit: AccountsActionLogs, Key: "accounts.action_logs"},
+	{Module: Roles, Bit: RolesFetchMany, Key: "roles.fetch_many"},
+	{Module: Roles, Bit: RolesFetchOne, Key: "roles.fetch_one"},
+	{Module: Roles, Bit: RolesCreate, Key: "roles.create"},
+	{Module: Roles, Bit: RolesUpdate, Key: "roles.update"},
+	{Module: Roles, Bit: RolesUpdateStatus, Key: "roles.update_status"},
+	{Module: Roles, Bit: RolesActionLogs, Key: "roles.action_logs"},
+	{Module: Org, Bit: OrgFetch, Key: "org.fetch"},
+	{Module: Org, Bit: OrgUpdate, Key: "org.update"},
+	{Module: Shift, Bit: ShiftFetchMany, Key: "shift.fetch_many"},
+	{Module: Shift, Bit: ShiftFetchOne, Key: "shift.fetch_one"},
+	{Module: Shift, Bit: ShiftCreate, Key: "shift.create"},
+	{Module: Shift, Bit: ShiftUpdate, Key: "shift.update"},
+	{Module: Shift, Bit: ShiftSchedules, Key: "shift.schedules"},
+	{Module: Shift, Bit: ShiftAssign, Key: "shift.assign"},
+	{Module: Tags, Bit: TagsFetchMany, Key: "tags.fetch_many"},
+	{Module: Tags, Bit: TagsCreate, Key: "tags.create"},
+	{Module: Tags, Bit: TagsUpdate, Key: "tags.update"},
+	{Module: OrderSource, Bit: OrderSourceFetchMany, Key: "order_source.fetch_many"},
+	{Module: OrderSource, Bit: OrderSourceCreate, Key: "order_source.create"},
+	{Module: OrderSource, Bit: OrderSourceUpdate, Key: "order_source.update"},
+	{Module: ReportReason, Bit: ReportReasonFetchMany, Key: "report_reason.fetch_many"},
+	{Module: ReportReason, Bit: ReportReasonCreate, Key: "report_reason.create"},
+	{Module: ReportReason, Bit: ReportReasonUpdate, Key: "report_reason.update"},
+	{Module: CancelReason, Bit: CancelReasonFetchMany, Key: "cancel_reason.fetch_many"},
+	{Module: CancelReason, Bit: CancelReasonCreate, Key: "cancel_reason.create"},
+	{Module: CancelReason, Bit: CancelReasonUpdate, Key: "cancel_reason.update"},
+	{Module: PrintNotes, Bit: PrintNotesFetchMany, Key: "print_notes.fetch_many"},
+	{Module: PrintNotes, Bit: PrintNotesCreate, Key: "print_notes.create"},
+	{Module: PrintNotes, Bit: PrintNotesUpdate, Key: "print_notes.update"},
+	{Module: Translation, Bit: TranslationFetchMany, Key: "translation.fetch_many"},
+	{Module: Translation, Bit: TranslationUpdate, Key: "translation.update"},
+	{Module: Fulfillment, Bit: FulfillmentFetchMany, Key: "fulfillment.fetch_many"},
+	{Module: Fulfillment, Bit: FulfillmentFetchOne, Key: "fulfillment.fetch_one"},
+	{Module: Fulfillment, Bit: FulfillmentIntegrate, Key: "fulfillment.integrate"},
+	{Module: Fulfillment, Bit: FulfillmentDisintegrate, Key: "fulfillment.disintegrate"},
+	{Module: Marketplace, Bit: MarketplaceFetchMany, Key: "marketplace.fetch_many"},
+	{Module: Marketplace, Bit: MarketplaceUpdate, Key: "marketplace.update"},
+	{Module: Marketplace, Bit: MarketplaceCreate, Key: "marketplace.create"},
+	{Module: Currency, Bit: CurrencyFetchMany, Key: "currency.fetch_many"},
+	{Module: Currency, Bit: CurrencyUpdate, Key: "currency.update"},
+	{Module: Currency, Bit: CurrencyCreate, Key: "currency.create"},
+	{Module: DeviceManagement, Bit: DeviceManagementFetchMany, Key: "device_management.fetch_many"},
+	{Module: DeviceManagement, Bit: DeviceManagementCreate, Key: "device_management.create"},
+	{Module: AuditLogs, Bit: AuditLogsFetchMany, Key: "audit_logs.fetch_many"},
+}
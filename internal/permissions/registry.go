@@ -0,0 +1,146 @@
+package permissions
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+var ErrUnknownPermission = errors.New("unknown permission")
+
+// Definition is a permission bit of a module with its stable key, e.g. order.bulk_update_status.
+// Keys are generated from the constant names by `gcli gen permissions` (registry.gen.go), run it after adding permissions.
+type Definition struct {
+	Module Permission `json:"-"`
+	Bit    int64      `json:"bit"`
+	Key    string     `json:"key"`
+}
+
+// ModuleDefinition is a module with its permissions, a node of the permission tree of the role editor
+type ModuleDefinition struct {
+	ID          Permission   `json:"id"`
+	Key         string       `json:"key"`
+	Permissions []Definition `json:"permissions"`
+}
+
+var (
+	keyIndex = make(map[string]Definition)
+	bitIndex = make(map[Permission]map[int64]string)
+)
+
+func init() {
+	for _, definition := range definitions {
+		keyIndex[definition.Key] = definition
+		if bitIndex[definition.Module] == nil {
+			bitIndex[definition.Module] = make(map[int64]string)
+		}
+		bitIndex[definition.Module][definition.Bit] = definition.Key
+	}
+}
+
+// ModuleKey returns the key of the module, e.g. order
+func ModuleKey(module Permission) string {
+	return moduleKeys[module]
+}
+
+// Lookup returns the definition of a permission key
+func Lookup(key string) (Definition, bool) {
+	definition, ok := keyIndex[key]
+	return definition, ok
+}
+
+// Tree returns the modules with their permissions, ordered by module and bit
+func Tree() []ModuleDefinition {
+	byModule := make(map[Permission]*ModuleDefinition, len(moduleKeys))
+	for module, key := range moduleKeys {
+		byModule[module] = &ModuleDefinition{ID: module, Key: key, Permissions: []Definition{}}
+	}
+	for _, definition := range definitions {
+		module := byModule[definition.Module]
+		module.Permissions = append(module.Permissions, definition)
+	}
+
+	tree := make([]ModuleDefinition, 0, len(byModule))
+	for _, module := range byModule {
+		sort.Slice(module.Permissions, func(i, j int) bool { return module.Permissions[i].Bit < module.Permissions[j].Bit })
+		tree = append(tree, *module)
+	}
+	sort.Slice(tree, func(i, j int) bool { return tree[i].ID < tree[j].ID })
+	return tree
+}
+
+// Encode returns the keys of the bits set in the bitmasks (module => bits), unknown bits are left out
+func Encode(bitmasks map[int64]int64) []string {
+	keys := make([]string, 0)
+	for _, definition := range definitions {
+		if HasPermission(bitmasks[int64(definition.Module)], definition.Bit) {
+			keys = append(keys, definition.Key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Decode returns the bitmasks (module => bits) of the keys
+func Decode(keys []string) (map[int64]int64, error) {
+	bitmasks := make(map[int64]int64)
+	for _, key := range keys {
+		definition, ok := keyIndex[key]
+		if !ok {
+			return nil, fmt.Errorf("%w %s", ErrUnknownPermission, key)
+		}
+		bitmasks[int64(definition.Module)] |= definition.Bit
+	}
+	return bitmasks, nil
+}
+
+// ValidateBitmasks rejects the modules and bits of the bitmasks (e.g. of a role) missing in the registry
+func ValidateBitmasks(bitmasks map[int64]int64) error {
+	known := make(map[int64]int64)
+	for _, definition := range definitions {
+		known[int64(definition.Module)] |= definition.Bit
+	}
+
+	for module, bitmask := range bitmasks {
+		if unknown := bitmask &^ known[module]; unknown != 0 {
+			return fmt.Errorf("%w: module %d bits %b", ErrUnknownPermission, module, unknown)
+		}
+	}
+	return nil
+}
+
+// Validate checks the definitions: every permission is a single bit, unique within its module and listed in
+// ModuleRelations, and keys are unique
+func Validate() error {
+	keys := make(map[string]bool, len(definitions))
+	moduleBits := make(map[Permission]int64)
+	for _, definition := range definitions {
+		if _, ok := moduleKeys[definition.Module]; !ok {
+			return fmt.Errorf("permission %s: unknown module %d", definition.Key, definition.Module)
+		}
+		if definition.Bit <= 0 || bits.OnesCount64(uint64(definition.Bit)) != 1 {
+			return fmt.Errorf("permission %s: %b is not a single bit", definition.Key, definition.Bit)
+		}
+		if moduleBits[definition.Module]&definition.Bit != 0 {
+			return fmt.Errorf("permission %s: bit %d is already used in module %s", definition.Key,
+				bits.TrailingZeros64(uint64(definition.Bit)), moduleKeys[definition.Module])
+		}
+		if keys[definition.Key] {
+			return fmt.Errorf("permission %s: duplicated key", definition.Key)
+		}
+		moduleBits[definition.Module] |= definition.Bit
+		keys[definition.Key] = true
+	}
+
+	for module, relations := range ModuleRelations {
+		var related int64
+		for _, bit := range relations {
+			related |= int64(bit)
+		}
+		if related != moduleBits[module] {
+			return fmt.Errorf("module %s: ModuleRelations %b do not match the permissions %b", moduleKeys[module], related, moduleBits[module])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package permissions
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nhdms/base-go/pkg/common"
+)
+
+func TestValidate(t *testing.T) {
+	if err := Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	bitmasks := map[int64]int64{
+		int64(Order):    OrderBulkUpdateStatus | OrderFetchMany,
+		int64(CarePage): CarePageCreateOrder,
+	}
+
+	keys := Encode(bitmasks)
+	expected := []string{"care_page.create_order", "order.bulk_update_status", "order.fetch_many"}
+	if len(keys) != len(expected) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Fatalf("unexpected keys %v", keys)
+		}
+	}
+
+	decoded, err := Decode(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || decoded[int64(Order)] != bitmasks[int64(Order)] || decoded[int64(CarePage)] != CarePageCreateOrder {
+		t.Fatalf("unexpected bitmasks %v", decoded)
+	}
+
+	if _, err = Decode([]string{"order.fly"}); !errors.Is(err, ErrUnknownPermission) {
+		t.Fatalf("expected unknown permission, got %v", err)
+	}
+	if err = ValidateBitmasks(map[int64]int64{int64(Org): 1 << 5}); !errors.Is(err, ErrUnknownPermission) {
+		t.Fatalf("expected unknown bit, got %v", err)
+	}
+}
+
+func TestRequirement(t *testing.T) {
+	bitmasks := make([]int64, Order+1)
+	bitmasks[Order] = OrderFetchMany | OrderUpdateStatus
+
+	granted := All(
+		Require(Order, OrderFetchMany),
+		Any(Require(Order, OrderBulkUpdateStatus), Require(Order, OrderUpdateStatus)),
+	)
+	if err := Check(granted, bitmasks); err != nil {
+		t.Fatal(err)
+	}
+
+	denied := All(Require(Order, OrderFetchMany), Require(Order, OrderCancel), Require(Roles, RolesFetchMany))
+	missing := Missing(denied, bitmasks)
+	if len(missing) != 2 || missing[0] != "order.cancel" || missing[1] != "roles.fetch_many" {
+		t.Fatalf("unexpected missing permissions %v", missing)
+	}
+	if err := Check(denied, bitmasks); !common.IsPermissionDeniedError(err) {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+}
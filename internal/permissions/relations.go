@@ -243,4 +243,7 @@ var ModuleRelations = map[Permission][]Permission{
 		DeviceManagementFetchMany,
 		DeviceManagementCreate,
 	},
+	AuditLogs: {
+		AuditLogsFetchMany,
+	},
 }
@@ -0,0 +1,103 @@
+package permissions
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/goccy/go-json"
+	"github.com/nhdms/base-go/pkg/common"
+	"go-micro.dev/v5/server"
+	"google.golang.org/grpc/metadata"
+)
+
+// Require is the requirement of a permission of a module, e.g. Require(Order, OrderBulkUpdateStatus).
+// It panics on a bit missing in the registry, requirements are declared on startup.
+func Require(module Permission, bit int64) common.PermissionRequirement {
+	key, ok := bitIndex[module][bit]
+	if !ok {
+		panic(fmt.Sprintf("permission %d of module %d is not in the registry, run gcli gen permissions", bit, module))
+	}
+	return common.PermissionRequirement{Key: key}
+}
+
+// All is granted when every requirement is granted
+func All(requirements ...common.PermissionRequirement) common.PermissionRequirement {
+	return common.PermissionRequirement{All: requirements}
+}
+
+// Any is granted when at least one requirement is granted
+func Any(requirements ...common.PermissionRequirement) common.PermissionRequirement {
+	return common.PermissionRequirement{Any: requirements}
+}
+
+// Missing returns the keys missing to grant the requirement with the bitmasks of a claim (indexed by module),
+// empty when it is granted. An unknown key is missing.
+func Missing(requirement common.PermissionRequirement, bitmasks []int64) []string {
+	switch {
+	case len(requirement.Key) > 0:
+		definition, ok := keyIndex[requirement.Key]
+		if !ok || int(definition.Module) >= len(bitmasks) || !HasPermission(bitmasks[definition.Module], definition.Bit) {
+			return []string{requirement.Key}
+		}
+		return nil
+	case len(requirement.Any) > 0:
+		var missing []string
+		for _, r := range requirement.Any {
+			m := Missing(r, bitmasks)
+			if len(m) == 0 {
+				return nil
+			}
+			missing = append(missing, m...)
+		}
+		return missing
+	default:
+		var missing []string
+		for _, r := range requirement.All {
+			missing = append(missing, Missing(r, bitmasks)...)
+		}
+		return missing
+	}
+}
+
+// Check returns a *common.MissingPermissionError when the requirement is not granted
+func Check(requirement common.PermissionRequirement, bitmasks []int64) error {
+	if missing := Missing(requirement, bitmasks); len(missing) > 0 {
+		return &common.MissingPermissionError{Missing: missing}
+	}
+	return nil
+}
+
+// CheckContext checks the requirement with the permissions of the caller, forwarded by the gateway in the
+// X-AT-Permissions metadata of a gRPC request
+func CheckContext(ctx context.Context, requirement common.PermissionRequirement) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	// services have no user
+	if len(md.Get(common.HeaderUserId)) == 0 && len(md.Get(common.HeaderPrincipalType)) == 0 {
+		return common.UnauthorizedError
+	}
+
+	var bitmasks []int64
+	if values := md.Get(common.HeaderPermissions); len(values) > 0 {
+		_ = json.Unmarshal([]byte(values[0]), &bitmasks)
+	}
+	return Check(requirement, bitmasks)
+}
+
+// NewHandlerWrapper enforces the requirements of gRPC endpoints (e.g. "UserService.GetUserClaims") with the
+// permissions of the caller, other endpoints are not checked:
+//
+//	svc.Init(micro.WrapHandler(permissions.NewHandlerWrapper(map[string]common.PermissionRequirement{
+//		"OrderService.BulkUpdateStatus": permissions.Require(permissions.Order, permissions.OrderBulkUpdateStatus),
+//	})))
+func NewHandlerWrapper(requirements map[string]common.PermissionRequirement) server.HandlerWrapper {
+	return func(next server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			if requirement, ok := requirements[req.Endpoint()]; ok {
+				if err := CheckContext(ctx, requirement); err != nil {
+					return err
+				}
+			}
+			return next(ctx, req, rsp)
+		}
+	}
+}
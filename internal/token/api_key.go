@@ -0,0 +1,118 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/goccy/go-json"
+	"github.com/nhdms/base-go/pkg/common"
+	"github.com/nhdms/base-go/pkg/config"
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+	"github.com/nhdms/base-go/proto/exmsg/services"
+	"github.com/spf13/cast"
+)
+
+const (
+	APIKeyPrefix       = "ak_"
+	apiKeyDisplayChars = 8
+)
+
+var ErrInvalidAPIKey = fmt.Errorf("%w: invalid api key", common.UnauthorizedError)
+
+// GenerateAPIKey returns a new api key with its hash (stored in api_keys.key_hash) and its prefix (api_keys.key_prefix).
+// Only the hash is stored, the key is shown once to its owner.
+func GenerateAPIKey() (key, hash, prefix string, err error) {
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, HashAPIKey(key), key[:len(APIKeyPrefix)+apiKeyDisplayChars], nil
+}
+
+// HashAPIKey returns the sha256 hex of the key, the api keys are looked up by hash
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetAPIKeyPrincipal verifies the api key with the user service. The key acts as its owner, limited to its scopes:
+// its permissions are the scopes granted to the owner. Principals are cached for jwt.api_key_cache_ttl, a revoked
+// key is accepted until then.
+func (p *TokenProcessor) GetAPIKeyPrincipal(ctx context.Context, key string) (*Principal, error) {
+	if len(key) == 0 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	hash := HashAPIKey(key)
+	if p.rd != nil {
+		cached, err := p.rd.Get(ctx, p.apiKeyKey(hash)).Bytes()
+		if err == nil {
+			principal := &Principal{}
+			if err = json.Unmarshal(cached, principal); err == nil {
+				return principal, nil
+			}
+		} else if !errors.Is(err, redis.Nil) {
+			logger.DefaultLogger.Warnw("Failed to get cached api key", "error", err)
+		}
+	}
+
+	apiKey, err := p.userService.GetAPIKey(ctx, &services.APIKeyRequest{KeyHash: hash})
+	if err != nil {
+		if common.IsNotFoundError(err) {
+			return nil, ErrInvalidAPIKey
+		}
+		logger.DefaultLogger.Errorw("Failed to get api key", "error", err)
+		return nil, err
+	}
+
+	claim, err := p.loadUserClaim(ctx, &models.User{Id: apiKey.UserId})
+	if err != nil {
+		return nil, err
+	}
+
+	principal := &Principal{
+		Type:        PrincipalAPIKey,
+		ID:          cast.ToString(apiKey.Id),
+		UserID:      apiKey.UserId,
+		SubUserIDs:  claim.SubUserIds,
+		DataSets:    claim.DataSets,
+		Permissions: intersectPermissions(claim.Permissions, scopePermissions(apiKey.Scopes)),
+	}
+
+	if p.rd != nil {
+		ttl := config.ViperGetDurationWithDefault("jwt.api_key_cache_ttl", time.Minute)
+		if apiKey.ExpiresAt > 0 {
+			if untilExpiry := time.Until(time.Unix(apiKey.ExpiresAt, 0)); untilExpiry < ttl {
+				ttl = untilExpiry
+			}
+		}
+		if ttl > 0 {
+			principalBytes, _ := json.Marshal(principal)
+			if err = p.rd.Set(ctx, p.apiKeyKey(hash), principalBytes, ttl).Err(); err != nil {
+				logger.DefaultLogger.Warnw("Failed to cache api key", "api_key_id", apiKey.Id, "error", err)
+			}
+		}
+	}
+	return principal, nil
+}
+
+// InvalidateAPIKey removes the cached principal of the key hash, call it when the key is revoked or its scopes change
+func (p *TokenProcessor) InvalidateAPIKey(ctx context.Context, hash string) error {
+	if p.rd == nil {
+		return nil
+	}
+	return p.rd.Del(ctx, p.apiKeyKey(hash)).Err()
+}
+
+func (p *TokenProcessor) apiKeyKey(hash string) string {
+	return p.redisPrefix + "api_key:" + hash
+}
@@ -0,0 +1,146 @@
+package token
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+	"github.com/nhdms/base-go/proto/exmsg/services"
+	"google.golang.org/protobuf/proto"
+)
+
+// loadUserClaim builds the JWTClaim of the user with the permissions, data sets and sub users of the user service
+func (p *TokenProcessor) loadUserClaim(ctx context.Context, user *models.User) (*models.JWTClaim, error) {
+	resp, err := p.userService.GetUserClaims(ctx, &services.UserRequest{UserId: user.Id})
+	if err != nil {
+		logger.DefaultLogger.Errorw("Failed to get user claims", "user_id", user.Id, "error", err)
+		return nil, err
+	}
+
+	claim := &models.JWTClaim{
+		UserId:      user.Id,
+		Permissions: resp.GetPermissions(),
+		DataSets:    resp.GetDataSets(),
+		SubUserIds:  resp.GetSubUserIds(),
+		Signature:   user.GetSessionId(), // using session_id as signature, todo using other fields
+	}
+	compactClaim(claim)
+	return claim, nil
+}
+
+// compactClaim removes what does not change the claim: trailing modules without permission, duplicated data sets and
+// sub users. Sorted ids encode to the same bytes for the same claim.
+func compactClaim(claim *models.JWTClaim) {
+	last := len(claim.Permissions)
+	for last > 0 && claim.Permissions[last-1] == 0 {
+		last--
+	}
+	claim.Permissions = claim.Permissions[:last]
+
+	sort.Slice(claim.SubUserIds, func(i, j int) bool { return claim.SubUserIds[i] < claim.SubUserIds[j] })
+	subUserIds := claim.SubUserIds[:0]
+	for i, id := range claim.SubUserIds {
+		if i == 0 || id != claim.SubUserIds[i-1] {
+			subUserIds = append(subUserIds, id)
+		}
+	}
+	claim.SubUserIds = subUserIds
+
+	seen := make(map[[2]int64]bool, len(claim.DataSets))
+	dataSets := claim.DataSets[:0]
+	for _, dataSet := range claim.DataSets {
+		key := [2]int64{dataSet.GetProjectId(), dataSet.GetCountryId()}
+		if !seen[key] {
+			seen[key] = true
+			dataSets = append(dataSets, dataSet)
+		}
+	}
+	claim.DataSets = dataSets
+}
+
+// encodeClaim sets the user info of the token: claims above jwt.compress_claim_bytes are deflated, claims still above
+// jwt.max_claim_bytes are kept in redis until the token expires and the token only carries the user id and signature
+func (p *TokenProcessor) encodeClaim(ctx context.Context, rawClaim *Claim, claim *models.JWTClaim, tokenID string, exp time.Duration) error {
+	userInfo, err := proto.Marshal(claim)
+	if err != nil {
+		return err
+	}
+
+	rawClaim.UserInfo = userInfo
+	if len(userInfo) <= p.compressClaimBytes {
+		return nil
+	}
+
+	compressed, err := deflate(userInfo)
+	if err != nil {
+		return err
+	}
+	rawClaim.UserInfo, rawClaim.Compressed = compressed, true
+	if len(compressed) <= p.maxClaimBytes {
+		return nil
+	}
+
+	if p.rd == nil {
+		logger.DefaultLogger.Warnw("Large token claim, configure redis to store it", "user_id", claim.UserId, "size", len(compressed))
+		return nil
+	}
+	if err = p.rd.Set(ctx, p.claimKey(tokenID), userInfo, exp).Err(); err != nil {
+		return err
+	}
+
+	rawClaim.UserInfo, _ = proto.Marshal(&models.JWTClaim{UserId: claim.UserId, Signature: claim.Signature})
+	rawClaim.Compressed, rawClaim.Stored = false, true
+	return nil
+}
+
+// decodeClaim restores the full user info of a compressed or stored claim
+func (p *TokenProcessor) decodeClaim(ctx context.Context, rawClaim *Claim, tokenID string) error {
+	if rawClaim.Stored {
+		if p.rd == nil {
+			return errRedisRequired
+		}
+		userInfo, err := p.rd.Get(ctx, p.claimKey(tokenID)).Bytes()
+		if err == redis.Nil {
+			return ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+		rawClaim.UserInfo, rawClaim.Stored = userInfo, false
+	}
+
+	if rawClaim.Compressed {
+		userInfo, err := io.ReadAll(flate.NewReader(bytes.NewReader(rawClaim.UserInfo)))
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+		rawClaim.UserInfo, rawClaim.Compressed = userInfo, false
+	}
+	return nil
+}
+
+func deflate(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w, err := flate.NewWriter(buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *TokenProcessor) claimKey(tokenID string) string {
+	return p.redisPrefix + "claim:" + tokenID
+}
@@ -0,0 +1,347 @@
+package token
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/goccy/go-json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nhdms/base-go/pkg/logger"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+	AlgHS256 = "HS256"
+
+	// jwksRefreshInterval limits the JWKS downloads triggered by unknown kids
+	jwksRefreshInterval = time.Minute
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeyConfig is a key of jwt.keys, keys without private key only verify tokens (e.g. a rotated out key)
+type KeyConfig struct {
+	Kid            string `mapstructure:"kid"`
+	Alg            string `mapstructure:"alg"`
+	PrivateKey     string `mapstructure:"private_key"` // PEM
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	PublicKey      string `mapstructure:"public_key"` // PEM
+	PublicKeyFile  string `mapstructure:"public_key_file"`
+	Secret         string `mapstructure:"secret"` // HS256 only, it is not published in the JWKS
+}
+
+// KeysConfig is read from the jwt config. Tokens are signed by the key SigningKid, every key of Keys verifies tokens
+// with its kid. Verifiers without private keys can load the public keys from the JWKS of JWKSURL.
+// Rotation: add the new key, switch signing_kid, and remove the old key once its tokens expired.
+type KeysConfig struct {
+	SigningKid string      `mapstructure:"signing_kid"`
+	Keys       []KeyConfig `mapstructure:"keys"`
+	JWKSURL    string      `mapstructure:"jwks_url"`
+}
+
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+// KeySet signs and verifies tokens by kid, the algorithm of a token must be the one of its key
+type KeySet struct {
+	m       sync.RWMutex
+	keys    map[string]*signingKey
+	signing *signingKey
+
+	jwksURL     string
+	jwksFetched time.Time
+}
+
+// NewKeySet loads the keys of conf, legacySecret (jwt.secret) verifies the HS256 tokens without kid and signs
+// tokens when no signing key is configured
+func NewKeySet(conf KeysConfig, legacySecret []byte) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*signingKey), jwksURL: conf.JWKSURL}
+	if len(legacySecret) > 0 {
+		ks.keys[""] = &signingKey{method: jwt.SigningMethodHS256, private: legacySecret, public: legacySecret}
+	}
+
+	for _, keyConf := range conf.Keys {
+		key, err := parseKey(keyConf)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwt key %s: %w", keyConf.Kid, err)
+		}
+		ks.keys[key.kid] = key
+	}
+
+	if len(conf.JWKSURL) > 0 {
+		if err := ks.fetchJWKS(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	ks.signing = ks.keys[conf.SigningKid]
+	if len(conf.SigningKid) > 0 && (ks.signing == nil || ks.signing.private == nil) {
+		return nil, fmt.Errorf("signing key %s has no private key", conf.SigningKid)
+	}
+	return ks, nil
+}
+
+func parseKey(conf KeyConfig) (*signingKey, error) {
+	if len(conf.Kid) == 0 {
+		return nil, fmt.Errorf("kid is required")
+	}
+
+	privatePEM, err := readPEM(conf.PrivateKey, conf.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	publicPEM, err := readPEM(conf.PublicKey, conf.PublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{kid: conf.Kid}
+	switch conf.Alg {
+	case AlgRS256:
+		key.method = jwt.SigningMethodRS256
+		if len(privatePEM) > 0 {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+			if err != nil {
+				return nil, err
+			}
+			key.private, key.public = private, &private.PublicKey
+		} else if len(publicPEM) > 0 {
+			if key.public, err = jwt.ParseRSAPublicKeyFromPEM(publicPEM); err != nil {
+				return nil, err
+			}
+		}
+	case AlgEdDSA:
+		key.method = jwt.SigningMethodEdDSA
+		if len(privatePEM) > 0 {
+			private, err := jwt.ParseEdPrivateKeyFromPEM(privatePEM)
+			if err != nil {
+				return nil, err
+			}
+			key.private, key.public = private, private.(ed25519.PrivateKey).Public()
+		} else if len(publicPEM) > 0 {
+			if key.public, err = jwt.ParseEdPublicKeyFromPEM(publicPEM); err != nil {
+				return nil, err
+			}
+		}
+	case AlgHS256:
+		key.method = jwt.SigningMethodHS256
+		if len(conf.Secret) > 0 {
+			key.private, key.public = []byte(conf.Secret), []byte(conf.Secret)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alg %s, supported are %s, %s and %s", conf.Alg, AlgRS256, AlgEdDSA, AlgHS256)
+	}
+
+	if key.public == nil {
+		return nil, fmt.Errorf("key has no private key, public key or secret")
+	}
+	return key, nil
+}
+
+func readPEM(value, file string) ([]byte, error) {
+	if len(value) > 0 {
+		return []byte(value), nil
+	}
+	if len(file) > 0 {
+		return os.ReadFile(file)
+	}
+	return nil, nil
+}
+
+// Sign signs the claims with the signing key, the kid is set in the header
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	k.m.RLock()
+	key := k.signing
+	k.m.RUnlock()
+	if key == nil || key.private == nil {
+		return "", fmt.Errorf("no jwt signing key, set jwt.signing_kid or jwt.secret")
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	if len(key.kid) > 0 {
+		token.Header["kid"] = key.kid
+	}
+	return token.SignedString(key.private)
+}
+
+// Keyfunc returns the verifying key of the kid of the token, it rejects an algorithm other than the one of the key
+func (k *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := k.getKey(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected alg %s of key %s", token.Method.Alg(), kid)
+	}
+	return key.public, nil
+}
+
+// ValidMethods are the algorithms of the keys, other ones are rejected before Keyfunc
+func (k *KeySet) ValidMethods() []string {
+	k.m.RLock()
+	defer k.m.RUnlock()
+
+	seen := make(map[string]bool)
+	var methods []string
+	for _, key := range k.keys {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+func (k *KeySet) getKey(kid string) (*signingKey, error) {
+	k.m.RLock()
+	key, ok := k.keys[kid]
+	canFetch := len(k.jwksURL) > 0 && time.Since(k.jwksFetched) > jwksRefreshInterval
+	k.m.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	// the key may be new, a rotation publishes it in the JWKS before signing with it
+	if canFetch && len(kid) > 0 {
+		if err := k.fetchJWKS(context.Background()); err != nil {
+			logger.DefaultLogger.Errorw("Failed to refresh JWKS", "url", k.jwksURL, "error", err)
+		}
+
+		k.m.RLock()
+		key, ok = k.keys[kid]
+		k.m.RUnlock()
+		if ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %s", ErrUnknownKey, kid)
+}
+
+// JWK is a public key of the JWKS (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys, HS256 keys are secret and not included
+func (k *KeySet) JWKS() *JWKS {
+	k.m.RLock()
+	defer k.m.RUnlock()
+
+	jwks := &JWKS{Keys: []JWK{}}
+	for kid, key := range k.keys {
+		jwk := JWK{Kid: kid, Alg: key.method.Alg(), Use: "sig"}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+// fetchJWKS adds the keys of the JWKS of jwksURL, configured keys with the same kid are replaced
+func (k *KeySet) fetchJWKS(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	k.m.Lock()
+	k.jwksFetched = time.Now()
+	k.m.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.jwksURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get JWKS: status %d", resp.StatusCode)
+	}
+
+	jwks := &JWKS{}
+	if err = json.NewDecoder(resp.Body).Decode(jwks); err != nil {
+		return fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]*signingKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		key, err := parseJWK(jwk)
+		if err != nil {
+			logger.DefaultLogger.Warnw("Skip invalid JWK", "kid", jwk.Kid, "error", err)
+			continue
+		}
+		keys[key.kid] = key
+	}
+
+	k.m.Lock()
+	defer k.m.Unlock()
+	for kid, key := range keys {
+		k.keys[kid] = key
+	}
+	return nil
+}
+
+func parseJWK(jwk JWK) (*signingKey, error) {
+	if len(jwk.Kid) == 0 {
+		return nil, fmt.Errorf("kid is required")
+	}
+
+	switch {
+	case jwk.Kty == "RSA" && jwk.Alg == AlgRS256:
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return &signingKey{kid: jwk.Kid, method: jwt.SigningMethodRS256, public: public}, nil
+	case jwk.Kty == "OKP" && jwk.Crv == "Ed25519" && jwk.Alg == AlgEdDSA:
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return &signingKey{kid: jwk.Kid, method: jwt.SigningMethodEdDSA, public: ed25519.PublicKey(x)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key %s %s", jwk.Kty, jwk.Alg)
+}
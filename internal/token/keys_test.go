@@ -0,0 +1,89 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func pemKey(t *testing.T, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func TestKeySet(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	ks, err := NewKeySet(KeysConfig{
+		SigningKid: "ed-2",
+		Keys: []KeyConfig{
+			{Kid: "rsa-1", Alg: AlgRS256, PrivateKey: pemKey(t, rsaKey)},
+			{Kid: "ed-2", Alg: AlgEdDSA, PrivateKey: pemKey(t, edKey)},
+		},
+	}, []byte("legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parse := func(ks *KeySet, tokenString string) error {
+		_, err := jwt.Parse(tokenString, ks.Keyfunc, jwt.WithValidMethods(ks.ValidMethods()))
+		return err
+	}
+
+	signed, err := ks.Sign(jwt.MapClaims{"sub": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = parse(ks, signed); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rotated out key still verifies its tokens
+	old := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "1"})
+	old.Header["kid"] = "rsa-1"
+	oldSigned, _ := old.SignedString(rsaKey)
+	if err = parse(ks, oldSigned); err != nil {
+		t.Fatal(err)
+	}
+
+	// a token of another algorithm than its key is rejected, e.g. HS256 signed with the public key
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1"})
+	forged.Header["kid"] = "rsa-1"
+	forgedSigned, _ := forged.SignedString([]byte("legacy"))
+	if err = parse(ks, forgedSigned); err == nil {
+		t.Fatal("expected error for algorithm of another key")
+	}
+
+	// verifiers only need the public keys of the JWKS
+	jwks := ks.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected 2 public keys, got %+v", jwks.Keys)
+	}
+
+	verifier := &KeySet{keys: make(map[string]*signingKey)}
+	for _, jwk := range jwks.Keys {
+		key, err := parseJWK(jwk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifier.keys[key.kid] = key
+	}
+	if err = parse(verifier, signed); err != nil {
+		t.Fatal(err)
+	}
+	if err = parse(verifier, oldSigned); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = verifier.Sign(jwt.MapClaims{}); err == nil {
+		t.Fatal("expected error without signing key")
+	}
+}
@@ -0,0 +1,118 @@
+package token
+
+import (
+	"github.com/nhdms/base-go/internal/permissions"
+	"github.com/nhdms/base-go/pkg/common"
+	"github.com/nhdms/base-go/pkg/utils"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+	"github.com/spf13/cast"
+)
+
+const (
+	PrincipalUser    = "user"
+	PrincipalAPIKey  = "api_key"
+	PrincipalService = "service"
+)
+
+// Principal is the caller of a request whatever its credential (user token, api key or service token),
+// forwarded to the services in the X-AT-* headers
+type Principal struct {
+	Type string `json:"type"` // PrincipalUser, PrincipalAPIKey or PrincipalService
+	ID   string `json:"id"`   // user id, api key id or service name
+	// UserID is the user of a user token or the owner of an api key, 0 for a service
+	UserID      int64                `json:"user_id"`
+	SubUserIDs  []int64              `json:"sub_user_ids"`
+	DataSets    []*models.JWTDataSet `json:"data_sets"`
+	Permissions []int64              `json:"permissions"` // permission bitmask of each permissions.Permission module
+}
+
+// PrincipalFromToken returns the principal of a user token
+func PrincipalFromToken(token *Token) *Principal {
+	claim := GetJWTClaimFromToken(token)
+	return &Principal{
+		Type:        PrincipalUser,
+		ID:          cast.ToString(claim.UserId),
+		UserID:      claim.UserId,
+		SubUserIDs:  claim.SubUserIds,
+		DataSets:    claim.DataSets,
+		Permissions: claim.Permissions,
+	}
+}
+
+// Metadata returns the X-AT-* headers of the principal, the user headers are only set for a user
+func (pr *Principal) Metadata() map[string]string {
+	metadata := make(map[string]string)
+	if len(pr.Type) == 0 {
+		return metadata
+	}
+
+	for _, header := range common.ExtraDataHeaders {
+		switch header {
+		case common.HeaderPrincipalType:
+			metadata[header] = pr.Type
+		case common.HeaderPrincipalId:
+			metadata[header] = pr.ID
+		case common.HeaderPermissions:
+			metadata[header] = utils.ToJSONString(pr.Permissions)
+		}
+		if pr.UserID < 1 {
+			continue
+		}
+		switch header {
+		case common.HeaderUserId:
+			metadata[header] = cast.ToString(pr.UserID)
+		case common.HeaderChildUserIds:
+			metadata[header] = utils.ToJSONString(pr.SubUserIDs)
+		case common.HeaderDataSets:
+			metadata[header] = utils.ToJSONString(pr.DataSets)
+		}
+	}
+	return metadata
+}
+
+// CheckPermissions is true when the principal has one of the bits of every module of requirePermissions (module => bits)
+func (pr *Principal) CheckPermissions(requirePermissions map[int64]int64) bool {
+	for module, bits := range requirePermissions {
+		// trailing modules without permission are not in the claim
+		if module < 0 || module >= int64(len(pr.Permissions)) {
+			return false
+		}
+		if !permissions.HasPermission(pr.Permissions[module], bits) {
+			return false
+		}
+	}
+	return true
+}
+
+// MissingPermissions returns the permission keys missing to grant the requirement, empty when it is granted
+func (pr *Principal) MissingPermissions(requirement common.PermissionRequirement) []string {
+	return permissions.Missing(requirement, pr.Permissions)
+}
+
+// scopePermissions returns the bitmasks (indexed by module) of the permission keys, unknown keys are left out
+func scopePermissions(scopes []string) []int64 {
+	var bitmasks []int64
+	for _, scope := range scopes {
+		definition, ok := permissions.Lookup(scope)
+		if !ok {
+			continue
+		}
+		for int(definition.Module) >= len(bitmasks) {
+			bitmasks = append(bitmasks, 0)
+		}
+		bitmasks[definition.Module] |= definition.Bit
+	}
+	return bitmasks
+}
+
+// intersectPermissions returns the bits set in both bitmasks
+func intersectPermissions(a, b []int64) []int64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	intersection := make([]int64, len(a))
+	for module := range a {
+		intersection[module] = a[module] & b[module]
+	}
+	return intersection
+}
@@ -0,0 +1,303 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	"github.com/nhdms/base-go/pkg/common"
+	"github.com/nhdms/base-go/pkg/config"
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+	"github.com/nhdms/base-go/proto/exmsg/services"
+	"sort"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = fmt.Errorf("%w: invalid refresh token", common.UnauthorizedError)
+	ErrRefreshTokenReused  = fmt.Errorf("%w: refresh token reused", common.UnauthorizedError)
+	ErrSessionNotFound     = errors.New("session not found")
+)
+
+// revokeSessionScript removes the session from the sessions of the user (KEYS[1]) and revokes its access tokens
+// (KEYS[2] for ARGV[2] ms) only if the user had the session, so a user can not revoke the sessions of other users
+var revokeSessionScript = redis.NewScript(`
+if redis.call("HDEL", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("SET", KEYS[2], 1, "PX", ARGV[2])
+return 1
+`)
+
+// TokenPair is a short lived access token (jwt.access_exp) with the opaque refresh token (jwt.refresh_exp) renewing it
+type TokenPair struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+	SessionID        string `json:"session_id"`
+}
+
+// DeviceInfo identifies the device of a session, a new session of the same DeviceID replaces the previous one
+type DeviceInfo struct {
+	DeviceID   string `json:"device_id"`
+	DeviceName string `json:"device_name"`
+	UserAgent  string `json:"user_agent"`
+	IP         string `json:"ip"`
+}
+
+// Session is the family of the refresh tokens rotated from one login on a device
+type Session struct {
+	ID     string `json:"id"`
+	UserID int64  `json:"user_id"`
+	DeviceInfo
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type refreshRecord struct {
+	UserID    int64  `json:"user_id"`
+	SessionID string `json:"session_id"`
+}
+
+// IssueTokens starts a session of the user on the device and issues its first token pair
+func (p *TokenProcessor) IssueTokens(ctx context.Context, user *models.User, device DeviceInfo) (*TokenPair, error) {
+	if p.rd == nil {
+		return nil, errRedisRequired
+	}
+
+	if len(device.DeviceID) > 0 {
+		sessions, err := p.ListSessions(ctx, user.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, session := range sessions {
+			if session.DeviceID == device.DeviceID {
+				if err = p.RevokeSession(ctx, user.Id, session.ID); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	now := time.Now()
+	session := &Session{ID: uuid.NewString(), UserID: user.Id, DeviceInfo: device, CreatedAt: now}
+	return p.issueTokenPair(ctx, user, session)
+}
+
+// RefreshTokens rotates the refresh token: it is used once and replaced by a new pair of the same session.
+// A used refresh token presented again was stolen or leaked, the whole session is revoked.
+func (p *TokenProcessor) RefreshTokens(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	if p.rd == nil {
+		return nil, errRedisRequired
+	}
+
+	record, ttl, err := p.getRefreshRecord(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// the first use wins, concurrent refreshes with the same token are reuses
+	first, err := p.rd.SetNX(ctx, p.refreshUsedKey(refreshToken), 1, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !first {
+		logger.DefaultLogger.Warnw("Refresh token reused, session is revoked", "user_id", record.UserID, "session_id", record.SessionID)
+		if err = p.RevokeSession(ctx, record.UserID, record.SessionID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	session, err := p.getSession(ctx, record.UserID, record.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.userService.GetUserByID(ctx, &services.UserRequest{UserId: record.UserID})
+	if err != nil {
+		if common.IsNotFoundError(err) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	return p.issueTokenPair(ctx, resp.GetUser(), session)
+}
+
+// RevokeRefreshToken revokes the session of the refresh token, e.g. on logout of the device
+func (p *TokenProcessor) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	if p.rd == nil {
+		return errRedisRequired
+	}
+
+	record, _, err := p.getRefreshRecord(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	return p.RevokeSession(ctx, record.UserID, record.SessionID)
+}
+
+// ListSessions returns the active sessions of the user, most recently used first
+func (p *TokenProcessor) ListSessions(ctx context.Context, userID int64) ([]*Session, error) {
+	if p.rd == nil {
+		return nil, errRedisRequired
+	}
+
+	values, err := p.rd.HGetAll(ctx, p.sessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sessions := make([]*Session, 0, len(values))
+	var expired []string
+	for id, value := range values {
+		session := &Session{}
+		if err = json.Unmarshal([]byte(value), session); err != nil || session.ExpiresAt.Before(now) {
+			expired = append(expired, id)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	if len(expired) > 0 {
+		p.rd.HDel(ctx, p.sessionsKey(userID), expired...)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+// RevokeSession removes the session, its refresh tokens are rejected and its access tokens are revoked.
+// It returns ErrSessionNotFound if the session is not a session of userID.
+func (p *TokenProcessor) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	if p.rd == nil {
+		return errRedisRequired
+	}
+
+	// access tokens of the session expire after jwt.access_exp
+	removed, err := revokeSessionScript.Run(ctx, p.rd, []string{p.sessionsKey(userID), p.revokedSessionKey(sessionID)},
+		sessionID, p.accessExp().Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (p *TokenProcessor) issueTokenPair(ctx context.Context, user *models.User, session *Session) (*TokenPair, error) {
+	accessExp, refreshExp := p.accessExp(), p.refreshExp()
+	accessToken, err := p.generateAccessToken(ctx, user, accessExp, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, err
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now()
+	session.LastUsedAt = now
+	session.ExpiresAt = now.Add(refreshExp)
+	sessionBytes, _ := json.Marshal(session)
+	recordBytes, _ := json.Marshal(refreshRecord{UserID: user.Id, SessionID: session.ID})
+
+	pipe := p.rd.TxPipeline()
+	pipe.Set(ctx, p.refreshKey(refreshToken), recordBytes, refreshExp)
+	pipe.HSet(ctx, p.sessionsKey(user.Id), session.ID, sessionBytes)
+	pipe.Expire(ctx, p.sessionsKey(user.Id), refreshExp)
+	if _, err = pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(accessExp.Seconds()),
+		RefreshExpiresIn: int64(refreshExp.Seconds()),
+		SessionID:        session.ID,
+	}, nil
+}
+
+// getRefreshRecord returns the record of the refresh token and its remaining lifetime
+func (p *TokenProcessor) getRefreshRecord(ctx context.Context, refreshToken string) (*refreshRecord, time.Duration, error) {
+	if len(refreshToken) == 0 {
+		return nil, 0, ErrInvalidRefreshToken
+	}
+
+	pipe := p.rd.Pipeline()
+	value := pipe.Get(ctx, p.refreshKey(refreshToken))
+	ttl := pipe.TTL(ctx, p.refreshKey(refreshToken))
+	if _, err := pipe.Exec(ctx); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, 0, ErrInvalidRefreshToken
+		}
+		return nil, 0, err
+	}
+
+	record := &refreshRecord{}
+	if err := json.Unmarshal([]byte(value.Val()), record); err != nil {
+		return nil, 0, ErrInvalidRefreshToken
+	}
+	return record, ttl.Val(), nil
+}
+
+func (p *TokenProcessor) getSession(ctx context.Context, userID int64, sessionID string) (*Session, error) {
+	value, err := p.rd.HGet(ctx, p.sessionsKey(userID), sessionID).Result()
+	if errors.Is(err, redis.Nil) {
+		// revoked
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{}
+	if err = json.Unmarshal([]byte(value), session); err != nil || session.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+	return session, nil
+}
+
+func (p *TokenProcessor) accessExp() time.Duration {
+	return config.ViperGetDurationWithDefault("jwt.access_exp", 15*time.Minute)
+}
+
+func (p *TokenProcessor) refreshExp() time.Duration {
+	return config.ViperGetDurationWithDefault("jwt.refresh_exp", 30*24*time.Hour)
+}
+
+// refresh tokens are stored by hash, a leaked redis does not leak usable tokens
+func (p *TokenProcessor) refreshKey(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return p.redisPrefix + "refresh:" + hex.EncodeToString(sum[:])
+}
+
+func (p *TokenProcessor) refreshUsedKey(refreshToken string) string {
+	return p.refreshKey(refreshToken) + ":used"
+}
+
+func (p *TokenProcessor) sessionsKey(userID int64) string {
+	return fmt.Sprintf("%ssessions:%d", p.redisPrefix, userID)
+}
+
+func (p *TokenProcessor) revokedSessionKey(sessionID string) string {
+	return p.redisPrefix + "revoked_session:" + sessionID
+}
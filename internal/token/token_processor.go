@@ -3,12 +3,13 @@ package token
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/go-redis/redis/v8"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/nhdms/base-go/internal/permissions"
+	"github.com/google/uuid"
 	"github.com/nhdms/base-go/pkg/common"
 	"github.com/nhdms/base-go/pkg/config"
-	"github.com/nhdms/base-go/pkg/utils"
+	"github.com/nhdms/base-go/pkg/logger"
 	"github.com/nhdms/base-go/proto/exmsg/models"
 	"github.com/nhdms/base-go/proto/exmsg/services"
 	"github.com/spf13/cast"
@@ -17,35 +18,64 @@ import (
 	"time"
 )
 
+var (
+	ErrInvalidToken   = fmt.Errorf("%w: invalid token", common.UnauthorizedError)
+	ErrTokenRevoked   = fmt.Errorf("%w: token revoked", common.UnauthorizedError)
+	ErrSessionExpired = fmt.Errorf("%w: session expired", common.UnauthorizedError)
+	errRedisRequired  = errors.New("token revocation requires redis")
+)
+
 type TokenProcessor struct {
 	rd                   *redis.Client
 	userService          services.UserService
-	jwtSecret            []byte
+	keys                 *KeySet
 	enableSignatureCheck bool
+	// keys of the deny-list and the session cache are prefixed by redisPrefix
+	redisPrefix     string
+	sessionCacheTTL time.Duration
+	// sizes of the encoded user info above which the claim is compressed, then stored in redis
+	compressClaimBytes int
+	maxClaimBytes      int
 }
 
 type Claim struct {
 	UserInfo []byte `json:"u"`
+	// Compressed UserInfo is deflated, a Stored one only has the user id and signature, the full one is in redis
+	Compressed bool `json:"z,omitempty"`
+	Stored     bool `json:"r,omitempty"`
 	jwt.MapClaims
 }
 
 func NewTokenProcessor(rd *redis.Client, userService services.UserService) *TokenProcessor {
+	keysConfig := KeysConfig{}
+	_ = config.LoadConfigToVar(&keysConfig, "jwt")
+	keys, err := NewKeySet(keysConfig, []byte(viper.GetString("jwt.secret")))
+	if err != nil {
+		logger.DefaultLogger.Fatalf("Failed to load jwt keys: %v", err)
+	}
+
 	return &TokenProcessor{
 		rd:                   rd,
 		userService:          userService,
-		jwtSecret:            []byte(viper.GetString("jwt.secret")),
+		keys:                 keys,
 		enableSignatureCheck: viper.GetBool("jwt.enable_signature_check"),
+		redisPrefix:          config.ViperGetStringWithDefault("jwt.redis_prefix", "jwt:"),
+		sessionCacheTTL:      config.ViperGetDurationWithDefault("jwt.session_cache_ttl", 5*time.Minute),
+		compressClaimBytes:   config.ViperGetIntWithDefault("jwt.compress_claim_bytes", 512),
+		maxClaimBytes:        config.ViperGetIntWithDefault("jwt.max_claim_bytes", 3072),
 	}
 }
 
 func (p *TokenProcessor) GetToken(ctx context.Context, tokenString string) (token *Token, err error) {
 	rawClaim := Claim{}
-	tk, err := jwt.ParseWithClaims(tokenString, &rawClaim, func(token *jwt.Token) (interface{}, error) {
-		return p.jwtSecret, nil
-	})
-
+	tk, err := jwt.ParseWithClaims(tokenString, &rawClaim, p.keys.Keyfunc, jwt.WithValidMethods(p.keys.ValidMethods()))
 	if err != nil || !tk.Valid {
-		return nil, errors.New("invalid token")
+		return nil, ErrInvalidToken
+	}
+
+	token = &Token{Token: tk}
+	if err = p.decodeClaim(ctx, &rawClaim, GetTokenID(token)); err != nil {
+		return nil, err
 	}
 
 	claims := &models.JWTClaim{}
@@ -54,27 +84,160 @@ func (p *TokenProcessor) GetToken(ctx context.Context, tokenString string) (toke
 		return nil, common.UnauthorizedError
 	}
 
-	return &Token{Token: tk}, nil
+	if err = p.validateSession(ctx, token, claims); err != nil {
+		return nil, err
+	}
+	return token, nil
 }
 
-func (p *TokenProcessor) ExtractMetadata(token *Token) map[string]string {
-	metadata := make(map[string]string)
-	// Extract the claims
-	claim := GetJWTClaimFromToken(token)
-	if claim.UserId < 1 {
-		return metadata
-	}
-
-	for _, header := range common.ExtraDataHeaders {
-		switch header {
-		case common.HeaderUserId:
-			metadata[header] = cast.ToString(claim.UserId)
-		case common.HeaderChildUserIds:
-			metadata[header] = utils.ToJSONString(claim.SubUserIds)
+// validateSession rejects revoked tokens and, with jwt.enable_signature_check, tokens whose signature is not
+// the current session id of the user (logged out or password changed)
+func (p *TokenProcessor) validateSession(ctx context.Context, token *Token, claim *models.JWTClaim) error {
+	tokenID, sessionID := GetTokenID(token), GetSessionID(token)
+	var issuedAt int64
+	if iat, _ := token.Claims.GetIssuedAt(); iat != nil {
+		issuedAt = iat.Unix()
+	}
+
+	var currentSessionID *string
+	if p.rd != nil {
+		pipe := p.rd.Pipeline()
+		var revoked, revokedSession *redis.IntCmd
+		if len(tokenID) > 0 {
+			revoked = pipe.Exists(ctx, p.revokedTokenKey(tokenID))
+		}
+		if len(sessionID) > 0 {
+			revokedSession = pipe.Exists(ctx, p.revokedSessionKey(sessionID))
+		}
+		revokedBefore := pipe.Get(ctx, p.revokedBeforeKey(claim.UserId))
+		var session *redis.StringCmd
+		if p.enableSignatureCheck {
+			session = pipe.Get(ctx, p.sessionIDKey(claim.UserId))
 		}
+
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			logger.DefaultLogger.Errorw("Failed to check token revocation", "user_id", claim.UserId, "error", err)
+			return err
+		}
+
+		if (revoked != nil && revoked.Val() > 0) || (revokedSession != nil && revokedSession.Val() > 0) {
+			return ErrTokenRevoked
+		}
+		if before, err := revokedBefore.Int64(); err == nil && issuedAt < before {
+			return ErrTokenRevoked
+		}
+		if session != nil && session.Err() == nil {
+			cached := session.Val()
+			currentSessionID = &cached
+		}
+	}
+
+	if !p.enableSignatureCheck {
+		return nil
+	}
+
+	if currentSessionID == nil {
+		current, err := p.getSessionID(ctx, claim.UserId)
+		if err != nil {
+			return err
+		}
+		currentSessionID = &current
+	}
+
+	if claim.Signature != *currentSessionID {
+		return ErrSessionExpired
+	}
+	return nil
+}
+
+// getSessionID gets the session id of the user from the user service and caches it for jwt.session_cache_ttl
+func (p *TokenProcessor) getSessionID(ctx context.Context, userID int64) (string, error) {
+	resp, err := p.userService.GetUserByID(ctx, &services.UserRequest{UserId: userID})
+	if err != nil {
+		if common.IsNotFoundError(err) {
+			return "", common.UnauthorizedError
+		}
+		return "", err
+	}
+
+	sessionID := resp.GetUser().GetSessionId()
+	if p.rd != nil {
+		if err = p.rd.Set(ctx, p.sessionIDKey(userID), sessionID, p.sessionCacheTTL).Err(); err != nil {
+			logger.DefaultLogger.Warnw("Failed to cache session id", "user_id", userID, "error", err)
+		}
+	}
+	return sessionID, nil
+}
+
+// RevokeToken denies the token until it expires, e.g. on logout
+func (p *TokenProcessor) RevokeToken(ctx context.Context, token *Token) error {
+	exp, err := token.Claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return fmt.Errorf("token has no expiration time")
+	}
+	return p.RevokeTokenID(ctx, GetTokenID(token), exp.Time)
+}
+
+// RevokeTokenID adds the token id to the deny-list until expiresAt
+func (p *TokenProcessor) RevokeTokenID(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if p.rd == nil {
+		return errRedisRequired
+	}
+	if len(tokenID) == 0 {
+		return fmt.Errorf("token has no id")
 	}
 
-	return metadata
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		// already expired
+		return nil
+	}
+	return p.rd.Set(ctx, p.revokedTokenKey(tokenID), 1, ttl).Err()
+}
+
+// RevokeUserTokens denies every token of the user issued before now, e.g. after a password change
+func (p *TokenProcessor) RevokeUserTokens(ctx context.Context, userID int64) error {
+	if p.rd == nil {
+		return errRedisRequired
+	}
+
+	// older tokens are expired after jwt.exp, so is the key
+	exp := config.ViperGetDurationWithDefault("jwt.exp", time.Hour*24*7)
+	pipe := p.rd.TxPipeline()
+	pipe.Set(ctx, p.revokedBeforeKey(userID), time.Now().Unix(), exp)
+	pipe.Del(ctx, p.sessionIDKey(userID))
+	// refresh tokens of removed sessions are rejected
+	pipe.Del(ctx, p.sessionsKey(userID))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// InvalidateSession removes the cached session id of the user, call it when the session id of the user changes
+func (p *TokenProcessor) InvalidateSession(ctx context.Context, userID int64) error {
+	if p.rd == nil {
+		return nil
+	}
+	return p.rd.Del(ctx, p.sessionIDKey(userID)).Err()
+}
+
+func (p *TokenProcessor) revokedTokenKey(tokenID string) string {
+	return p.redisPrefix + "revoked:" + tokenID
+}
+
+func (p *TokenProcessor) revokedBeforeKey(userID int64) string {
+	return fmt.Sprintf("%srevoked_before:%d", p.redisPrefix, userID)
+}
+
+func (p *TokenProcessor) sessionIDKey(userID int64) string {
+	return fmt.Sprintf("%ssession:%d", p.redisPrefix, userID)
+}
+
+func (p *TokenProcessor) ExtractMetadata(token *Token) map[string]string {
+	principal := PrincipalFromToken(token)
+	if principal.UserID < 1 {
+		return make(map[string]string)
+	}
+	return principal.Metadata()
 }
 
 func (p *TokenProcessor) CheckPermissions(token *Token, requirePermissions map[int64]int64) bool {
@@ -82,44 +245,72 @@ func (p *TokenProcessor) CheckPermissions(token *Token, requirePermissions map[i
 		return true
 	}
 
-	claim := GetJWTClaimFromToken(token)
-	if claim.UserId < 1 {
+	principal := PrincipalFromToken(token)
+	if principal.UserID < 1 {
 		return false
 	}
+	return principal.CheckPermissions(requirePermissions)
+}
 
-	for permissionGroupId, permissionSum := range requirePermissions {
-		if !permissions.HasPermission(claim.Permissions[permissionGroupId], permissionSum) {
-			return false
-		}
-	}
-
-	return true
+// MissingPermissions returns the permission keys missing to grant the requirement, empty when it is granted
+func (p *TokenProcessor) MissingPermissions(token *Token, requirement common.PermissionRequirement) []string {
+	return PrincipalFromToken(token).MissingPermissions(requirement)
 }
 
+// GenerateToken issues a long lived access token (jwt.exp) without refresh token, see IssueTokens for short lived ones
 func (p *TokenProcessor) GenerateToken(ctx context.Context, user *models.User) (string, error) {
-	// Create the JWT claim structure and set the required permissions
 	exp := config.ViperGetDurationWithDefault("jwt.exp", time.Hour*24*7)
+	return p.generateAccessToken(ctx, user, exp, "")
+}
 
-	userInfo := &models.JWTClaim{
-		UserId:    user.Id,
-		Signature: user.GetSessionId(), // using session_id as signature, todo using other fields
+// generateAccessToken signs the access token of the user, sessionID is the refresh token session of the token
+func (p *TokenProcessor) generateAccessToken(ctx context.Context, user *models.User, exp time.Duration, sessionID string) (string, error) {
+	// Create the JWT claim structure and set the required permissions
+	userInfo, err := p.loadUserClaim(ctx, user)
+	if err != nil {
+		return "", err
 	}
 
-	userInfoBytes, _ := proto.Marshal(userInfo)
+	now := time.Now()
+	tokenID := uuid.NewString() // token id of the deny-list
 	claim := Claim{
-		UserInfo: userInfoBytes,
 		MapClaims: jwt.MapClaims{
-			"exp": jwt.NewNumericDate(time.Now().Add(exp)), // 7 days
+			"exp": jwt.NewNumericDate(now.Add(exp)),
+			"iat": jwt.NewNumericDate(now),
+			"jti": tokenID,
 		},
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claim)
-	signedToken, err := token.SignedString(p.jwtSecret)
-	if err != nil {
+	if len(sessionID) > 0 {
+		claim.MapClaims["sid"] = sessionID
+	}
+	if err = p.encodeClaim(ctx, &claim, userInfo, tokenID, exp); err != nil {
 		return "", err
 	}
 
-	return signedToken, nil
+	return p.keys.Sign(claim)
+}
+
+// JWKS returns the public keys verifying the tokens
+func (p *TokenProcessor) JWKS() *JWKS {
+	return p.keys.JWKS()
+}
+
+// GetTokenID returns the jti claim, it is empty for tokens issued before token ids were added
+func GetTokenID(t *Token) string {
+	rawClaim, ok := t.Claims.(*Claim)
+	if !ok {
+		return ""
+	}
+	return cast.ToString(rawClaim.MapClaims["jti"])
+}
+
+// GetSessionID returns the sid claim, the refresh token session of tokens issued by IssueTokens
+func GetSessionID(t *Token) string {
+	rawClaim, ok := t.Claims.(*Claim)
+	if !ok {
+		return ""
+	}
+	return cast.ToString(rawClaim.MapClaims["sid"])
 }
 
 func GetJWTClaimFromToken(t *Token) *models.JWTClaim {
@@ -0,0 +1,184 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nhdms/base-go/internal/permissions"
+	"github.com/nhdms/base-go/pkg/common"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+	"github.com/nhdms/base-go/proto/exmsg/services"
+	"github.com/spf13/viper"
+	"go-micro.dev/v5/client"
+)
+
+type sessionUserService struct {
+	sessionID string
+	claims    *services.UserClaimsResponse
+	apiKeys   map[string]*services.APIKeyResponse // by hash
+}
+
+func (s *sessionUserService) GetUserByID(ctx context.Context, in *services.UserRequest, opts ...client.CallOption) (*services.UserResponse, error) {
+	return &services.UserResponse{User: &models.User{Id: in.UserId, SessionId: s.sessionID}}, nil
+}
+
+func (s *sessionUserService) GetUserClaims(ctx context.Context, in *services.UserRequest, opts ...client.CallOption) (*services.UserClaimsResponse, error) {
+	if s.claims == nil {
+		return &services.UserClaimsResponse{}, nil
+	}
+	return s.claims, nil
+}
+
+func (s *sessionUserService) GetAPIKey(ctx context.Context, in *services.APIKeyRequest, opts ...client.CallOption) (*services.APIKeyResponse, error) {
+	apiKey, ok := s.apiKeys[in.KeyHash]
+	if !ok {
+		return nil, common.SQLNotFoundError
+	}
+	return apiKey, nil
+}
+
+func TestSignatureCheck(t *testing.T) {
+	viper.Set("jwt.secret", "secret")
+	viper.Set("jwt.enable_signature_check", true)
+	defer viper.Set("jwt.enable_signature_check", false)
+
+	userService := &sessionUserService{sessionID: "session-1"}
+	processor := NewTokenProcessor(nil, userService)
+	ctx := context.Background()
+
+	tokenString, err := processor.GenerateToken(ctx, &models.User{Id: 1, SessionId: "session-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tk, err := processor.GetToken(ctx, tokenString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(GetTokenID(tk)) == 0 {
+		t.Fatal("expected token id")
+	}
+
+	// logged out, the session id of the user changed
+	userService.sessionID = "session-2"
+	if _, err = processor.GetToken(ctx, tokenString); !errors.Is(err, ErrSessionExpired) || !errors.Is(err, common.UnauthorizedError) {
+		t.Fatalf("expected session expired, got %v", err)
+	}
+
+	if err = processor.RevokeToken(ctx, tk); !errors.Is(err, errRedisRequired) {
+		t.Fatalf("expected redis required error, got %v", err)
+	}
+}
+
+func TestUserClaims(t *testing.T) {
+	viper.Set("jwt.secret", "secret")
+
+	subUserIds := []int64{7, 3, 3}
+	for id := int64(100); id < 400; id++ {
+		subUserIds = append(subUserIds, id)
+	}
+	userService := &sessionUserService{claims: &services.UserClaimsResponse{
+		Permissions: []int64{0, permissions.OrderFetchMany | permissions.OrderBulkUpdateStatus, 0, 0},
+		DataSets:    []*models.JWTDataSet{{ProjectId: 1, CountryId: 84}, {ProjectId: 1, CountryId: 84}, {ProjectId: 2, CountryId: 66}},
+		SubUserIds:  subUserIds,
+	}}
+	processor := NewTokenProcessor(nil, userService)
+	ctx := context.Background()
+
+	tokenString, err := processor.GenerateToken(ctx, &models.User{Id: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 300 sub users are above jwt.compress_claim_bytes
+	unverified := &Claim{}
+	if _, _, err = jwt.NewParser().ParseUnverified(tokenString, unverified); err != nil || !unverified.Compressed {
+		t.Fatalf("expected compressed claim, got %v", err)
+	}
+
+	tk, err := processor.GetToken(ctx, tokenString)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claim := GetJWTClaimFromToken(tk)
+	if len(claim.Permissions) != 2 || len(claim.DataSets) != 2 || len(claim.SubUserIds) != 302 || claim.SubUserIds[0] != 3 {
+		t.Fatalf("unexpected claim %v", claim)
+	}
+
+	if !processor.CheckPermissions(tk, map[int64]int64{int64(permissions.Order): permissions.OrderBulkUpdateStatus}) {
+		t.Fatal("expected order permission")
+	}
+	if processor.CheckPermissions(tk, map[int64]int64{int64(permissions.Roles): permissions.RolesFetchMany}) {
+		t.Fatal("expected no roles permission")
+	}
+}
+
+func TestPrincipals(t *testing.T) {
+	viper.Set("jwt.secret", "secret")
+
+	key, hash, prefix, err := GenerateAPIKey()
+	if err != nil || len(prefix) != len(APIKeyPrefix)+apiKeyDisplayChars || HashAPIKey(key) != hash {
+		t.Fatalf("unexpected api key %s %s %v", prefix, hash, err)
+	}
+
+	userService := &sessionUserService{
+		claims: &services.UserClaimsResponse{
+			Permissions: []int64{0, permissions.OrderFetchMany | permissions.OrderBulkUpdateStatus},
+			SubUserIds:  []int64{2},
+		},
+		apiKeys: map[string]*services.APIKeyResponse{
+			hash: {Id: 5, UserId: 1, Scopes: []string{"order.fetch_many", "order.cancel", "roles.fetch_many"}},
+		},
+	}
+	processor := NewTokenProcessor(nil, userService)
+	ctx := context.Background()
+
+	// the key only has the scopes granted to its owner
+	principal, err := processor.GetAPIKeyPrincipal(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.Type != PrincipalAPIKey || principal.ID != "5" || principal.UserID != 1 || len(principal.SubUserIDs) != 1 {
+		t.Fatalf("unexpected principal %v", principal)
+	}
+	if missing := principal.MissingPermissions(permissions.All(
+		permissions.Require(permissions.Order, permissions.OrderFetchMany),
+		permissions.Require(permissions.Order, permissions.OrderBulkUpdateStatus),
+		permissions.Require(permissions.Order, permissions.OrderCancel),
+	)); len(missing) != 2 {
+		t.Fatalf("unexpected missing permissions %v", missing)
+	}
+	if _, err = processor.GetAPIKeyPrincipal(ctx, key+"x"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("expected invalid api key, got %v", err)
+	}
+
+	serviceToken, err := processor.GenerateServiceToken("order-service", []string{"roles.fetch_many"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, err = processor.GetServicePrincipal(ctx, serviceToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := principal.Metadata()
+	if metadata[common.HeaderPrincipalType] != PrincipalService || metadata[common.HeaderPrincipalId] != "order-service" ||
+		len(metadata[common.HeaderUserId]) > 0 || !principal.CheckPermissions(map[int64]int64{int64(permissions.Roles): permissions.RolesFetchMany}) {
+		t.Fatalf("unexpected service principal %v", metadata)
+	}
+
+	// user and service tokens are not interchangeable
+	userToken, err := processor.GenerateToken(ctx, &models.User{Id: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = processor.GetServicePrincipal(ctx, userToken); !errors.Is(err, ErrInvalidServiceToken) {
+		t.Fatalf("expected invalid service token, got %v", err)
+	}
+	if _, err = processor.GetToken(ctx, serviceToken); !errors.Is(err, common.UnauthorizedError) {
+		t.Fatalf("expected unauthorized, got %v", err)
+	}
+}
@@ -3,7 +3,9 @@ package token
 import (
 	"context"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/nhdms/base-go/pkg/common"
 	"github.com/nhdms/base-go/proto/exmsg/models"
+	"time"
 )
 
 type Token struct {
@@ -14,5 +16,23 @@ type Processor interface {
 	GetToken(ctx context.Context, tokenString string) (token *Token, err error)
 	ExtractMetadata(token *Token) map[string]string
 	CheckPermissions(token *Token, requirePermissions map[int64]int64) bool
+	MissingPermissions(token *Token, requirement common.PermissionRequirement) []string
 	GenerateToken(ctx context.Context, user *models.User) (string, error)
+	RevokeToken(ctx context.Context, token *Token) error
+	RevokeTokenID(ctx context.Context, tokenID string, expiresAt time.Time) error
+	RevokeUserTokens(ctx context.Context, userID int64) error
+	InvalidateSession(ctx context.Context, userID int64) error
+
+	IssueTokens(ctx context.Context, user *models.User, device DeviceInfo) (*TokenPair, error)
+	RefreshTokens(ctx context.Context, refreshToken string) (*TokenPair, error)
+	RevokeRefreshToken(ctx context.Context, refreshToken string) error
+	ListSessions(ctx context.Context, userID int64) ([]*Session, error)
+	RevokeSession(ctx context.Context, userID int64, sessionID string) error
+
+	JWKS() *JWKS
+
+	GetAPIKeyPrincipal(ctx context.Context, key string) (*Principal, error)
+	InvalidateAPIKey(ctx context.Context, hash string) error
+	GenerateServiceToken(service string, scopes []string, exp time.Duration) (string, error)
+	GetServicePrincipal(ctx context.Context, tokenString string) (*Principal, error)
 }
@@ -1,16 +1,22 @@
 package app
 
 import (
+	"context"
+	"expvar"
 	"fmt"
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/goccy/go-json"
 	config2 "github.com/nhdms/base-go/pkg/config"
+	"github.com/nhdms/base-go/pkg/dbtool"
 	"github.com/nhdms/base-go/pkg/logger"
+	replication "github.com/nhdms/base-go/pkg/replication/defines"
 	"github.com/nhdms/base-go/pkg/replication/pglogicalstream"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 func StartDataReplica(handler Consumer) error {
@@ -21,6 +27,11 @@ func StartDataReplica(handler Consumer) error {
 		return err
 	}
 
+	streamConfig.CheckpointStore, err = newCheckpointStore(streamConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint store for task %s: %w", name, err)
+	}
+
 	err = handler.Init()
 	if err != nil {
 		return fmt.Errorf("failed to initialize gRPC client for task %s: %w", name, err)
@@ -46,6 +57,10 @@ func StartDataReplica(handler Consumer) error {
 		panic(err)
 	}
 
+	if len(streamConfig.StatusAddr) > 0 {
+		go serveReplicationStatus(streamConfig.StatusAddr, pgStream)
+	}
+
 	// Listen for shutdown signal
 	go func() {
 		<-signalChan
@@ -55,24 +70,115 @@ func StartDataReplica(handler Consumer) error {
 		handler.Close()
 	}()
 
+	var streamErr error
 	pgStream.OnMessage(func(changeCaptured pglogicalstream.Wal2JsonChanges) {
-		msgBytes, _ := json.Marshal(changeCaptured)
-		newMsg := message.NewMessage(watermill.NewUUID(), msgBytes)
-		err = handler.HandleMessage(newMsg)
-		if err != nil {
-			logger.DefaultLogger.Error("Failed to handle message", err, watermill.LogFields{
-				"uuid": newMsg.UUID,
+		if streamErr != nil {
+			return
+		}
+
+		// snapshot progress markers have no changes to handle
+		if len(changeCaptured.Changes) > 0 {
+			// handlers receive replication.Messages, or a replication.Transaction with emit_transactions,
+			// decode the changes with Message.Decode or DecodeModel
+			var newMsg *message.Message
+			if streamConfig.EmitTransactions && changeCaptured.Snapshot == nil && changeCaptured.Lsn != nil {
+				msgBytes, _ := json.Marshal(changeCaptured.ToTransaction())
+				newMsg = message.NewMessage(watermill.NewUUID(), msgBytes)
+				newMsg.Metadata.Set(replication.MetadataPayload, replication.PayloadTransaction)
+			} else {
+				msgBytes, _ := json.Marshal(changeCaptured.ToMessages())
+				newMsg = message.NewMessage(watermill.NewUUID(), msgBytes)
+				newMsg.Metadata.Set(replication.MetadataPayload, replication.PayloadMessages)
+			}
+			err = retryWithBackoff(pgStream.Context(), streamConfig, func() error {
+				return handler.HandleMessage(newMsg)
 			})
-			// stop to prevent message being lost
-			err = pgStream.Stop()
+			if err != nil && pgStream.Context().Err() != nil {
+				// stopped while retrying, the message is delivered again after restart
+				logger.DefaultLogger.Warnf("Stream stopped while retrying message %s: %v", newMsg.UUID, err)
+				return
+			}
 			if err != nil {
-				logger.DefaultLogger.Fatal("Failed to stop streaming", err)
+				logger.DefaultLogger.Error("Failed to handle message", err, watermill.LogFields{
+					"uuid": newMsg.UUID,
+				})
+				// stop without ack, the message is delivered again from the checkpoint after restart
+				streamErr = fmt.Errorf("failed to handle message %s: %w", newMsg.UUID, err)
+				_ = pgStream.Stop()
+				return
 			}
 		}
-		if changeCaptured.Lsn != nil {
-			// Snapshots dont have LSN
-			pgStream.AckLSN(*changeCaptured.Lsn)
+
+		// snapshots dont have LSN, their progress is committed by the markers
+		err = pgStream.Commit(changeCaptured)
+		if err != nil {
+			streamErr = err
+			_ = pgStream.Stop()
 		}
 	})
-	return nil
+
+	if streamErr == nil {
+		streamErr = pgStream.Err()
+	}
+	return streamErr
+}
+
+// serveReplicationStatus serves the slot lag and snapshot progress, metrics are served by expvar
+func serveReplicationStatus(addr string, pgStream *pglogicalstream.Stream) {
+	mux := http.NewServeMux()
+	mux.Handle("/replication/status", pgStream.StatusHandler())
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	logger.DefaultLogger.Infof("Replication status API listening on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.DefaultLogger.Errorf("Replication status API stopped: %v", err)
+	}
+}
+
+// retryWithBackoff retries fn with exponential backoff, RetryMaxAttempts = 0 retries until fn succeeds or ctx is canceled
+func retryWithBackoff(ctx context.Context, conf *pglogicalstream.Config, fn func() error) error {
+	interval := conf.RetryInitialInterval
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		if conf.RetryMaxAttempts > 0 && attempt >= conf.RetryMaxAttempts {
+			return err
+		}
+
+		logger.DefaultLogger.Warnf("Handle message failed (attempt %d), retry in %v: %v", attempt, interval, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("retry canceled: %w", err)
+		case <-time.After(interval):
+		}
+
+		interval *= 2
+		if interval > conf.RetryMaxInterval {
+			interval = conf.RetryMaxInterval
+		}
+	}
+}
+
+func newCheckpointStore(conf *pglogicalstream.Config) (pglogicalstream.CheckpointStore, error) {
+	switch conf.Checkpoint {
+	case "":
+		return nil, nil
+	case pglogicalstream.CheckpointPostgres:
+		psql, err := dbtool.NewConnectionManager(dbtool.DBTypePostgreSQL, nil)
+		if err != nil {
+			return nil, err
+		}
+		return pglogicalstream.NewPostgresCheckpointStore(psql.GetConnection().DB, conf.CheckpointTable)
+	case pglogicalstream.CheckpointRedis:
+		redis, err := dbtool.CreateRedisConnection(nil)
+		if err != nil {
+			return nil, err
+		}
+		return pglogicalstream.NewRedisCheckpointStore(redis, conf.CheckpointTable), nil
+	default:
+		return nil, fmt.Errorf("unsupported checkpoint store %s", conf.Checkpoint)
+	}
 }
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/nhdms/base-go/pkg/config"
+	"github.com/nhdms/base-go/pkg/dbtool"
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/spf13/viper"
+)
+
+// RunMigrations applies pending migrations of the service, enabled by config:
+//
+//	[migration]
+//	auto = true
+//	dry_run = false
+//	dir = "" # default is <cmd_bin_dir>/migrations, or ./migrations when running from the service folder
+//	service = "" # applied versions are kept per service, default is the folder of cmd_bin_dir (e.g. user-service)
+func RunMigrations(ctx context.Context) error {
+	dir := GetMigrationDir()
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		logger.DefaultLogger.Infof("Migration dir %s not found, skip migrations", dir)
+		return nil
+	}
+
+	psql, err := dbtool.NewConnectionManager(dbtool.DBTypePostgreSQL, nil)
+	if err != nil {
+		return err
+	}
+	defer psql.Close()
+
+	migrator := dbtool.NewMigrator(psql.GetConnection(), dir, GetMigrationService(), viper.GetBool("migration.dry_run"))
+	migrations, err := migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+
+	logger.DefaultLogger.Infof("Migrations in %s are up to date, %d applied", dir, len(migrations))
+	return nil
+}
+
+// GetMigrationService returns the service of the applied versions, the same as `gcli migrate --service`
+func GetMigrationService() string {
+	service := viper.GetString("migration.service")
+	if len(service) > 0 || GlobalServiceConfig == nil {
+		return service
+	}
+
+	if len(GlobalServiceConfig.CmdBinDir) > 0 {
+		return filepath.Base(GlobalServiceConfig.CmdBinDir)
+	}
+	return GlobalServiceConfig.ServiceName
+}
+
+func GetMigrationDir() string {
+	dir := config.ViperGetStringWithDefault("migration.dir", os.Getenv("MIGRATIONS_DIR"))
+	if len(dir) > 0 {
+		return dir
+	}
+
+	// docker images keep the source tree in the working directory
+	if GlobalServiceConfig != nil && len(GlobalServiceConfig.CmdBinDir) > 0 {
+		dir = filepath.Join(GlobalServiceConfig.CmdBinDir, "migrations")
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return "migrations"
+}
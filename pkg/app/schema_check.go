@@ -0,0 +1,38 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nhdms/base-go/pkg/dbtool"
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/spf13/viper"
+)
+
+// CheckDatabaseSchema compares the registered tables with the database, enabled by config:
+//
+//	[schema_check]
+//	enabled = true
+//	strict = false # fail startup on drift instead of logging warnings
+//	schema = "public"
+func CheckDatabaseSchema(ctx context.Context) error {
+	psql, err := dbtool.NewConnectionManager(dbtool.DBTypePostgreSQL, nil)
+	if err != nil {
+		return err
+	}
+	defer psql.Close()
+
+	issues, err := dbtool.CheckSchema(ctx, psql.GetConnection(), viper.GetString("schema_check.schema"))
+	if err != nil {
+		return err
+	}
+
+	for _, issue := range issues {
+		logger.DefaultLogger.Warnf("Schema drift %s", issue)
+	}
+
+	if len(issues) > 0 && viper.GetBool("schema_check.strict") {
+		return fmt.Errorf("found %d schema issues", len(issues))
+	}
+	return nil
+}
@@ -1,15 +1,31 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	svr "github.com/nhdms/base-go/grpc"
+	"github.com/nhdms/base-go/pkg/logger"
 	"github.com/spf13/cast"
+	"github.com/spf13/viper"
 	"go-micro.dev/v5"
 	"go-micro.dev/v5/server"
 	"os"
 )
 
 func NewGRPCService() micro.Service {
+	// migrate before the service is registered, so no request is served by an outdated schema
+	if viper.GetBool("migration.auto") {
+		if err := RunMigrations(context.Background()); err != nil {
+			logger.DefaultLogger.Fatal("Failed to run migrations: ", err)
+		}
+	}
+
+	if viper.GetBool("schema_check.enabled") {
+		if err := CheckDatabaseSchema(context.Background()); err != nil {
+			logger.DefaultLogger.Fatal("Failed to check database schema: ", err)
+		}
+	}
+
 	name := GetGRPCServiceName(GlobalServiceConfig.ServiceName)
 	port := cast.ToInt(os.Getenv("PORT"))
 	if port < 1 {
@@ -0,0 +1,212 @@
+package audit
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nhdms/base-go/pkg/common"
+	"github.com/nhdms/base-go/pkg/config"
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/nhdms/base-go/pkg/utils"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+	"github.com/spf13/cast"
+	microerrors "go-micro.dev/v5/errors"
+	"go-micro.dev/v5/server"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	SourceGateway = "gateway"
+
+	DefaultExchange   = "audit_events"
+	defaultBufferSize = 1000
+
+	defaultRetryMaxAttempts = 5
+	defaultRetryInterval    = 200 * time.Millisecond
+	maxRetryInterval        = 10 * time.Second
+)
+
+// droppedEvents counts the events dropped by the emitters by source, served by expvar at /debug/vars
+var droppedEvents = expvar.NewMap("audit_events_dropped")
+
+// Publisher publishes the events to RabbitMQ, e.g. app.PublisherInterface
+type Publisher interface {
+	PublishRoutingPersist(exchName, routingKey string, data []byte) error
+}
+
+// Emitter publishes the audit events in the background to the audit.exchange exchange (routing key is the source),
+// the audit consumer stores them. A failed publish is retried audit.retry_max_attempts times with exponential backoff
+// from audit.retry_interval. A request never waits for RabbitMQ: when audit.buffer_size events are pending the
+// new events are dropped. Dropped events are logged and counted, see Dropped.
+type Emitter struct {
+	publisher        Publisher
+	source           string
+	exchange         string
+	retryMaxAttempts int
+	retryInterval    time.Duration
+	events           chan *models.AuditEvent
+	dropped          atomic.Int64
+	wg               sync.WaitGroup
+	closeOnce        sync.Once
+}
+
+func NewEmitter(publisher Publisher, source string) *Emitter {
+	e := &Emitter{
+		publisher:        publisher,
+		source:           source,
+		exchange:         config.ViperGetStringWithDefault("audit.exchange", DefaultExchange),
+		retryMaxAttempts: config.ViperGetIntWithDefault("audit.retry_max_attempts", defaultRetryMaxAttempts),
+		retryInterval:    config.ViperGetDurationWithDefault("audit.retry_interval", defaultRetryInterval),
+		events:           make(chan *models.AuditEvent, config.ViperGetIntWithDefault("audit.buffer_size", defaultBufferSize)),
+	}
+
+	e.wg.Add(1)
+	go e.run()
+	return e
+}
+
+// Emit queues the event, its id, time and source are set when empty
+func (e *Emitter) Emit(event *models.AuditEvent) {
+	if len(event.EventId) == 0 {
+		event.EventId = uuid.NewString()
+	}
+	if event.OccurredAt == nil {
+		event.OccurredAt = timestamppb.Now()
+	}
+	if len(event.Source) == 0 {
+		event.Source = e.source
+	}
+
+	select {
+	case e.events <- event:
+	default:
+		e.drop(event, "the buffer is full")
+	}
+}
+
+// Dropped returns the number of events dropped by the emitter
+func (e *Emitter) Dropped() int64 {
+	return e.dropped.Load()
+}
+
+func (e *Emitter) drop(event *models.AuditEvent, reason string) {
+	e.dropped.Add(1)
+	droppedEvents.Add(e.source, 1)
+	logger.DefaultLogger.Errorw("Audit event dropped, "+reason, "event_id", event.EventId,
+		"action", event.Action, "principal_id", event.PrincipalId, "dropped", e.dropped.Load())
+}
+
+func (e *Emitter) run() {
+	defer e.wg.Done()
+	for event := range e.events {
+		if err := e.publish(event); err != nil {
+			e.drop(event, "publish failed: "+err.Error())
+		}
+	}
+}
+
+// publish retries a failed publish with exponential backoff, the next events wait in the buffer
+func (e *Emitter) publish(event *models.AuditEvent) error {
+	data := utils.ToJSONByte(event)
+	interval := e.retryInterval
+	for attempt := 1; ; attempt++ {
+		err := e.publisher.PublishRoutingPersist(e.exchange, event.Source, data)
+		if err == nil || attempt >= e.retryMaxAttempts {
+			return err
+		}
+
+		logger.DefaultLogger.Warnw("Failed to publish audit event, retrying", "event_id", event.EventId,
+			"attempt", attempt, "retry_in", interval.String(), "error", err)
+		time.Sleep(interval)
+		interval *= 2
+		if interval > maxRetryInterval {
+			interval = maxRetryInterval
+		}
+	}
+}
+
+// Close publishes the pending events and stops the emitter
+func (e *Emitter) Close() {
+	e.closeOnce.Do(func() {
+		close(e.events)
+		e.wg.Wait()
+	})
+}
+
+// NewHandlerWrapper emits an event for each call of the gRPC endpoints (e.g. "OrderService.BulkUpdateStatus") with
+// the caller forwarded by the gateway in the X-AT-* metadata:
+//
+//	svc.Init(micro.WrapHandler(audit.NewHandlerWrapper(emitter, "OrderService.BulkUpdateStatus")))
+func NewHandlerWrapper(emitter *Emitter, endpoints ...string) server.HandlerWrapper {
+	audited := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		audited[endpoint] = true
+	}
+
+	return func(next server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			if !audited[req.Endpoint()] {
+				return next(ctx, req, rsp)
+			}
+
+			start := time.Now()
+			err := next(ctx, req, rsp)
+
+			event := &models.AuditEvent{
+				Action:    req.Endpoint(),
+				Service:   req.Service(),
+				Method:    req.Method(),
+				Status:    http.StatusOK,
+				LatencyMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				event.Status = errorStatus(err)
+				event.Error = err.Error()
+			}
+			setPrincipal(ctx, event)
+			emitter.Emit(event)
+			return err
+		}
+	}
+}
+
+// errorStatus is the HTTP status of a handler error, like the gateway responds it
+func errorStatus(err error) int32 {
+	switch {
+	case common.IsUnauthorizedError(err):
+		return http.StatusUnauthorized
+	case common.IsPermissionDeniedError(err):
+		return http.StatusForbidden
+	case common.IsNotFoundError(err):
+		return http.StatusNotFound
+	case common.IsConflictError(err):
+		return http.StatusConflict
+	case common.IsInvalidFieldError(err):
+		return http.StatusBadRequest
+	}
+
+	if microErr, ok := microerrors.As(err); ok && microErr.Code >= http.StatusBadRequest {
+		return microErr.Code
+	}
+	return http.StatusInternalServerError
+}
+
+func setPrincipal(ctx context.Context, event *models.AuditEvent) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	event.PrincipalType = get(common.HeaderPrincipalType)
+	event.PrincipalId = get(common.HeaderPrincipalId)
+	event.UserId = cast.ToInt64(get(common.HeaderUserId))
+}
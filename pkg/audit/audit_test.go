@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/nhdms/base-go/pkg/common"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+	"github.com/spf13/viper"
+	microerrors "go-micro.dev/v5/errors"
+)
+
+type recordPublisher struct {
+	m        sync.Mutex
+	messages map[string][][]byte // by exchange:routing key
+}
+
+func (p *recordPublisher) PublishRoutingPersist(exchName, routingKey string, data []byte) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.messages[exchName+":"+routingKey] = append(p.messages[exchName+":"+routingKey], data)
+	return nil
+}
+
+func TestEmitter(t *testing.T) {
+	publisher := &recordPublisher{messages: make(map[string][][]byte)}
+	emitter := NewEmitter(publisher, SourceGateway)
+	emitter.Emit(&models.AuditEvent{UserId: 7, Action: "Bulk update order status", Status: 200})
+	emitter.Close()
+
+	messages := publisher.messages[DefaultExchange+":"+SourceGateway]
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 event, got %v", publisher.messages)
+	}
+
+	// the consumer reads the events back
+	event := &models.AuditEvent{}
+	if err := json.Unmarshal(messages[0], event); err != nil {
+		t.Fatal(err)
+	}
+	if len(event.EventId) == 0 || event.OccurredAt == nil || event.OccurredAt.AsTime().IsZero() ||
+		event.Source != SourceGateway || event.UserId != 7 || event.Action != "Bulk update order status" {
+		t.Fatalf("unexpected event %v", event)
+	}
+}
+
+type failingPublisher struct {
+	recordPublisher
+	failures int
+}
+
+func (p *failingPublisher) PublishRoutingPersist(exchName, routingKey string, data []byte) error {
+	p.m.Lock()
+	if p.failures > 0 {
+		p.failures--
+		p.m.Unlock()
+		return errors.New("connection closed")
+	}
+	p.m.Unlock()
+	return p.recordPublisher.PublishRoutingPersist(exchName, routingKey, data)
+}
+
+func TestEmitterRetry(t *testing.T) {
+	viper.Set("audit.retry_interval", "1ms")
+	defer viper.Set("audit.retry_interval", nil)
+
+	// the publish succeeds on the last attempt
+	publisher := &failingPublisher{recordPublisher: recordPublisher{messages: make(map[string][][]byte)}, failures: defaultRetryMaxAttempts - 1}
+	emitter := NewEmitter(publisher, SourceGateway)
+	emitter.Emit(&models.AuditEvent{Action: "retried"})
+	emitter.Close()
+	if len(publisher.messages[DefaultExchange+":"+SourceGateway]) != 1 || emitter.Dropped() != 0 {
+		t.Fatalf("expected the event published after retries, got %v dropped %d", publisher.messages, emitter.Dropped())
+	}
+
+	// the event is counted as dropped when every attempt failed
+	publisher = &failingPublisher{recordPublisher: recordPublisher{messages: make(map[string][][]byte)}, failures: defaultRetryMaxAttempts}
+	emitter = NewEmitter(publisher, SourceGateway)
+	emitter.Emit(&models.AuditEvent{Action: "dropped"})
+	emitter.Close()
+	if len(publisher.messages) != 0 || emitter.Dropped() != 1 {
+		t.Fatalf("expected the event dropped, got %v dropped %d", publisher.messages, emitter.Dropped())
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	for err, status := range map[error]int32{
+		common.PermissionDeniedError:                              http.StatusForbidden,
+		&common.MissingPermissionError{Missing: []string{"x"}}:    http.StatusForbidden,
+		fmt.Errorf("%w: invalid token", common.UnauthorizedError): http.StatusUnauthorized,
+		common.SQLNotFoundError:                                   http.StatusNotFound,
+		microerrors.NotFound("order", "order 1 not found"):        http.StatusNotFound,
+		errors.New("connection refused"):                          http.StatusInternalServerError,
+	} {
+		if got := errorStatus(err); got != status {
+			t.Errorf("%v: expected %d, got %d", err, status, got)
+		}
+	}
+}
@@ -9,15 +9,19 @@ const (
 	AuthCodeUserNotVerified
 	AuthCodeUserBlocked
 	AuthCodeUnauthorized
+	AuthCodePermissionDenied
+	AuthCodeAccessDenied
 )
 
 var Code2Message = map[int]string{
-	AuthCodeNoEndPoint:      "No endpoint provided",
-	AuthCodeNoToken:         "No token provided",
-	AuthCodeInvalidToken:    "Invalid token",
-	AuthCodeExpiredToken:    "Expired token",
-	AuthCodeInvalidUser:     "Invalid user",
-	AuthCodeUserNotVerified: "User not verified",
-	AuthCodeUserBlocked:     "User blocked",
-	AuthCodeUnauthorized:    "Unauthorized",
+	AuthCodeNoEndPoint:       "No endpoint provided",
+	AuthCodeNoToken:          "No token provided",
+	AuthCodeInvalidToken:     "Invalid token",
+	AuthCodeExpiredToken:     "Expired token",
+	AuthCodeInvalidUser:      "Invalid user",
+	AuthCodeUserNotVerified:  "User not verified",
+	AuthCodeUserBlocked:      "User blocked",
+	AuthCodeUnauthorized:     "Unauthorized",
+	AuthCodePermissionDenied: "Permission denied",
+	AuthCodeAccessDenied:     "Access denied",
 }
@@ -12,7 +12,10 @@ var (
 	ErrorUserInactivated    = errors.New("inactivated user")
 	ErrorCompanyInactivated = errors.New("inactivated company")
 	UserHasNoProfile        = errors.New("user has no profile")
-	SQLNotFoundError        = errors.New("grpc not found. sql.ErrNoRows") // create new error because cannot compare error by grpc protocol
+	SQLNotFoundError        = errors.New("grpc not found. sql.ErrNoRows")        // create new error because cannot compare error by grpc protocol
+	SQLConflictError        = errors.New("grpc aborted. version conflict")       // row was modified by another request since it was read
+	SQLInvalidFieldError    = errors.New("grpc invalid argument. invalid field") // field can not be selected or updated
+	PermissionDeniedError   = errors.New("permission denied")                    // see MissingPermissionError
 )
 
 func IsNotFoundError(err error) bool {
@@ -22,3 +25,35 @@ func IsNotFoundError(err error) bool {
 
 	return errors.Is(err, sql.ErrNoRows) || strings.Contains(err.Error(), SQLNotFoundError.Error())
 }
+
+func IsConflictError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return errors.Is(err, SQLConflictError) || strings.Contains(err.Error(), SQLConflictError.Error())
+}
+
+func IsInvalidFieldError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return errors.Is(err, SQLInvalidFieldError) || strings.Contains(err.Error(), SQLInvalidFieldError.Error())
+}
+
+func IsUnauthorizedError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return errors.Is(err, UnauthorizedError) || strings.Contains(err.Error(), UnauthorizedError.Error())
+}
+
+func IsPermissionDeniedError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return errors.Is(err, PermissionDeniedError) || strings.Contains(err.Error(), PermissionDeniedError.Error())
+}
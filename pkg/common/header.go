@@ -3,11 +3,20 @@ package common
 const (
 	HeaderUserId       = "X-AT-UserId"
 	HeaderChildUserIds = "X-AT-Child-UserIds"
+	HeaderDataSets     = "X-AT-Data-Sets"
+	HeaderPermissions  = "X-AT-Permissions"
+	// the caller is a user, an api key or a service, see token.Principal
+	HeaderPrincipalType = "X-AT-Principal-Type"
+	HeaderPrincipalId   = "X-AT-Principal-Id"
 )
 
 var ExtraDataHeaders = []string{
 	HeaderUserId,
 	HeaderChildUserIds,
+	HeaderDataSets,
+	HeaderPermissions,
+	HeaderPrincipalType,
+	HeaderPrincipalId,
 	//"X-AT-Shop-Id",
 	//"X-AT-Currency",
 	//"X-AT-Language",
@@ -0,0 +1,25 @@
+package common
+
+import "strings"
+
+// PermissionRequirement is a permission rule of a route or a gRPC handler, declared with permission keys
+// (e.g. order.bulk_update_status, see permissions.Require): a single Key, All of the requirements (AND) or
+// at least one of Any (OR)
+type PermissionRequirement struct {
+	Key string                  `json:"k,omitempty"`
+	All []PermissionRequirement `json:"all,omitempty"`
+	Any []PermissionRequirement `json:"any,omitempty"`
+}
+
+// MissingPermissionError is a PermissionDeniedError with the missing permission keys, one of them is enough for an Any
+type MissingPermissionError struct {
+	Missing []string
+}
+
+func (e *MissingPermissionError) Error() string {
+	return PermissionDeniedError.Error() + ": missing " + strings.Join(e.Missing, ", ")
+}
+
+func (e *MissingPermissionError) Unwrap() error {
+	return PermissionDeniedError
+}
@@ -4,4 +4,5 @@ const (
 	ServiceNameUser    = "user"
 	ServiceNameWebhook = "webhook"
 	ServiceNameEvent   = "event"
+	ServiceNameAudit   = "audit"
 )
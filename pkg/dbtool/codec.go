@@ -0,0 +1,258 @@
+package dbtool
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/goccy/go-json"
+	"github.com/lib/pq"
+	"github.com/spf13/cast"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ModelField maps a column (json name of the model field) to the Go field name
+type ModelField struct {
+	Column string
+	Name   string
+}
+
+// ModelCodec holds reflection-free accessors of a model, generated by `gcli gen table`.
+// SQLTool and ScanRow use the codec instead of reflection when one is registered for the model.
+type ModelCodec struct {
+	Fields []ModelField
+	// ScanTargets returns scan destinations pointing to the fields of dest, nil if dest is not the codec model
+	ScanTargets func(dest interface{}, columns []string) []interface{}
+	// Value returns the SQL value of a field (Go field name) of item
+	Value func(item interface{}, field string) (interface{}, bool)
+
+	types map[string]reflect.Type
+}
+
+var modelCodecs sync.Map // reflect.Type -> *ModelCodec
+
+// RegisterModelCodec registers the generated codec of model, it should be called from init()
+func RegisterModelCodec(model interface{}, codec *ModelCodec) {
+	typ := reflect.TypeOf(model)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	codec.types = make(map[string]reflect.Type, len(codec.Fields))
+	for _, f := range codec.Fields {
+		field, ok := typ.FieldByName(f.Name)
+		if !ok {
+			panic(fmt.Sprintf("dbtool: field %s not found in %s, please re-generate table code", f.Name, typ))
+		}
+		codec.types[f.Name] = field.Type
+	}
+
+	modelCodecs.Store(typ, codec)
+}
+
+func getModelCodec(model interface{}) *ModelCodec {
+	typ := reflect.TypeOf(model)
+	if typ == nil {
+		return nil
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	v, ok := modelCodecs.Load(typ)
+	if !ok {
+		return nil
+	}
+	return v.(*ModelCodec)
+}
+
+// isZeroValue reports zero values returned by generated codecs, they are written as NULL or the NotNullColumns default
+func isZeroValue(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case int64:
+		return val == 0
+	case float64:
+		return val == 0
+	case string:
+		return len(val) == 0
+	case bool:
+		return !val
+	case []byte:
+		return val == nil
+	default:
+		return false
+	}
+}
+
+type integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+type float interface {
+	~float32 | ~float64
+}
+
+// scanFunc adapts a function to sql.Scanner, NULL values leave the destination untouched
+type scanFunc func(src interface{}) error
+
+func (f scanFunc) Scan(src interface{}) error {
+	if src == nil {
+		return nil
+	}
+	return f(src)
+}
+
+func ScanInt[T integer](dest *T) sql.Scanner {
+	return scanFunc(func(src interface{}) error {
+		v, err := cast.ToInt64E(toScalar(src))
+		*dest = T(v)
+		return err
+	})
+}
+
+func ScanFloat[T float](dest *T) sql.Scanner {
+	return scanFunc(func(src interface{}) error {
+		v, err := cast.ToFloat64E(toScalar(src))
+		*dest = T(v)
+		return err
+	})
+}
+
+func ScanString[T ~string](dest *T) sql.Scanner {
+	return scanFunc(func(src interface{}) error {
+		v, err := cast.ToStringE(toScalar(src))
+		*dest = T(v)
+		return err
+	})
+}
+
+func ScanBool(dest *bool) sql.Scanner {
+	return scanFunc(func(src interface{}) error {
+		v, err := cast.ToBoolE(toScalar(src))
+		*dest = v
+		return err
+	})
+}
+
+func ScanBytes(dest *[]byte) sql.Scanner {
+	return scanFunc(func(src interface{}) error {
+		switch v := src.(type) {
+		case []byte:
+			*dest = append([]byte(nil), v...)
+		case string:
+			*dest = []byte(v)
+		default:
+			return fmt.Errorf("unexpected type for bytes: %T", src)
+		}
+		return nil
+	})
+}
+
+func ScanTimestamp(dest **timestamppb.Timestamp) sql.Scanner {
+	return scanFunc(func(src interface{}) error {
+		t, ok := src.(time.Time)
+		if !ok {
+			return fmt.Errorf("unexpected type for timestamp: %T", src)
+		}
+		*dest = timestamppb.New(t)
+		return nil
+	})
+}
+
+func ScanStruct(dest **structpb.Struct) sql.Scanner {
+	return scanFunc(func(src interface{}) error {
+		var mapValue map[string]interface{}
+		switch v := src.(type) {
+		case []byte:
+			if err := json.Unmarshal(v, &mapValue); err != nil {
+				return fmt.Errorf("parsing JSON bytes to map: %v", err)
+			}
+		case string:
+			if err := json.Unmarshal([]byte(v), &mapValue); err != nil {
+				return fmt.Errorf("parsing JSON string to map: %v", err)
+			}
+		default:
+			return fmt.Errorf("unexpected type for Struct: %T", src)
+		}
+
+		pbStruct, err := structpb.NewStruct(mapValue)
+		if err != nil {
+			return fmt.Errorf("converting to protobuf Struct: %v", err)
+		}
+		*dest = pbStruct
+		return nil
+	})
+}
+
+func ScanIntArray[T integer](dest *[]T) sql.Scanner {
+	return scanFunc(func(src interface{}) error {
+		var arr pq.Int64Array
+		if err := arr.Scan(src); err != nil {
+			return err
+		}
+
+		values := make([]T, len(arr))
+		for i, v := range arr {
+			values[i] = T(v)
+		}
+		*dest = values
+		return nil
+	})
+}
+
+func ScanStringArray(dest *[]string) sql.Scanner {
+	return scanFunc(func(src interface{}) error {
+		var arr pq.StringArray
+		if err := arr.Scan(src); err != nil {
+			return err
+		}
+		*dest = arr
+		return nil
+	})
+}
+
+// toScalar converts driver bytes (numeric, text) to string so cast can parse them
+func toScalar(src interface{}) interface{} {
+	if b, ok := src.([]byte); ok {
+		return string(b)
+	}
+	return src
+}
+
+func TimestampValue(ts *timestamppb.Timestamp) interface{} {
+	if ts == nil {
+		return nil
+	}
+	return time.Unix(ts.GetSeconds(), int64(ts.GetNanos()))
+}
+
+func StructValue(st *structpb.Struct) interface{} {
+	if st == nil {
+		return nil
+	}
+	str, _ := st.MarshalJSON()
+	return string(str)
+}
+
+func IntArrayValue[T integer](values []T) interface{} {
+	if values == nil {
+		return nil
+	}
+
+	arr := make(pq.Int64Array, len(values))
+	for i, v := range values {
+		arr[i] = int64(v)
+	}
+	return arr
+}
+
+func StringArrayValue(values []string) interface{} {
+	if values == nil {
+		return nil
+	}
+	return pq.StringArray(values)
+}
@@ -0,0 +1,20 @@
+package dbtool
+
+import (
+	"fmt"
+	"github.com/nhdms/base-go/pkg/common"
+)
+
+// VersionConflictError is returned by SQLTool.Update when the version guard matched no rows
+type VersionConflictError struct {
+	Table   string
+	Version int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%s: table %s, expected version %d", common.SQLConflictError.Error(), e.Table, e.Version)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return common.SQLConflictError
+}
@@ -6,12 +6,14 @@ import (
 	"go-micro.dev/v5/client"
 	"go-micro.dev/v5/metadata"
 	metadata2 "google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"strings"
 )
 
 const (
 	MetadataKeySelectedFields = "selected-fields"
 	MetadataKeyCacheEnable    = "cache-enable"
+	MetadataKeyUpdateFields   = "update-fields"
 )
 
 // WithFieldSelect creates a custom CallOption for field selection
@@ -57,3 +59,28 @@ func GetSelectedFields(ctx context.Context) []string {
 
 	return strings.Split(value, ",")
 }
+
+// WithUpdateFields creates a custom CallOption to limit the columns written by SQLTool.GetUpdateMap
+func WithUpdateFields(fields ...string) client.CallOption {
+	return func(o *client.CallOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = metadata.Set(o.Context, MetadataKeyUpdateFields, strings.Join(fields, ","))
+	}
+}
+
+// WithFieldMask creates a custom CallOption for partial updates from a google.protobuf.FieldMask
+func WithFieldMask(mask *fieldmaskpb.FieldMask) client.CallOption {
+	return WithUpdateFields(mask.GetPaths()...)
+}
+
+// GetUpdateFields helper function to get update fields
+func GetUpdateFields(ctx context.Context) []string {
+	value, ok := GetMetadataFromServer(ctx, MetadataKeyUpdateFields)
+	if !ok || value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
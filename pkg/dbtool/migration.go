@@ -0,0 +1,318 @@
+package dbtool
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/nhdms/base-go/pkg/logger"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Migration files are dbmate compatible: <version>_<name>.sql with "-- migrate:up" and "-- migrate:down" sections.
+// Add "transaction:false" after a marker to run the section outside a transaction (e.g. CREATE INDEX CONCURRENTLY).
+const (
+	MigrationTable       = "schema_migrations"
+	migrationUpMarker    = "-- migrate:up"
+	migrationDownMarker  = "-- migrate:down"
+	migrationNoTxOption  = "transaction:false"
+	migrationVersionTime = "20060102150405"
+	migrationLockPrefix  = "base-go:"
+)
+
+var (
+	migrationFileRegex    = regexp.MustCompile(`^(\d+)_([\w-]+)\.sql$`)
+	migrationServiceRegex = regexp.MustCompile(`[^a-z0-9_]+`)
+)
+
+type Migration struct {
+	Version  string
+	Name     string
+	Path     string
+	Up       string
+	Down     string
+	UpNoTx   bool
+	DownNoTx bool
+	Applied  bool
+}
+
+// Migrator applies the migrations of a directory to a postgres database.
+// Up and Down hold a postgres advisory lock, so only one replica migrates at a time.
+// Applied versions are kept per service, services sharing a database do not skip the versions of each other.
+type Migrator struct {
+	db     *sqlx.DB
+	dir    string
+	table  string
+	dryRun bool
+}
+
+// NewMigrator migrates dir, service is the folder name of the service (e.g. user-service), empty for the root migrations
+func NewMigrator(db *sqlx.DB, dir, service string, dryRun bool) *Migrator {
+	return &Migrator{
+		db:     db,
+		dir:    dir,
+		table:  MigrationTableName(service),
+		dryRun: dryRun,
+	}
+}
+
+// MigrationTableName returns the table of the applied versions of service, schema_migrations_<service>
+// (dbmate --migrations-table), schema_migrations for the root migrations
+func MigrationTableName(service string) string {
+	service = strings.Trim(migrationServiceRegex.ReplaceAllString(strings.ToLower(service), "_"), "_")
+	if len(service) == 0 {
+		return MigrationTable
+	}
+	return MigrationTable + "_" + service
+}
+
+// NewMigrationFile creates an empty migration file in dir and returns its path
+func NewMigrationFile(dir, name string) (string, error) {
+	name = strings.ReplaceAll(strings.TrimSpace(name), " ", "_")
+	fileName := fmt.Sprintf("%s_%s.sql", time.Now().UTC().Format(migrationVersionTime), name)
+	if !migrationFileRegex.MatchString(fileName) {
+		return "", fmt.Errorf("invalid migration name %s", name)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, fileName)
+	content := migrationUpMarker + "\n\n\n" + migrationDownMarker + "\n\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// LoadMigrations reads the migration files of dir sorted by version
+func LoadMigrations(dir string) ([]*Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []*Migration
+	for _, entry := range entries {
+		matches := migrationFileRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, err := parseMigration(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		migration.Version = matches[1]
+		migration.Name = matches[2]
+		migration.Path = path
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %s", migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+func parseMigration(content string) (*Migration, error) {
+	upIdx := strings.Index(content, migrationUpMarker)
+	if upIdx < 0 {
+		return nil, fmt.Errorf("missing %q", migrationUpMarker)
+	}
+
+	m := &Migration{}
+	up := content[upIdx:]
+	if downIdx := strings.Index(up, migrationDownMarker); downIdx >= 0 {
+		m.Down, m.DownNoTx = parseMigrationSection(up[downIdx:])
+		up = up[:downIdx]
+	}
+	m.Up, m.UpNoTx = parseMigrationSection(up)
+	return m, nil
+}
+
+// parseMigrationSection strips the marker line and returns the statements and whether the transaction is disabled
+func parseMigrationSection(section string) (string, bool) {
+	marker, body, _ := strings.Cut(section, "\n")
+	return strings.TrimSpace(body), strings.Contains(marker, migrationNoTxOption)
+}
+
+// Status returns all migrations of the directory with their applied state
+func (m *Migrator) Status(ctx context.Context) ([]*Migration, error) {
+	migrations, err := LoadMigrations(m.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := m.getAppliedVersions(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range migrations {
+		migration.Applied = applied[migration.Version]
+	}
+	return migrations, nil
+}
+
+// Up applies all pending migrations and returns them, in dry-run mode the statements are only logged
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	var done []*Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		migrations, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if migration.Applied {
+				continue
+			}
+
+			err = m.exec(ctx, conn, migration.Up, migration.UpNoTx,
+				fmt.Sprintf("INSERT INTO %s (version) VALUES ($1)", m.table), migration.Version)
+			if err != nil {
+				return fmt.Errorf("migration %s_%s failed: %w", migration.Version, migration.Name, err)
+			}
+
+			logger.DefaultLogger.Infof("Applied migration %s_%s (dry run: %v)", migration.Version, migration.Name, m.dryRun)
+			migration.Applied = !m.dryRun
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the latest applied migration, it returns nil if there is nothing to roll back
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var done *Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		migrations, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && done == nil; i-- {
+			if migrations[i].Applied {
+				done = migrations[i]
+			}
+		}
+
+		if done == nil {
+			return nil
+		}
+
+		if len(done.Down) == 0 {
+			return fmt.Errorf("migration %s_%s has no down section", done.Version, done.Name)
+		}
+
+		err = m.exec(ctx, conn, done.Down, done.DownNoTx,
+			fmt.Sprintf("DELETE FROM %s WHERE version = $1", m.table), done.Version)
+		if err != nil {
+			return fmt.Errorf("rollback %s_%s failed: %w", done.Version, done.Name, err)
+		}
+
+		logger.DefaultLogger.Infof("Rolled back migration %s_%s (dry run: %v)", done.Version, done.Name, m.dryRun)
+		done.Applied = m.dryRun
+		return nil
+	})
+	return done, err
+}
+
+// exec runs the statements of a migration and records the version with versionQuery
+func (m *Migrator) exec(ctx context.Context, conn *sqlx.Conn, statements string, noTx bool, versionQuery string, version string) error {
+	if m.dryRun {
+		logger.DefaultLogger.Infof("[dry run] %s\n[dry run] %s -- %s", statements, versionQuery, version)
+		return nil
+	}
+
+	if noTx {
+		if _, err := conn.ExecContext(ctx, statements); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, versionQuery, version)
+		return err
+	}
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, statements); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, versionQuery, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// withLock runs fn on a dedicated connection holding the migration advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dryRun {
+		return fn(conn)
+	}
+
+	// blocks until the replica holding the lock finishes, its migrations are then seen as applied
+	lockKey := migrationLockPrefix + m.table
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", lockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", lockKey)
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version VARCHAR(128) PRIMARY KEY)", m.table))
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (m *Migrator) getAppliedVersions(ctx context.Context, db sqlx.QueryerContext) (map[string]bool, error) {
+	// the table does not exist before the first migration or in dry-run mode
+	var table sql.NullString
+	err := sqlx.GetContext(ctx, db, &table, "SELECT to_regclass($1)::text", m.table)
+	if err != nil || !table.Valid {
+		return map[string]bool{}, err
+	}
+
+	var versions []string
+	err = sqlx.SelectContext(ctx, db, &versions, fmt.Sprintf("SELECT version FROM %s", m.table))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make(map[string]bool, len(versions))
+	for _, v := range versions {
+		resp[v] = true
+	}
+	return resp, nil
+}
@@ -0,0 +1,50 @@
+package dbtool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"20240102000000_add_index.sql":    "-- migrate:up transaction:false\nCREATE INDEX CONCURRENTLY idx ON users (name);\n\n-- migrate:down\nDROP INDEX idx;\n",
+		"20240101000000_create_users.sql": "-- migrate:up\nCREATE TABLE users (id BIGSERIAL);\n",
+		"readme.md":                       "not a migration",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 2 || migrations[0].Name != "create_users" || migrations[1].Name != "add_index" {
+		t.Fatalf("unexpected migrations %+v", migrations)
+	}
+
+	if migrations[0].Up != "CREATE TABLE users (id BIGSERIAL);" || migrations[0].Down != "" || migrations[0].UpNoTx {
+		t.Fatalf("unexpected migration %+v", migrations[0])
+	}
+
+	if !migrations[1].UpNoTx || migrations[1].DownNoTx || migrations[1].Down != "DROP INDEX idx;" {
+		t.Fatalf("unexpected migration %+v", migrations[1])
+	}
+}
+
+func TestMigrationTableName(t *testing.T) {
+	for service, table := range map[string]string{
+		"":              "schema_migrations",
+		"user-service":  "schema_migrations_user_service",
+		"Audit-Service": "schema_migrations_audit_service",
+	} {
+		if got := MigrationTableName(service); got != table {
+			t.Fatalf("expected table %s of service %q, got %s", table, service, got)
+		}
+	}
+}
@@ -13,7 +13,7 @@ import (
 )
 
 // ScanRow scans a row into any struct or proto message
-// ScanRow scans a row into any struct or proto message
+// the generated codec of dest is used when registered, reflection otherwise
 func ScanRow(row sqlx.ColScanner, dest interface{}) error {
 	// Get column names
 	cols, err := row.Columns()
@@ -21,6 +21,12 @@ func ScanRow(row sqlx.ColScanner, dest interface{}) error {
 		return err
 	}
 
+	if codec := getModelCodec(dest); codec != nil {
+		if targets := codec.ScanTargets(dest, cols); targets != nil {
+			return row.Scan(targets...)
+		}
+	}
+
 	// Create slice of interfaces to scan into
 	values := make([]interface{}, len(cols))
 	for i := range values {
@@ -0,0 +1,243 @@
+package dbtool
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/nhdms/base-go/pkg/utils"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type SchemaIssueKind string
+
+const (
+	SchemaIssueMissingTable  SchemaIssueKind = "missing_table"
+	SchemaIssueMissingColumn SchemaIssueKind = "missing_column"
+	SchemaIssueTypeMismatch  SchemaIssueKind = "type_mismatch"
+	SchemaIssueNullability   SchemaIssueKind = "nullability"
+)
+
+// SchemaIssue is a difference between a table definition (Table + model) and the live database
+type SchemaIssue struct {
+	Table   string
+	Column  string
+	Kind    SchemaIssueKind
+	Message string
+}
+
+func (i SchemaIssue) String() string {
+	if len(i.Column) == 0 {
+		return fmt.Sprintf("[%s] %s: %s", i.Kind, i.Table, i.Message)
+	}
+	return fmt.Sprintf("[%s] %s.%s: %s", i.Kind, i.Table, i.Column, i.Message)
+}
+
+type dbColumn struct {
+	// both tags are set, connections of ConnectionManager map columns by json tag
+	Name       string         `db:"column_name" json:"column_name"`
+	DataType   string         `db:"data_type" json:"data_type"`
+	UdtName    string         `db:"udt_name" json:"udt_name"`
+	IsNullable string         `db:"is_nullable" json:"is_nullable"`
+	Default    sql.NullString `db:"column_default" json:"column_default"`
+}
+
+type registeredTable struct {
+	table *Table
+	model interface{}
+}
+
+var (
+	registeredTablesMu sync.RWMutex
+	registeredTables   = make(map[string]registeredTable)
+)
+
+// RegisterTable registers a table with its model for schema checks, generated tables register themselves in init()
+func RegisterTable(table *Table, model interface{}) {
+	registeredTablesMu.Lock()
+	defer registeredTablesMu.Unlock()
+	registeredTables[table.Name] = registeredTable{table: table, model: model}
+}
+
+// NewRegisteredModel returns a new instance of the model registered for table, e.g. *models.User for "users"
+func NewRegisteredModel(table string) (interface{}, bool) {
+	registeredTablesMu.RLock()
+	t, ok := registeredTables[table]
+	registeredTablesMu.RUnlock()
+	if !ok || t.model == nil {
+		return nil, false
+	}
+
+	typ := reflect.TypeOf(t.model)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return reflect.New(typ).Interface(), true
+}
+
+// CheckSchema checks all registered tables against the database schema (default public)
+func CheckSchema(ctx context.Context, db *sqlx.DB, schema string) ([]SchemaIssue, error) {
+	registeredTablesMu.RLock()
+	names := make([]string, 0, len(registeredTables))
+	for name := range registeredTables {
+		names = append(names, name)
+	}
+	registeredTablesMu.RUnlock()
+	sort.Strings(names)
+
+	var issues []SchemaIssue
+	for _, name := range names {
+		registeredTablesMu.RLock()
+		t := registeredTables[name]
+		registeredTablesMu.RUnlock()
+
+		tableIssues, err := CheckTableSchema(ctx, db, schema, t.table, t.model)
+		if err != nil {
+			return nil, fmt.Errorf("check table %s: %w", name, err)
+		}
+		issues = append(issues, tableIssues...)
+	}
+	return issues, nil
+}
+
+// CheckTableSchema compares the columns SQLTool generates for table and model with information_schema.
+// It reports missing columns, Go types that cannot hold the column type, and NOT NULL columns
+// that would receive NULL because they have neither a database default nor a NotNullColumns default.
+func CheckTableSchema(ctx context.Context, db *sqlx.DB, schema string, table *Table, model interface{}) ([]SchemaIssue, error) {
+	tableName := table.Name
+	if before, after, found := strings.Cut(tableName, "."); found {
+		schema, tableName = before, after
+	}
+	if len(schema) == 0 {
+		schema = "public"
+	}
+
+	var columns []dbColumn
+	err := db.SelectContext(ctx, &columns, `SELECT column_name, data_type, udt_name, is_nullable, column_default
+		FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2`, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(columns) == 0 {
+		return []SchemaIssue{{Table: table.Name, Kind: SchemaIssueMissingTable, Message: fmt.Sprintf("table not found in schema %s", schema)}}, nil
+	}
+
+	dbColumns := make(map[string]dbColumn, len(columns))
+	for _, c := range columns {
+		dbColumns[c.Name] = c
+	}
+
+	var issues []SchemaIssue
+	// a select tool is used to get exactly the columns and types SQLTool queries
+	s := NewSelect(ctx, nil, table, model)
+	modelColumns := make(map[string]bool, len(s.columns))
+	for _, column := range s.columns {
+		name := unquoteColumn(column)
+		modelColumns[name] = true
+
+		c, ok := dbColumns[name]
+		if !ok {
+			issues = append(issues, SchemaIssue{Table: table.Name, Column: name, Kind: SchemaIssueMissingColumn,
+				Message: fmt.Sprintf("field %s has no column, add the column or put it in IgnoreColumns", s.column2name[column])})
+			continue
+		}
+
+		if typ := s.column2type[column]; !isCompatibleColumnType(typ, c) {
+			issues = append(issues, SchemaIssue{Table: table.Name, Column: name, Kind: SchemaIssueTypeMismatch,
+				Message: fmt.Sprintf("field %s (%s) is not compatible with %s", s.column2name[column], typ, c.DataType)})
+		}
+
+		if c.IsNullable == "NO" && !c.Default.Valid && !utils.StringSliceContains(table.AIColumns, name) && !hasNotNullDefault(table, column, name) {
+			issues = append(issues, SchemaIssue{Table: table.Name, Column: name, Kind: SchemaIssueNullability,
+				Message: "column is NOT NULL without default, zero values are written as NULL, add it to NotNullColumns"})
+		}
+	}
+
+	for _, c := range columns {
+		if modelColumns[c.Name] || c.IsNullable != "NO" || c.Default.Valid || isIgnoredColumn(table, c.Name) {
+			continue
+		}
+		issues = append(issues, SchemaIssue{Table: table.Name, Column: c.Name, Kind: SchemaIssueNullability,
+			Message: "column is NOT NULL without default but not in the model, inserts will fail"})
+	}
+	return issues, nil
+}
+
+func unquoteColumn(column string) string {
+	if len(column) > 1 && column[0] == '"' && column[len(column)-1] == '"' {
+		return column[1 : len(column)-1]
+	}
+	return strings.ToLower(column)
+}
+
+func isIgnoredColumn(table *Table, column string) bool {
+	for _, c := range table.IgnoreColumns {
+		if unquoteColumn(c) == column {
+			return true
+		}
+	}
+	return false
+}
+
+func hasNotNullDefault(table *Table, columns ...string) bool {
+	for _, c := range columns {
+		if _, ok := table.NotNullColumns[c]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	intColumnTypes       = []string{"smallint", "integer", "bigint", "numeric"}
+	floatColumnTypes     = []string{"real", "double precision", "numeric"}
+	stringColumnTypes    = []string{"text", "character varying", "character", "uuid", "json", "jsonb", "inet", "USER-DEFINED"}
+	timestampColumnTypes = []string{"timestamp without time zone", "timestamp with time zone", "date"}
+	jsonColumnTypes      = []string{"json", "jsonb"}
+	intArrayUdtNames     = []string{"_int2", "_int4", "_int8", "_numeric"}
+	stringArrayUdtNames  = []string{"_text", "_varchar", "_bpchar", "_uuid"}
+)
+
+func isCompatibleColumnType(typ reflect.Type, c dbColumn) bool {
+	if typ == nil {
+		return true
+	}
+
+	switch typ {
+	case reflect.TypeOf(&timestamppb.Timestamp{}):
+		return utils.StringSliceContains(timestampColumnTypes, c.DataType)
+	case reflect.TypeOf(&structpb.Struct{}):
+		return utils.StringSliceContains(jsonColumnTypes, c.DataType)
+	}
+
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return utils.StringSliceContains(intColumnTypes, c.DataType)
+	case reflect.Float32, reflect.Float64:
+		return utils.StringSliceContains(floatColumnTypes, c.DataType)
+	case reflect.String:
+		return utils.StringSliceContains(stringColumnTypes, c.DataType)
+	case reflect.Bool:
+		return c.DataType == "boolean"
+	case reflect.Slice:
+		switch typ.Elem().Kind() {
+		case reflect.Uint8:
+			return c.DataType == "bytea"
+		case reflect.String:
+			return utils.StringSliceContains(stringArrayUdtNames, c.UdtName) || utils.StringSliceContains(jsonColumnTypes, c.DataType)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return utils.StringSliceContains(intArrayUdtNames, c.UdtName) || utils.StringSliceContains(jsonColumnTypes, c.DataType)
+		}
+	}
+
+	// other types are written as is, let the database decide
+	return true
+}
@@ -0,0 +1,37 @@
+package dbtool
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestIsCompatibleColumnType(t *testing.T) {
+	cases := []struct {
+		typ        reflect.Type
+		column     dbColumn
+		compatible bool
+	}{
+		{reflect.TypeOf(int64(0)), dbColumn{DataType: "bigint"}, true},
+		{reflect.TypeOf(int64(0)), dbColumn{DataType: "text"}, false},
+		{reflect.TypeOf(""), dbColumn{DataType: "character varying"}, true},
+		{reflect.TypeOf(false), dbColumn{DataType: "integer"}, false},
+		{reflect.TypeOf(&timestamppb.Timestamp{}), dbColumn{DataType: "timestamp with time zone"}, true},
+		{reflect.TypeOf(&timestamppb.Timestamp{}), dbColumn{DataType: "bigint"}, false},
+		{reflect.TypeOf([]string{}), dbColumn{DataType: "ARRAY", UdtName: "_varchar"}, true},
+		{reflect.TypeOf([]int64{}), dbColumn{DataType: "ARRAY", UdtName: "_text"}, false},
+	}
+
+	for _, c := range cases {
+		if isCompatibleColumnType(c.typ, c.column) != c.compatible {
+			t.Errorf("%s with %s/%s: expected compatible=%v", c.typ, c.column.DataType, c.column.UdtName, c.compatible)
+		}
+	}
+}
+
+func TestUnquoteColumn(t *testing.T) {
+	if unquoteColumn(`"saleChannel"`) != "saleChannel" || unquoteColumn("Name") != "name" {
+		t.Fatal("unexpected unquoted column")
+	}
+}
@@ -0,0 +1,103 @@
+package dbtool
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/goccy/go-json"
+	"github.com/nhdms/base-go/pkg/common"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+	"github.com/spf13/cast"
+)
+
+// ScopeColumns are the columns of a table restricted to the scope of the caller, empty columns are not scoped
+type ScopeColumns struct {
+	Project string // project_id of a data set of the caller
+	Country string // country_id of a data set of the caller
+	Owner   string // the caller or one of its sub users
+}
+
+func (c ScopeColumns) IsEmpty() bool {
+	return len(c.Project) == 0 && len(c.Country) == 0 && len(c.Owner) == 0
+}
+
+// Scope is the caller of a gRPC request, forwarded by the gateway in the X-AT-* metadata
+type Scope struct {
+	UserID     int64
+	SubUserIDs []int64
+	DataSets   []*models.JWTDataSet
+}
+
+type scopeBypassKey struct{}
+
+// WithoutScope lets the SQL tools of ctx skip the scope of the caller, for system jobs (consumers, schedulers, migrations).
+// It is a context value, so it can not be sent by a caller.
+func WithoutScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scopeBypassKey{}, true)
+}
+
+func isScopeBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(scopeBypassKey{}).(bool)
+	return bypass
+}
+
+// GetScope returns the scope of the caller from the incoming metadata, false if the request has no caller
+func GetScope(ctx context.Context) (*Scope, bool) {
+	userID, ok := GetMetadataFromServer(ctx, common.HeaderUserId)
+	if !ok || cast.ToInt64(userID) < 1 {
+		return nil, false
+	}
+
+	scope := &Scope{UserID: cast.ToInt64(userID)}
+	if subUserIDs, ok := GetMetadataFromServer(ctx, common.HeaderChildUserIds); ok && len(subUserIDs) > 0 {
+		_ = json.Unmarshal([]byte(subUserIDs), &scope.SubUserIDs)
+	}
+	if dataSets, ok := GetMetadataFromServer(ctx, common.HeaderDataSets); ok && len(dataSets) > 0 {
+		_ = json.Unmarshal([]byte(dataSets), &scope.DataSets)
+	}
+	return scope, true
+}
+
+// scopeCondition is the WHERE condition of the scope columns of the table for the caller of ctx, nil when the table
+// is not scoped or the scope is bypassed. A scoped table without caller is an error.
+func (s *SQLTool) scopeCondition(ctx context.Context) (squirrel.Sqlizer, error) {
+	if s.table == nil || s.table.ScopeColumns.IsEmpty() || isScopeBypassed(ctx) {
+		return nil, nil
+	}
+
+	scope, ok := GetScope(ctx)
+	if !ok {
+		return nil, fmt.Errorf("%w: table %s is scoped, the request has no caller", common.UnauthorizedError, s.table.Name)
+	}
+
+	columns := s.table.ScopeColumns
+	column := func(name string) string {
+		if len(s.alias) == 0 {
+			return name
+		}
+		return s.alias + "." + name
+	}
+
+	condition := squirrel.And{}
+	if len(columns.Owner) > 0 {
+		condition = append(condition, squirrel.Eq{column(columns.Owner): append([]int64{scope.UserID}, scope.SubUserIDs...)})
+	}
+
+	if len(columns.Project) > 0 || len(columns.Country) > 0 {
+		// no data set, no row
+		dataSets := squirrel.Or{squirrel.Expr("1 = 0")}
+		for _, dataSet := range scope.DataSets {
+			match := squirrel.Eq{}
+			if len(columns.Project) > 0 {
+				match[column(columns.Project)] = dataSet.GetProjectId()
+			}
+			if len(columns.Country) > 0 {
+				match[column(columns.Country)] = dataSet.GetCountryId()
+			}
+			dataSets = append(dataSets, match)
+		}
+		condition = append(condition, dataSets)
+	}
+	return condition, nil
+}
@@ -3,9 +3,11 @@ package dbtool
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"github.com/Masterminds/squirrel"
 	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/jmoiron/sqlx"
+	"github.com/nhdms/base-go/pkg/common"
 	"github.com/nhdms/base-go/pkg/logger"
 	"github.com/nhdms/base-go/pkg/utils"
 	"github.com/nhdms/base-go/proto/exmsg/models"
@@ -37,6 +39,11 @@ type SQLTool struct {
 	column2type map[string]reflect.Type
 	column2name map[string]string
 	tx          *sqlx.Tx
+	// expected version captured by GetUpdateMap, used as WHERE guard in Update
+	lockVersion int64
+	codec       *ModelCodec
+	// alias of the table given to GetTable, it qualifies the scope columns
+	alias string
 }
 
 func New(ctx context.Context, db *sqlx.DB, table *Table, model interface{}, kind string) *SQLTool {
@@ -88,6 +95,7 @@ func (s *SQLTool) CommitTransactions() error {
 }
 
 func (s *SQLTool) GetTable(alias string) string {
+	s.alias = alias
 	if len(alias) == 0 {
 		return s.table.Name
 	}
@@ -108,7 +116,17 @@ func (s *SQLTool) GetQueryColumnList(alias string) []string {
 }
 
 func (s *SQLTool) GetFilledValues(item interface{}) []interface{} {
-	values := make([]interface{}, len(s.columns))
+	return s.fillValues(item, s.columns, false)
+}
+
+// fillValues returns the SQL values of the columns of item. Zero values are written as NULL or the NotNullColumns
+// default, unless keepZero is set for the fields named by an update mask, which are written as they are.
+func (s *SQLTool) fillValues(item interface{}, columns []string, keepZero bool) []interface{} {
+	if s.codec != nil {
+		return s.fillCodecValues(item, columns, keepZero)
+	}
+
+	values := make([]interface{}, len(columns))
 	val := reflect.ValueOf(item)
 
 	if val.Kind() == reflect.Ptr {
@@ -119,7 +137,7 @@ func (s *SQLTool) GetFilledValues(item interface{}) []interface{} {
 		return values
 	}
 
-	for i, column := range s.columns {
+	for i, column := range columns {
 		field, found := s.column2name[column]
 		if !found {
 			if defaultVal, hasDefault := s.table.NotNullColumns[column]; hasDefault {
@@ -139,6 +157,10 @@ func (s *SQLTool) GetFilledValues(item interface{}) []interface{} {
 
 		// Handle nil pointers for not null columns
 		if fieldValue.Kind() == reflect.Ptr && fieldValue.IsNil() {
+			if keepZero {
+				values[i] = nil
+				continue
+			}
 			if defaultVal, hasDefault := s.table.NotNullColumns[column]; hasDefault {
 				if fn, ok := defaultVal.(func() interface{}); ok {
 					values[i] = fn()
@@ -178,7 +200,7 @@ func (s *SQLTool) GetFilledValues(item interface{}) []interface{} {
 			}
 
 			// Check for zero value in not null column
-			if defaultVal, hasDefault := s.table.NotNullColumns[column]; hasDefault {
+			if defaultVal, hasDefault := s.table.NotNullColumns[column]; hasDefault && !keepZero {
 				if reflect.DeepEqual(fieldValue.Interface(), reflect.Zero(fieldValue.Type()).Interface()) {
 					if fn, ok := defaultVal.(func() interface{}); ok {
 						values[i] = fn()
@@ -207,7 +229,7 @@ func (s *SQLTool) GetFilledValues(item interface{}) []interface{} {
 				isZero = reflect.DeepEqual(fieldValue.Interface(), reflect.Zero(fieldValue.Type()).Interface())
 			}
 
-			if isZero {
+			if isZero && !keepZero {
 				if defaultVal, hasDefault := s.table.NotNullColumns[column]; hasDefault {
 					if fn, ok := defaultVal.(func() interface{}); ok {
 						values[i] = fn()
@@ -228,6 +250,14 @@ func (s *SQLTool) GetFilledValues(item interface{}) []interface{} {
 }
 
 func (s *SQLTool) Get(ctx context.Context, dest interface{}, qb squirrel.SelectBuilder) error {
+	scope, err := s.scopeCondition(ctx)
+	if err != nil {
+		return err
+	}
+	if scope != nil {
+		qb = qb.Where(scope)
+	}
+
 	qb = qb.PlaceholderFormat(squirrel.Dollar)
 	query, args, err := qb.ToSql()
 	if err != nil {
@@ -249,6 +279,14 @@ func (s *SQLTool) Get(ctx context.Context, dest interface{}, qb squirrel.SelectB
 }
 
 func (s *SQLTool) Select(ctx context.Context, dest interface{}, qb squirrel.SelectBuilder) error {
+	scope, err := s.scopeCondition(ctx)
+	if err != nil {
+		return err
+	}
+	if scope != nil {
+		qb = qb.Where(scope)
+	}
+
 	qb = qb.PlaceholderFormat(squirrel.Dollar)
 	query, args, err := qb.ToSql()
 	if err != nil {
@@ -273,6 +311,32 @@ func (s *SQLTool) Select(ctx context.Context, dest interface{}, qb squirrel.Sele
 	return ScanAll(rows, dest)
 }
 
+// fillCodecValues is the reflection-free version of GetFilledValues using the generated codec
+func (s *SQLTool) fillCodecValues(item interface{}, columns []string, keepZero bool) []interface{} {
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		var value interface{}
+		if field, found := s.column2name[column]; found {
+			value, _ = s.codec.Value(item, field)
+		}
+
+		if keepZero || !isZeroValue(value) {
+			values[i] = value
+			continue
+		}
+
+		if defaultVal, hasDefault := s.table.NotNullColumns[column]; hasDefault {
+			if fn, ok := defaultVal.(func() interface{}); ok {
+				values[i] = fn()
+			} else {
+				values[i] = defaultVal
+			}
+		}
+	}
+
+	return values
+}
+
 func (s *SQLTool) parseColumns(model interface{}) {
 	column2kind := make(map[string]reflect.Kind)
 	column2type := make(map[string]reflect.Type)
@@ -280,38 +344,48 @@ func (s *SQLTool) parseColumns(model interface{}) {
 	columns := make([]string, 0)
 	ignoreColumns := s.getIgnoreColumns()
 
-	val := reflect.ValueOf(model)
-	if val.Kind() == reflect.Ptr {
-		val = val.Elem()
-	}
-
-	typ := val.Type()
-	for i := 0; i < typ.NumField(); i++ {
-		field := typ.Field(i)
-
-		// Skip unexported fields and protobuf internal fields
-		if !field.IsExported() || field.Name == "state" || field.Name == "sizeCache" || field.Name == "unknownFields" {
-			continue
-		}
-
-		// Get column name from json tag
-		jsonTag := field.Tag.Get("json")
-		if jsonTag == "" || jsonTag == "-" {
-			continue
-		}
-		columnName := strings.Split(jsonTag, ",")[0]
-
+	addColumn := func(columnName, fieldName string, fieldType reflect.Type) {
 		if ignoreColumns[columnName] {
-			continue
+			return
 		}
 		if v, ok := s.table.ColumnMapper[columnName]; ok && len(v) > 0 {
 			columnName = v
 		}
 		// Add to mappings
 		columns = append(columns, columnName)
-		column2kind[columnName] = field.Type.Kind()
-		column2type[columnName] = field.Type
-		column2name[columnName] = field.Name
+		column2kind[columnName] = fieldType.Kind()
+		column2type[columnName] = fieldType
+		column2name[columnName] = fieldName
+	}
+
+	s.codec = getModelCodec(model)
+	if s.codec != nil {
+		for _, f := range s.codec.Fields {
+			addColumn(f.Column, f.Name, s.codec.types[f.Name])
+		}
+	} else {
+		val := reflect.ValueOf(model)
+		if val.Kind() == reflect.Ptr {
+			val = val.Elem()
+		}
+
+		typ := val.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+
+			// Skip unexported fields and protobuf internal fields
+			if !field.IsExported() || field.Name == "state" || field.Name == "sizeCache" || field.Name == "unknownFields" {
+				continue
+			}
+
+			// Get column name from json tag
+			jsonTag := field.Tag.Get("json")
+			if jsonTag == "" || jsonTag == "-" {
+				continue
+			}
+
+			addColumn(strings.Split(jsonTag, ",")[0], field.Name, field.Type)
+		}
 	}
 
 	md, ok := metadata2.FromIncomingContext(s.ctx)
@@ -366,12 +440,44 @@ func (s *SQLTool) Insert(ctx context.Context, qb squirrel.InsertBuilder) (*model
 }
 
 func (s *SQLTool) Update(ctx context.Context, qb squirrel.UpdateBuilder) (*models.SQLResult, error) {
+	scope, err := s.scopeCondition(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if scope != nil {
+		qb = qb.Where(scope)
+	}
+
 	qb = qb.PlaceholderFormat(squirrel.Dollar)
-	qb = qb.PlaceholderFormat(squirrel.Dollar)
-	return s.execContext(ctx, qb)
+	guarded := s.lockVersion > 0
+	// the bypass is read from the ctx of NewUpdate like in GetUpdateMap, not from ctx
+	if !guarded && s.table != nil && len(s.table.VersionColumn) > 0 && !isVersionCheckSkipped(s.ctx) {
+		return nil, s.missingVersionError()
+	}
+	if guarded {
+		qb = qb.Where(squirrel.Eq{s.table.VersionColumn: s.lockVersion})
+	}
+
+	v, err := s.execContext(ctx, qb)
+	if err != nil {
+		return nil, err
+	}
+
+	if guarded && v.RowsAffected == 0 {
+		return nil, &VersionConflictError{Table: s.table.Name, Version: s.lockVersion}
+	}
+	return v, nil
 }
 
 func (s *SQLTool) Delete(ctx context.Context, qb squirrel.DeleteBuilder) (*models.SQLResult, error) {
+	scope, err := s.scopeCondition(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if scope != nil {
+		qb = qb.Where(scope)
+	}
+
 	qb = qb.PlaceholderFormat(squirrel.Dollar)
 	return s.execContext(ctx, qb)
 }
@@ -434,24 +540,169 @@ func (s *SQLTool) PrepareSelect(ctx context.Context, table *Table, model interfa
 
 func (s *SQLTool) prepare(ctx context.Context, table *Table, model interface{}, kind string) {
 	s.kind = kind
+	s.lockVersion = 0
+	s.alias = ""
 	s.table = table
 	s.defineDefaultValues()
 	s.parseColumns(model)
 }
 
-func (s *SQLTool) GetUpdateMap(dest interface{}, updateFields ...string) map[string]interface{} {
-	m := make(map[string]interface{})
-	val := s.GetFilledValues(dest)
+// GetUpdateMap builds the SET map of an update from dest.
+// Columns are limited to updateFields, or to the fields sent by WithUpdateFields/WithFieldMask when updateFields is empty.
+// Fields are proto json names, they are mapped through ColumnMapper and rejected if unknown or ignored.
+func (s *SQLTool) GetUpdateMap(dest interface{}, updateFields ...string) (map[string]interface{}, error) {
+	if len(updateFields) == 0 {
+		updateFields = GetUpdateFields(s.ctx)
+	}
 
 	cols := s.columns
 	if len(updateFields) > 0 {
-		cols = updateFields
+		var err error
+		cols, err = s.getUpdateColumns(updateFields)
+		if err != nil {
+			return nil, err
+		}
 	}
+
+	// fields of the update mask are set to their value, zero values included, e.g. to clear a status
+	m := make(map[string]interface{})
+	val := s.fillValues(dest, cols, len(updateFields) > 0)
 	for i, c := range cols {
 		m[c] = val[i]
 	}
 
-	return m
+	if s.hasVersionColumn() {
+		// always bump the version, guard with the version the caller has read
+		s.lockVersion = s.getVersion(dest)
+		if s.lockVersion < 1 && !isVersionCheckSkipped(s.ctx) {
+			return nil, s.missingVersionError()
+		}
+		m[s.table.VersionColumn] = squirrel.Expr(s.table.VersionColumn + " + 1")
+	}
+
+	return m, nil
+}
+
+// getUpdateColumns validates update fields against the parsed model and returns their column names
+func (s *SQLTool) getUpdateColumns(fields []string) ([]string, error) {
+	notUpdatable := make(map[string]bool)
+	for _, c := range s.table.IgnoreColumns {
+		notUpdatable[c] = true
+	}
+	for _, c := range s.table.AIColumns {
+		notUpdatable[c] = true
+	}
+
+	seen := make(map[string]bool)
+	cols := make([]string, 0, len(fields))
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		if len(f) == 0 {
+			continue
+		}
+
+		column := f
+		if v, ok := s.table.ColumnMapper[f]; ok && len(v) > 0 {
+			column = v
+		}
+
+		if notUpdatable[f] || notUpdatable[column] {
+			return nil, fmt.Errorf("%w: %s can not be updated", common.SQLInvalidFieldError, f)
+		}
+
+		typ, ok := s.column2type[column]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown field %s", common.SQLInvalidFieldError, f)
+		}
+
+		if !isUpdatableType(typ) {
+			return nil, fmt.Errorf("%w: unsupported type %s of field %s", common.SQLInvalidFieldError, typ, f)
+		}
+
+		if seen[column] {
+			continue
+		}
+		seen[column] = true
+		cols = append(cols, column)
+	}
+
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("%w: no field to update", common.SQLInvalidFieldError)
+	}
+
+	return cols, nil
+}
+
+// isUpdatableType reports whether GetFilledValues can produce a SQL value for a field of type typ
+func isUpdatableType(typ reflect.Type) bool {
+	switch typ {
+	case reflect.TypeOf(&timestamppb.Timestamp{}), reflect.TypeOf(&structpb.Struct{}):
+		return true
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return typ.Elem().Kind() != reflect.Struct && isUpdatableType(typ.Elem())
+	case reflect.Slice:
+		return typ.Elem().Kind() != reflect.Ptr && isUpdatableType(typ.Elem())
+	case reflect.Map, reflect.Chan, reflect.Func, reflect.Interface, reflect.UnsafePointer,
+		reflect.Complex64, reflect.Complex128, reflect.Struct:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *SQLTool) hasVersionColumn() bool {
+	if s.table == nil || len(s.table.VersionColumn) == 0 {
+		return false
+	}
+
+	_, ok := s.column2name[s.table.VersionColumn]
+	return ok
+}
+
+type versionCheckBypassKey struct{}
+
+// WithoutVersionCheck lets the SQL tools of ctx update versioned tables without the version read by the caller,
+// the last update wins. Updates of versioned tables are rejected without version otherwise.
+// The bypass applies to the SQL tool created with ctx (NewUpdate, NewTransaction), the ctx given to Update is ignored.
+func WithoutVersionCheck(ctx context.Context) context.Context {
+	return context.WithValue(ctx, versionCheckBypassKey{}, true)
+}
+
+func isVersionCheckSkipped(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	skip, _ := ctx.Value(versionCheckBypassKey{}).(bool)
+	return skip
+}
+
+func (s *SQLTool) missingVersionError() error {
+	return fmt.Errorf("%w: %s is required to update %s", common.SQLInvalidFieldError, s.table.VersionColumn, s.table.Name)
+}
+
+// getVersion reads the version field of dest, returns 0 if it is missing or not an integer
+func (s *SQLTool) getVersion(dest interface{}) int64 {
+	val := reflect.ValueOf(dest)
+	if val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+
+	if val.Kind() != reflect.Struct {
+		return 0
+	}
+
+	field := val.FieldByName(s.column2name[s.table.VersionColumn])
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return field.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(field.Uint())
+	default:
+		return 0
+	}
 }
 
 func (s *SQLTool) defineDefaultValues() {
@@ -469,6 +720,12 @@ func (s *SQLTool) defineDefaultValues() {
 			s.table.NotNullColumns[c] = func() interface{} { return time.Now() }
 		}
 	}
+
+	if len(s.table.VersionColumn) > 0 {
+		if _, ok := s.table.NotNullColumns[s.table.VersionColumn]; !ok {
+			s.table.NotNullColumns[s.table.VersionColumn] = 1
+		}
+	}
 }
 
 func (s *SQLTool) filterColumns(columns []string) []string {
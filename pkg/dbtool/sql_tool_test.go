@@ -0,0 +1,239 @@
+package dbtool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/nhdms/base-go/pkg/common"
+	"google.golang.org/grpc/metadata"
+)
+
+type versionedModel struct {
+	Id          int64    `json:"id,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Version     int64    `json:"version,omitempty"`
+	SaleChannel []string `json:"saleChannel,omitempty"`
+	Secret      string   `json:"secret,omitempty"`
+}
+
+func getVersionedTable() *Table {
+	return &Table{
+		Name:          "items",
+		AIColumns:     []string{"id"},
+		VersionColumn: "version",
+		ColumnMapper: map[string]string{
+			"saleChannel": `"saleChannel"`,
+		},
+		IgnoreColumns: []string{"secret"},
+	}
+}
+
+func TestGetUpdateMapVersion(t *testing.T) {
+	sqlTool := NewUpdate(context.Background(), nil, getVersionedTable(), &versionedModel{})
+	m, err := sqlTool.GetUpdateMap(&versionedModel{Id: 1, Name: "a", Version: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr, ok := m["version"].(squirrel.Sqlizer)
+	if !ok {
+		t.Fatalf("expected version to be an expression, got %T", m["version"])
+	}
+
+	query, _, _ := expr.ToSql()
+	if query != "version + 1" {
+		t.Fatalf("unexpected version expression %s", query)
+	}
+
+	if sqlTool.lockVersion != 3 {
+		t.Fatalf("expected lock version 3, got %d", sqlTool.lockVersion)
+	}
+
+	// a caller without version would overwrite the concurrent updates
+	if _, err = sqlTool.GetUpdateMap(&versionedModel{Id: 1, Name: "a"}); !errors.Is(err, common.SQLInvalidFieldError) {
+		t.Fatalf("expected invalid field error without version, got %v", err)
+	}
+	if _, err = sqlTool.Update(context.Background(), squirrel.Update("items").Set("name", "a")); !errors.Is(err, common.SQLInvalidFieldError) {
+		t.Fatalf("expected unguarded update to be rejected, got %v", err)
+	}
+
+	sqlTool = NewUpdate(WithoutVersionCheck(context.Background()), nil, getVersionedTable(), &versionedModel{})
+	m, err = sqlTool.GetUpdateMap(&versionedModel{Id: 1, Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok = m["version"].(squirrel.Sqlizer); !ok || sqlTool.lockVersion != 0 {
+		t.Fatalf("expected version bump without guard, got %v", m)
+	}
+
+	// the bypass is decided by the ctx of NewUpdate only
+	sqlTool = NewUpdate(context.Background(), nil, getVersionedTable(), &versionedModel{})
+	if _, err = sqlTool.Update(WithoutVersionCheck(context.Background()), squirrel.Update("items").Set("name", "a")); !errors.Is(err, common.SQLInvalidFieldError) {
+		t.Fatalf("expected the bypass of the Update ctx to be ignored, got %v", err)
+	}
+}
+
+func TestVersionConflictError(t *testing.T) {
+	var err error = &VersionConflictError{Table: "items", Version: 3}
+	if !errors.Is(err, common.SQLConflictError) {
+		t.Fatal("conflict error must wrap common.SQLConflictError")
+	}
+
+	// errors crossing grpc only keep the message
+	if !common.IsConflictError(errors.New(err.Error())) {
+		t.Fatal("conflict error must be detected by message")
+	}
+}
+
+func TestGetUpdateMapFields(t *testing.T) {
+	sqlTool := NewUpdate(context.Background(), nil, getVersionedTable(), &versionedModel{})
+	m, err := sqlTool.GetUpdateMap(&versionedModel{Id: 1, Name: "a", Version: 1, SaleChannel: []string{"b"}}, "saleChannel")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := m[`"saleChannel"`]; !ok {
+		t.Fatalf("expected mapped column in update map, got %v", m)
+	}
+
+	if _, ok := m["name"]; ok {
+		t.Fatal("name is not in the update fields")
+	}
+
+	for _, field := range []string{"unknown", "secret", "id"} {
+		_, err = sqlTool.GetUpdateMap(&versionedModel{}, field)
+		if !errors.Is(err, common.SQLInvalidFieldError) {
+			t.Fatalf("expected invalid field error for %s, got %v", field, err)
+		}
+	}
+}
+
+func TestGetUpdateMapZeroFields(t *testing.T) {
+	table := getVersionedTable()
+	table.NotNullColumns = map[string]interface{}{"name": "unnamed"}
+	sqlTool := NewUpdate(context.Background(), nil, table, &versionedModel{})
+
+	// a masked field is cleared to its zero value, not to NULL or the default
+	m, err := sqlTool.GetUpdateMap(&versionedModel{Id: 1, Version: 3}, "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := m["name"]; !ok || v != "" {
+		t.Fatalf("expected empty name in update map, got %v", m)
+	}
+
+	// full model writes keep the default
+	m, err = sqlTool.GetUpdateMap(&versionedModel{Id: 1, Version: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["name"] != "unnamed" {
+		t.Fatalf("expected default name in update map, got %v", m)
+	}
+
+	codecTool := NewUpdate(context.Background(), nil, &Table{Name: "items", AIColumns: []string{"id"},
+		NotNullColumns: map[string]interface{}{"name": "unnamed"}}, &codecModel{})
+	m, err = codecTool.GetUpdateMap(&codecModel{Id: 1}, "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := m["name"]; !ok || v != "" {
+		t.Fatalf("expected empty name in codec update map, got %v", m)
+	}
+}
+
+type codecModel struct {
+	Id   int64  `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+func init() {
+	RegisterModelCodec(&codecModel{}, &ModelCodec{
+		Fields: []ModelField{{Column: "id", Name: "Id"}, {Column: "name", Name: "Name"}},
+		ScanTargets: func(dest interface{}, columns []string) []interface{} {
+			m := dest.(*codecModel)
+			targets := make([]interface{}, len(columns))
+			for i, column := range columns {
+				switch column {
+				case "id":
+					targets[i] = ScanInt(&m.Id)
+				case "name":
+					targets[i] = ScanString(&m.Name)
+				default:
+					targets[i] = new(interface{})
+				}
+			}
+			return targets
+		},
+		Value: func(item interface{}, field string) (interface{}, bool) {
+			m := item.(*codecModel)
+			switch field {
+			case "Id":
+				return m.Id, true
+			case "Name":
+				return m.Name, true
+			}
+			return nil, false
+		},
+	})
+}
+
+func TestModelCodec(t *testing.T) {
+	sqlTool := NewUpdate(context.Background(), nil, &Table{Name: "items", AIColumns: []string{"id"}}, &codecModel{})
+	m, err := sqlTool.GetUpdateMap(&codecModel{Id: 1, Name: "a"}, "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m["name"] != "a" {
+		t.Fatalf("unexpected update map %v", m)
+	}
+
+	item := &codecModel{}
+	targets := getModelCodec(item).ScanTargets(item, []string{"id", "name", "other"})
+	if _, ok := targets[2].(sql.Scanner); ok {
+		t.Fatal("unknown columns must not be scanned into the model")
+	}
+
+	for i, src := range []interface{}{int64(2), []byte("b")} {
+		if err = targets[i].(sql.Scanner).Scan(src); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if item.Id != 2 || item.Name != "b" {
+		t.Fatalf("unexpected scanned item %+v", item)
+	}
+}
+
+func TestScopeCondition(t *testing.T) {
+	table := &Table{Name: "orders", ScopeColumns: ScopeColumns{Project: "project_id", Country: "country_id", Owner: "sale_id"}}
+
+	sqlTool := NewSelect(context.Background(), nil, table, &versionedModel{})
+	if _, err := sqlTool.scopeCondition(context.Background()); !errors.Is(err, common.UnauthorizedError) {
+		t.Fatalf("expected unauthorized without caller, got %v", err)
+	}
+	if scope, err := sqlTool.scopeCondition(WithoutScope(context.Background())); err != nil || scope != nil {
+		t.Fatalf("expected no scope for system jobs, got %v %v", scope, err)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		common.HeaderUserId, "1",
+		common.HeaderChildUserIds, "[2,3]",
+		common.HeaderDataSets, `[{"project_id":10,"country_id":84}]`,
+	))
+	qb := squirrel.Select(sqlTool.GetQueryColumnList("o")...).From(sqlTool.GetTable("o")).Where(squirrel.Eq{"o.id": 5})
+	scope, err := sqlTool.scopeCondition(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query, args, _ := qb.Where(scope).ToSql()
+	expected := "SELECT o.id, o.name, o.version, o.saleChannel, o.secret FROM orders o WHERE o.id = ? AND (o.sale_id IN (?,?,?) AND (1 = 0 OR o.country_id = ? AND o.project_id = ?))"
+	if query != expected || len(args) != 6 {
+		t.Fatalf("unexpected query %s %v", query, args)
+	}
+}
@@ -7,4 +7,6 @@ type Table struct {
 	IgnoreColumns  []string
 	DefaultAlias   string
 	NotNullColumns map[string]interface{}
+	VersionColumn  string       // optimistic locking column, updates require the version read by the caller, see WithoutVersionCheck
+	ScopeColumns   ScopeColumns // Get, Select, Update and Delete only reach the rows of the scope of the caller
 }
@@ -0,0 +1,239 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/nhdms/base-go/pkg/config"
+)
+
+const (
+	PolicyActionAllow      = "allow"
+	PolicyActionDeny       = "deny"
+	PolicyActionBypassAuth = "bypass_auth" // allowed without token, for internal callers
+
+	headerCFConnectingIP = "CF-Connecting-IP"
+	headerForwardedFor   = "X-Forwarded-For"
+	headerRealIP         = "X-Real-IP"
+)
+
+// PolicyRuleConfig is a rule of access_policy.rules, empty fields match every request
+type PolicyRuleConfig struct {
+	Name     string   `mapstructure:"name"`
+	Action   string   `mapstructure:"action"`
+	CIDRs    []string `mapstructure:"cidrs"`    // e.g. 10.0.0.0/8 or a single IP
+	Services []string `mapstructure:"services"` // first segment of the path, e.g. user
+	Paths    []string `mapstructure:"paths"`    // full path, a trailing * matches the prefix, e.g. /user/admin/*
+	Methods  []string `mapstructure:"methods"`
+}
+
+// PolicyConfig is read from the access_policy config. Rules are evaluated in order, the first matching rule decides,
+// DefaultAction (allow) decides the requests matched by no rule.
+// X-Forwarded-For, X-Real-IP and (with Cloudflare) CF-Connecting-IP are only read from TrustedProxies.
+type PolicyConfig struct {
+	DefaultAction  string             `mapstructure:"default_action"`
+	TrustedProxies []string           `mapstructure:"trusted_proxies"`
+	Cloudflare     bool               `mapstructure:"cloudflare"`
+	Rules          []PolicyRuleConfig `mapstructure:"rules"`
+}
+
+type policyRule struct {
+	PolicyRuleConfig
+	networks []*net.IPNet
+}
+
+// PolicyDecision is the action of the rule matching a request, Rule is empty for the default action
+type PolicyDecision struct {
+	Action   string
+	Rule     string
+	ClientIP string
+}
+
+// PolicyEngine whitelists or blacklists the requests of the gateway by client IP, service, path and method
+type PolicyEngine struct {
+	defaultAction  string
+	trustedProxies []*net.IPNet
+	cloudflare     bool
+	rules          []*policyRule
+}
+
+type policyDecisionKey struct{}
+
+func NewPolicyEngine(conf PolicyConfig) (*PolicyEngine, error) {
+	engine := &PolicyEngine{defaultAction: conf.DefaultAction, cloudflare: conf.Cloudflare}
+	switch engine.defaultAction {
+	case "":
+		engine.defaultAction = PolicyActionAllow
+	case PolicyActionAllow, PolicyActionDeny:
+	default:
+		return nil, fmt.Errorf("access_policy: invalid default_action %s", conf.DefaultAction)
+	}
+
+	var err error
+	if engine.trustedProxies, err = parseCIDRs(conf.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("access_policy trusted_proxies: %w", err)
+	}
+
+	for i, ruleConf := range conf.Rules {
+		if len(ruleConf.Name) == 0 {
+			ruleConf.Name = fmt.Sprintf("rule_%d", i)
+		}
+		switch ruleConf.Action {
+		case PolicyActionAllow, PolicyActionDeny:
+		case PolicyActionBypassAuth:
+			if len(ruleConf.CIDRs) == 0 {
+				return nil, fmt.Errorf("access_policy rule %s: bypass_auth requires cidrs", ruleConf.Name)
+			}
+		default:
+			return nil, fmt.Errorf("access_policy rule %s: invalid action %s", ruleConf.Name, ruleConf.Action)
+		}
+
+		rule := &policyRule{PolicyRuleConfig: ruleConf}
+		if rule.networks, err = parseCIDRs(ruleConf.CIDRs); err != nil {
+			return nil, fmt.Errorf("access_policy rule %s: %w", ruleConf.Name, err)
+		}
+		engine.rules = append(engine.rules, rule)
+	}
+	return engine, nil
+}
+
+// LoadPolicyEngine creates the engine of the access_policy config, every request is allowed without it
+func LoadPolicyEngine() (*PolicyEngine, error) {
+	conf := PolicyConfig{}
+	_ = config.LoadConfigToVar(&conf, "access_policy")
+	return NewPolicyEngine(conf)
+}
+
+// parseCIDRs parses CIDR ranges, a single IP is a /32 (/128) range
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %s", value)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP of the client. The forwarding headers are only read when the request comes from a trusted
+// proxy, X-Forwarded-For is read from the right and the first address not of a trusted proxy is the client.
+func (e *PolicyEngine) ClientIP(r *http.Request) string {
+	remoteIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remoteIP = host
+	}
+	if ip := net.ParseIP(remoteIP); ip == nil || !containsIP(e.trustedProxies, ip) {
+		return remoteIP
+	}
+
+	if e.cloudflare {
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get(headerCFConnectingIP))); ip != nil {
+			return ip.String()
+		}
+	}
+
+	if forwardedFor := r.Header.Get(headerForwardedFor); len(forwardedFor) > 0 {
+		hops := strings.Split(forwardedFor, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				// a forged value, the hops on its left can not be trusted
+				break
+			}
+			if i == 0 || !containsIP(e.trustedProxies, ip) {
+				return ip.String()
+			}
+		}
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get(headerRealIP))); ip != nil {
+		return ip.String()
+	}
+	return remoteIP
+}
+
+// Evaluate returns the decision of the first rule matching the request
+func (e *PolicyEngine) Evaluate(r *http.Request) PolicyDecision {
+	clientIP := e.ClientIP(r)
+	ip := net.ParseIP(clientIP)
+	service := strings.SplitN(strings.Trim(r.URL.Path, "/"), "/", 2)[0]
+
+	for _, rule := range e.rules {
+		if rule.matches(ip, service, r) {
+			return PolicyDecision{Action: rule.Action, Rule: rule.Name, ClientIP: clientIP}
+		}
+	}
+	return PolicyDecision{Action: e.defaultAction, ClientIP: clientIP}
+}
+
+func (rule *policyRule) matches(ip net.IP, service string, r *http.Request) bool {
+	if len(rule.networks) > 0 && (ip == nil || !containsIP(rule.networks, ip)) {
+		return false
+	}
+	if len(rule.Services) > 0 && !containsFold(rule.Services, service) {
+		return false
+	}
+	if len(rule.Methods) > 0 && !containsFold(rule.Methods, r.Method) {
+		return false
+	}
+	if len(rule.Paths) == 0 {
+		return true
+	}
+	for _, path := range rule.Paths {
+		if prefix, ok := strings.CutSuffix(path, "*"); ok {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return true
+			}
+		} else if r.URL.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if v == "*" || strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithPolicyDecision keeps the decision of the request in ctx
+func WithPolicyDecision(ctx context.Context, decision PolicyDecision) context.Context {
+	return context.WithValue(ctx, policyDecisionKey{}, decision)
+}
+
+// PolicyDecisionFromContext returns the decision of the request, false when the policy was not applied
+func PolicyDecisionFromContext(ctx context.Context) (PolicyDecision, bool) {
+	decision, ok := ctx.Value(policyDecisionKey{}).(PolicyDecision)
+	return decision, ok
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPolicyEngine(t *testing.T) {
+	if _, err := NewPolicyEngine(PolicyConfig{Rules: []PolicyRuleConfig{{Name: "open", Action: PolicyActionBypassAuth}}}); err == nil {
+		t.Fatal("expected bypass_auth without cidrs to be rejected")
+	}
+
+	engine, err := NewPolicyEngine(PolicyConfig{
+		TrustedProxies: []string{"10.0.0.0/8"},
+		Cloudflare:     true,
+		Rules: []PolicyRuleConfig{
+			{Name: "blocked", Action: PolicyActionDeny, CIDRs: []string{"203.0.113.0/24"}},
+			{Name: "office-admin", Action: PolicyActionAllow, CIDRs: []string{"198.51.100.7"}, Paths: []string{"/user/admin/*"}},
+			{Name: "admin", Action: PolicyActionDeny, Paths: []string{"/user/admin/*"}},
+			{Name: "internal", Action: PolicyActionBypassAuth, CIDRs: []string{"10.1.0.0/16"}, Services: []string{"order"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		remoteAddr   string
+		headers      map[string]string
+		path         string
+		clientIP     string
+		action, rule string
+	}{
+		// forwarding headers of an untrusted client are ignored
+		{"203.0.113.9:1000", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "/user/admin/roles", "203.0.113.9", PolicyActionDeny, "blocked"},
+		// spoofed left hops are skipped, the first hop not of a trusted proxy is the client
+		{"10.0.0.2:1000", map[string]string{"X-Forwarded-For": "198.51.100.7, 203.0.113.9, 10.0.0.3"}, "/user/me", "203.0.113.9", PolicyActionDeny, "blocked"},
+		{"10.0.0.2:1000", map[string]string{"CF-Connecting-IP": "198.51.100.7"}, "/user/admin/roles", "198.51.100.7", PolicyActionAllow, "office-admin"},
+		{"192.0.2.1:1000", nil, "/user/admin/roles", "192.0.2.1", PolicyActionDeny, "admin"},
+		{"10.1.2.3:1000", nil, "/order/orders", "10.1.2.3", PolicyActionBypassAuth, "internal"},
+		{"10.1.2.3:1000", nil, "/user/me", "10.1.2.3", PolicyActionAllow, ""},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", c.path, nil)
+		r.RemoteAddr = c.remoteAddr
+		for k, v := range c.headers {
+			r.Header.Set(k, v)
+		}
+
+		decision := engine.Evaluate(r)
+		if decision.ClientIP != c.clientIP || decision.Action != c.action || decision.Rule != c.rule {
+			t.Errorf("%s %s %v: unexpected decision %+v", c.remoteAddr, c.path, c.headers, decision)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/nhdms/base-go/pkg/common"
+	"go-micro.dev/v5/metadata"
+)
+
+// ForwardPrincipal copies the X-AT-* headers set by the gateway from the token into the metadata of the gRPC calls
+// made with the request context, services read them with dbtool.GetScope
+func ForwardPrincipal(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		md := make(metadata.Metadata)
+		for _, header := range common.ExtraDataHeaders {
+			if value := r.Header.Get(header); len(value) > 0 {
+				md.Set(header, value)
+			}
+		}
+
+		ctx := r.Context()
+		if len(md) > 0 {
+			ctx = metadata.MergeContext(ctx, md, true)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
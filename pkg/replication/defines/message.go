@@ -1,10 +1,43 @@
 package replication
 
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/nhdms/base-go/pkg/dbtool"
+	"github.com/nhdms/base-go/pkg/utils/pg_converter"
+)
+
 type EventType string
+
+// MetadataPayload is the metadata key of handler messages telling whether the payload is Messages or a Transaction
+const (
+	MetadataPayload    = "payload"
+	PayloadMessages    = "messages"
+	PayloadTransaction = "transaction"
+)
+
+const (
+	EventInsert EventType = "insert"
+	EventUpdate EventType = "update"
+	EventDelete EventType = "delete"
+	// EventTruncate has no data, every row of the table was removed
+	EventTruncate EventType = "truncate"
+	// EventSchemaChange is sent before the first change with a new column layout, Types holds the new columns
+	EventSchemaChange EventType = "schema_change"
+)
+
 type Table struct {
 	Name   string
 	Schema string
 }
+
+// Message is a normalized change event, Data and OldData hold values converted by pg_converter
+// (int64, float64, time.Time, decoded JSON...) keyed by column name
 type Message struct {
 	Position string    `json:"position"`
 	Type     EventType `json:"type"`
@@ -12,6 +45,115 @@ type Message struct {
 
 	Data    map[string]interface{} `json:"data,omitempty"`
 	OldData map[string]interface{} `json:"old_data,omitempty"`
+	// Types are the postgres types of the columns in Data and OldData
+	Types map[string]string `json:"types,omitempty"`
+	// SchemaVersion increments on every column layout change of the table since the stream started
+	SchemaVersion int `json:"schema_version,omitempty"`
+
+	// Xid and CommitTime are the transaction of the change, they are empty for snapshot rows
+	Xid        uint32    `json:"xid,omitempty"`
+	CommitTime time.Time `json:"commit_time"`
+	// Backfill is set on rows re-emitted by a backfill request, they are inserts of the current row
+	Backfill bool `json:"backfill,omitempty"`
 }
 
 type Messages []*Message
+
+var (
+	protoConverters sync.Map
+	typeConverter   = pg_converter.NewPostgreSQLTypeConverter(time.UTC)
+)
+
+// UnmarshalMessages decodes Messages from JSON and restores the value types from Types,
+// numbers are kept exact (bigint ids above 2^53) and timestamps are time.Time again
+func UnmarshalMessages(data []byte) (Messages, error) {
+	var messages Messages
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&messages); err != nil {
+		return nil, err
+	}
+
+	for _, m := range messages {
+		m.normalize()
+	}
+	return messages, nil
+}
+
+// UnmarshalTransaction decodes a Transaction from JSON like UnmarshalMessages
+func UnmarshalTransaction(data []byte) (*Transaction, error) {
+	tx := &Transaction{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(tx); err != nil {
+		return nil, err
+	}
+
+	for _, m := range tx.Messages {
+		m.normalize()
+	}
+	return tx, nil
+}
+
+func (m *Message) normalize() {
+	for _, data := range []map[string]interface{}{m.Data, m.OldData} {
+		for column, value := range data {
+			typeName, ok := m.Types[column]
+			if !ok || value == nil {
+				continue
+			}
+			if converted, err := typeConverter.ConvertValue(typeName, value); err == nil {
+				data[column] = converted
+			}
+		}
+	}
+}
+
+// Decode sets the fields of dst (a pointer to a proto model such as *models.User) from Data,
+// deletes have no Data so OldData is used
+func (m *Message) Decode(dst interface{}) error {
+	data := m.Data
+	if m.Type == EventDelete {
+		data = m.OldData
+	}
+	return m.decode(data, dst)
+}
+
+// DecodeOld sets the fields of dst from OldData, which holds only the key columns unless the table has REPLICA IDENTITY FULL
+func (m *Message) DecodeOld(dst interface{}) error {
+	return m.decode(m.OldData, dst)
+}
+
+// DecodeModel decodes the change into a new instance of the model registered for the table with dbtool.RegisterTable
+func (m *Message) DecodeModel() (interface{}, error) {
+	model, ok := dbtool.NewRegisteredModel(fmt.Sprintf("%s.%s", m.Table.Schema, m.Table.Name))
+	if !ok {
+		model, ok = dbtool.NewRegisteredModel(m.Table.Name)
+	}
+	if !ok {
+		return nil, fmt.Errorf("no model registered for table %s", m.Table.Name)
+	}
+	return model, m.Decode(model)
+}
+
+func (m *Message) decode(data map[string]interface{}, dst interface{}) error {
+	typ := reflect.TypeOf(dst)
+	if typ == nil || typ.Kind() != reflect.Ptr {
+		return fmt.Errorf("decode destination must be a pointer, got %T", dst)
+	}
+
+	converter, ok := protoConverters.Load(typ)
+	if !ok {
+		converter, _ = protoConverters.LoadOrStore(typ, pg_converter.NewProtoConverter(dst, time.UTC))
+	}
+
+	names := make([]string, 0, len(data))
+	types := make([]string, 0, len(data))
+	values := make([]interface{}, 0, len(data))
+	for name, value := range data {
+		names = append(names, name)
+		types = append(types, m.Types[name])
+		values = append(values, value)
+	}
+	return converter.(*pg_converter.ProtoConverter).ConvertToStruct(names, types, values, dst)
+}
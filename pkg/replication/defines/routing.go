@@ -0,0 +1,77 @@
+package replication
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// TransactionRoutingKey is the routing key of transaction batches, they span tables so they are not partitioned
+const TransactionRoutingKey = "transactions"
+
+// RoutingConfig builds routing keys <schema>.<table>[.<partition>] for messages. Changes of a row always
+// go to the same partition, so consumers keep per-row ordering when every partition queue has a single consumer.
+type RoutingConfig struct {
+	// Partitions per table, 0 or 1 disables partitioning
+	Partitions int `mapstructure:"partitions"`
+	// KeyColumns are the columns hashed to pick the partition per table, default id
+	KeyColumns map[string][]string `mapstructure:"key_columns"`
+}
+
+// RoutingKey returns the routing key of m, e.g. public.users.3
+func (r RoutingConfig) RoutingKey(m *Message) string {
+	key := fmt.Sprintf("%s.%s", m.Table.Schema, m.Table.Name)
+	if r.Partitions <= 1 {
+		return key
+	}
+	return fmt.Sprintf("%s.%d", key, r.Partition(m))
+}
+
+// RoutingKeys returns the routing keys m must be published to, table level events (truncate, schema change)
+// go to every partition so they are ordered with the row changes of all partitions
+func (r RoutingConfig) RoutingKeys(m *Message) []string {
+	if r.Partitions <= 1 || (m.Type != EventTruncate && m.Type != EventSchemaChange) {
+		return []string{r.RoutingKey(m)}
+	}
+
+	keys := make([]string, r.Partitions)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%s.%s.%d", m.Table.Schema, m.Table.Name, i)
+	}
+	return keys
+}
+
+// Partition hashes the key columns of m into [0, Partitions)
+func (r RoutingConfig) Partition(m *Message) int {
+	if r.Partitions <= 1 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(m.PartitionKey(r.getKeyColumns(m.Table)...)))
+	return int(h.Sum32() % uint32(r.Partitions))
+}
+
+func (r RoutingConfig) getKeyColumns(table Table) []string {
+	if columns, ok := r.KeyColumns[fmt.Sprintf("%s.%s", table.Schema, table.Name)]; ok {
+		return columns
+	}
+	if columns, ok := r.KeyColumns[table.Name]; ok {
+		return columns
+	}
+	return []string{"id"}
+}
+
+// PartitionKey joins the values of columns, they are taken from OldData when set
+// so an update changing the key is ordered after the previous changes of the row
+func (m *Message) PartitionKey(columns ...string) string {
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		value, ok := m.OldData[column]
+		if !ok {
+			value = m.Data[column]
+		}
+		values[i] = fmt.Sprint(value)
+	}
+	return strings.Join(values, "|")
+}
@@ -0,0 +1,11 @@
+package replication
+
+import "time"
+
+// Transaction is a batch of the changes committed together, in commit order
+type Transaction struct {
+	Xid        uint32    `json:"xid"`
+	CommitLSN  string    `json:"commit_lsn"`
+	CommitTime time.Time `json:"commit_time"`
+	Messages   Messages  `json:"messages"`
+}
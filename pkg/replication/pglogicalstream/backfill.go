@@ -0,0 +1,314 @@
+package pglogicalstream
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/lib/pq"
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/nhdms/base-go/pkg/utils"
+)
+
+// DefaultBackfillTable is the control table of the backfill requests, it is created in the replicated database
+const DefaultBackfillTable = "pglog_stream_backfills"
+
+const (
+	BackfillPending = "pending"
+	BackfillRunning = "running"
+	BackfillDone    = "done"
+	BackfillFailed  = "failed"
+)
+
+// BackfillRequest re-emits the rows of a replicated table, or of its primary key range FromKey..ToKey
+// (inclusive, empty is unbounded), as backfill insert events. Requests of a slot run one at a time in id order,
+// an interrupted request resumes from LastKey.
+type BackfillRequest struct {
+	ID        int64     `json:"id"`
+	SlotName  string    `json:"slot_name"`
+	Table     string    `json:"table"`
+	FromKey   []string  `json:"from_key,omitempty"`
+	ToKey     []string  `json:"to_key,omitempty"`
+	Status    string    `json:"status"`
+	Rows      int64     `json:"rows"`
+	LastKey   []string  `json:"last_key,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BackfillProgress is set on the backfill rows and on the marker sent after each batch, the marker has no changes
+// and its progress is saved by Commit
+type BackfillProgress struct {
+	ID      int64
+	Table   string
+	Rows    int64
+	LastKey []string
+	Done    bool
+
+	committed chan struct{}
+}
+
+// backfillBatch is emitted by streamMessagesAsync once the stream passed lsn, the WAL position when the rows were read
+type backfillBatch struct {
+	lsn       pglogrepl.LSN
+	changes   []Wal2JsonChanges
+	committed chan struct{}
+}
+
+const backfillColumns = "id, slot_name, table_name, from_key, to_key, status, rows, last_key, error, created_at, updated_at"
+
+// EnsureBackfillTable creates the backfill control table if not exists
+func EnsureBackfillTable(ctx context.Context, db *sql.DB, table string) error {
+	if len(table) == 0 {
+		table = DefaultBackfillTable
+	}
+
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id BIGSERIAL PRIMARY KEY,
+		slot_name VARCHAR(128) NOT NULL,
+		table_name VARCHAR(255) NOT NULL,
+		from_key TEXT[],
+		to_key TEXT[],
+		status VARCHAR(16) NOT NULL DEFAULT 'pending',
+		rows BIGINT NOT NULL DEFAULT 0,
+		last_key TEXT[],
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`, table))
+	if err != nil {
+		return fmt.Errorf("failed to create backfill table %s: %w", table, err)
+	}
+	return nil
+}
+
+// RequestBackfill queues a backfill for the stream of req.SlotName, it runs when the stream polls the table
+func RequestBackfill(ctx context.Context, db *sql.DB, table string, req BackfillRequest) (int64, error) {
+	if len(table) == 0 {
+		table = DefaultBackfillTable
+	}
+	if len(req.SlotName) == 0 || len(req.Table) == 0 {
+		return 0, fmt.Errorf("slot name and table are required")
+	}
+	if err := EnsureBackfillTable(ctx, db, table); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err := db.QueryRowContext(ctx, fmt.Sprintf("INSERT INTO %s (slot_name, table_name, from_key, to_key) VALUES ($1, $2, $3, $4) RETURNING id", table),
+		req.SlotName, req.Table, nullableArray(req.FromKey), nullableArray(req.ToKey)).Scan(&id)
+	return id, err
+}
+
+// ListBackfills returns the backfill requests of slot, newest first
+func ListBackfills(ctx context.Context, db *sql.DB, table, slot string) ([]BackfillRequest, error) {
+	if len(table) == 0 {
+		table = DefaultBackfillTable
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE slot_name = $1 ORDER BY id DESC", backfillColumns, table), slot)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []BackfillRequest
+	for rows.Next() {
+		req, err := scanBackfillRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, req)
+	}
+	return requests, rows.Err()
+}
+
+func scanBackfillRequest(row interface{ Scan(...interface{}) error }) (BackfillRequest, error) {
+	var req BackfillRequest
+	err := row.Scan(&req.ID, &req.SlotName, &req.Table, pq.Array(&req.FromKey), pq.Array(&req.ToKey), &req.Status,
+		&req.Rows, pq.Array(&req.LastKey), &req.Error, &req.CreatedAt, &req.UpdatedAt)
+	return req, err
+}
+
+func nullableArray(key []string) interface{} {
+	if len(key) == 0 {
+		return nil
+	}
+	return pq.Array(key)
+}
+
+// runBackfills polls the backfill table every BackfillInterval and runs the requests of the slot until the stream stops
+func (s *Stream) runBackfills() {
+	db, err := sql.Open("postgres", connectionString(s.dbConfig))
+	if err != nil {
+		logger.DefaultLogger.Errorf("Failed to open connection for backfills: %v", err)
+		return
+	}
+	defer db.Close()
+
+	if err = EnsureBackfillTable(s.streamCtx, db, s.conf.BackfillTable); err != nil {
+		logger.DefaultLogger.Errorf("Backfills are disabled: %v", err)
+		return
+	}
+	s.backfillDB = db
+
+	ticker := time.NewTicker(s.conf.BackfillInterval)
+	defer ticker.Stop()
+	for {
+		for s.nextBackfill(db) {
+		}
+
+		select {
+		case <-s.streamCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// nextBackfill runs the oldest pending or interrupted request of the slot, it returns false when there is none
+func (s *Stream) nextBackfill(db *sql.DB) bool {
+	req, err := scanBackfillRequest(db.QueryRowContext(s.streamCtx, fmt.Sprintf(`UPDATE %[1]s SET status = $2, updated_at = NOW()
+		WHERE id = (SELECT id FROM %[1]s WHERE slot_name = $1 AND status IN ($3, $2) ORDER BY id LIMIT 1)
+		RETURNING %[2]s`, s.conf.BackfillTable, backfillColumns), s.slotName, BackfillRunning, BackfillPending))
+	if err == sql.ErrNoRows || s.streamCtx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		logger.DefaultLogger.Errorf("Failed to get backfill request: %v", err)
+		return false
+	}
+
+	logger.DefaultLogger.Infow("Start backfill", "id", req.ID, "table", req.Table, "from_key", req.FromKey, "to_key", req.ToKey, "rows", req.Rows)
+	if err = s.backfill(req); err != nil {
+		if s.streamCtx.Err() != nil {
+			// stopped, the request resumes after restart
+			return false
+		}
+
+		logger.DefaultLogger.Errorw("Backfill failed", "id", req.ID, "table", req.Table, "error", err)
+		_, err = db.ExecContext(s.streamCtx, fmt.Sprintf("UPDATE %s SET status = $2, error = $3, updated_at = NOW() WHERE id = $1", s.conf.BackfillTable),
+			req.ID, BackfillFailed, err.Error())
+		if err != nil {
+			logger.DefaultLogger.Errorf("Failed to save backfill status: %v", err)
+			return false
+		}
+	}
+	return true
+}
+
+// backfill reads the rows in batches and hands them to streamMessagesAsync, each batch is committed before the next one is read
+func (s *Stream) backfill(req BackfillRequest) error {
+	table := req.Table
+	if !strings.Contains(table, ".") {
+		table = fmt.Sprintf("%s.%s", s.schema, table)
+	}
+	if !utils.StringSliceContains(s.Tables(), table) {
+		return fmt.Errorf("table %s is not replicated by slot %s", table, s.slotName)
+	}
+
+	snapshotter := &Snapshotter{pgConnection: s.backfillDB}
+	progress := &BackfillProgress{ID: req.ID, Table: table, Rows: req.Rows, LastKey: req.LastKey}
+	startedAt := time.Now()
+	for {
+		if err := s.waitSnapshotResume(); err != nil {
+			return err
+		}
+
+		batch, err := s.readBackfillBatch(snapshotter, req, progress)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case s.backfills <- batch:
+		case <-s.streamCtx.Done():
+			return s.streamCtx.Err()
+		}
+
+		select {
+		case <-batch.committed:
+		case <-s.streamCtx.Done():
+			return s.streamCtx.Err()
+		}
+
+		logger.DefaultLogger.Infow("Backfill progress", "id", req.ID, "table", table, "rows", progress.Rows, "done", progress.Done, "elapsed", time.Since(startedAt).String())
+		if progress.Done {
+			return nil
+		}
+	}
+}
+
+func (s *Stream) readBackfillBatch(snapshotter *Snapshotter, req BackfillRequest, progress *BackfillProgress) (*backfillBatch, error) {
+	ctx := s.streamCtx
+	tx, err := snapshotter.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// the first query takes the snapshot, changes committed before this position are visible to the batch
+	var lsn string
+	if err = tx.QueryRowContext(ctx, "SELECT pg_current_wal_lsn()::text").Scan(&lsn); err != nil {
+		return nil, err
+	}
+
+	pk, err := snapshotter.GetPrimaryKeyColumns(ctx, tx, progress.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize := int64(s.snapshotBatchSize)
+	rows, err := snapshotter.QueryRangeData(ctx, tx, progress.Table, pk, req.FromKey, req.ToKey, progress.LastKey, batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &backfillBatch{committed: make(chan struct{})}
+	batch.lsn, err = pglogrepl.ParseLSN(lsn)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, tableName, _ := strings.Cut(progress.Table, ".")
+	count, lastKey, err := s.sendSnapshotRows(rows, schema, tableName, pk, func(msg Wal2JsonChanges) error {
+		msg.Backfill = &BackfillProgress{ID: progress.ID, Table: progress.Table}
+		batch.changes = append(batch.changes, msg)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	progress.Rows += count
+	if count > 0 {
+		progress.LastKey = lastKey
+	}
+	progress.Done = count < batchSize
+
+	marker := *progress
+	marker.committed = batch.committed
+	batch.changes = append(batch.changes, Wal2JsonChanges{Backfill: &marker})
+	return batch, nil
+}
+
+// saveBackfillProgress saves the progress of a committed marker and wakes up the backfill waiting for it
+func (s *Stream) saveBackfillProgress(ctx context.Context, progress BackfillProgress) error {
+	status := BackfillRunning
+	if progress.Done {
+		status = BackfillDone
+	}
+
+	_, err := s.backfillDB.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET status = $2, rows = $3, last_key = $4, updated_at = NOW() WHERE id = $1", s.conf.BackfillTable),
+		progress.ID, status, progress.Rows, nullableArray(progress.LastKey))
+	if err != nil {
+		return err
+	}
+
+	close(progress.committed)
+	return nil
+}
@@ -0,0 +1,155 @@
+package pglogicalstream
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	CheckpointPostgres = "postgres"
+	CheckpointRedis    = "redis"
+
+	checkpointLSNKey      = "lsn"
+	checkpointSnapshotKey = "snapshot:"
+)
+
+// SnapshotProgress is the snapshot position of a table, Offset rows are already delivered
+// and the next batch starts after the primary key LastKey
+type SnapshotProgress struct {
+	Table   string   `json:"table"`
+	Offset  int64    `json:"offset"`
+	LastKey []string `json:"last_key,omitempty"`
+	Done    bool     `json:"done"`
+}
+
+// CheckpointStore persists the last acknowledged LSN and the snapshot progress of a replication slot,
+// so the stream resumes from there after a restart
+type CheckpointStore interface {
+	LoadLSN(ctx context.Context, slot string) (string, error)
+	SaveLSN(ctx context.Context, slot, lsn string) error
+	// LoadSnapshotProgress returns nil if the snapshot of table has not started
+	LoadSnapshotProgress(ctx context.Context, slot, table string) (*SnapshotProgress, error)
+	SaveSnapshotProgress(ctx context.Context, slot string, progress SnapshotProgress) error
+	// Reset deletes the LSN and the snapshot progress of slot, they do not apply to a recreated slot
+	Reset(ctx context.Context, slot string) error
+}
+
+type postgresCheckpointStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewPostgresCheckpointStore stores checkpoints in table, it is created if not exists
+func NewPostgresCheckpointStore(db *sql.DB, table string) (CheckpointStore, error) {
+	if len(table) == 0 {
+		table = "replication_checkpoints"
+	}
+
+	_, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		slot_name VARCHAR(128) NOT NULL,
+		checkpoint_key VARCHAR(255) NOT NULL,
+		value TEXT NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (slot_name, checkpoint_key)
+	)`, table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint table %s: %w", table, err)
+	}
+
+	return &postgresCheckpointStore{db: db, table: table}, nil
+}
+
+func (p *postgresCheckpointStore) LoadLSN(ctx context.Context, slot string) (string, error) {
+	return p.load(ctx, slot, checkpointLSNKey)
+}
+
+func (p *postgresCheckpointStore) SaveLSN(ctx context.Context, slot, lsn string) error {
+	return p.save(ctx, slot, checkpointLSNKey, lsn)
+}
+
+func (p *postgresCheckpointStore) LoadSnapshotProgress(ctx context.Context, slot, table string) (*SnapshotProgress, error) {
+	value, err := p.load(ctx, slot, checkpointSnapshotKey+table)
+	if err != nil || len(value) == 0 {
+		return nil, err
+	}
+
+	progress := &SnapshotProgress{}
+	return progress, json.Unmarshal([]byte(value), progress)
+}
+
+func (p *postgresCheckpointStore) SaveSnapshotProgress(ctx context.Context, slot string, progress SnapshotProgress) error {
+	value, _ := json.Marshal(progress)
+	return p.save(ctx, slot, checkpointSnapshotKey+progress.Table, string(value))
+}
+
+func (p *postgresCheckpointStore) Reset(ctx context.Context, slot string) error {
+	_, err := p.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE slot_name = $1", p.table), slot)
+	return err
+}
+
+func (p *postgresCheckpointStore) load(ctx context.Context, slot, key string) (string, error) {
+	var value string
+	err := p.db.QueryRowContext(ctx, fmt.Sprintf("SELECT value FROM %s WHERE slot_name = $1 AND checkpoint_key = $2", p.table), slot, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+func (p *postgresCheckpointStore) save(ctx context.Context, slot, key, value string) error {
+	_, err := p.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (slot_name, checkpoint_key, value) VALUES ($1, $2, $3)
+		ON CONFLICT (slot_name, checkpoint_key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()`, p.table), slot, key, value)
+	return err
+}
+
+type redisCheckpointStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisCheckpointStore stores checkpoints of a slot in the hash <prefix><slot>
+func NewRedisCheckpointStore(client *redis.Client, prefix string) CheckpointStore {
+	if len(prefix) == 0 {
+		prefix = "replication:checkpoint:"
+	}
+	return &redisCheckpointStore{client: client, prefix: prefix}
+}
+
+func (r *redisCheckpointStore) LoadLSN(ctx context.Context, slot string) (string, error) {
+	return r.load(ctx, slot, checkpointLSNKey)
+}
+
+func (r *redisCheckpointStore) SaveLSN(ctx context.Context, slot, lsn string) error {
+	return r.client.HSet(ctx, r.prefix+slot, checkpointLSNKey, lsn).Err()
+}
+
+func (r *redisCheckpointStore) LoadSnapshotProgress(ctx context.Context, slot, table string) (*SnapshotProgress, error) {
+	value, err := r.load(ctx, slot, checkpointSnapshotKey+table)
+	if err != nil || len(value) == 0 {
+		return nil, err
+	}
+
+	progress := &SnapshotProgress{}
+	return progress, json.Unmarshal([]byte(value), progress)
+}
+
+func (r *redisCheckpointStore) SaveSnapshotProgress(ctx context.Context, slot string, progress SnapshotProgress) error {
+	value, _ := json.Marshal(progress)
+	return r.client.HSet(ctx, r.prefix+slot, checkpointSnapshotKey+progress.Table, value).Err()
+}
+
+func (r *redisCheckpointStore) Reset(ctx context.Context, slot string) error {
+	return r.client.Del(ctx, r.prefix+slot).Err()
+}
+
+func (r *redisCheckpointStore) load(ctx context.Context, slot, key string) (string, error) {
+	value, err := r.client.HGet(ctx, r.prefix+slot, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
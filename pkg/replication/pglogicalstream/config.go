@@ -1,6 +1,9 @@
 package pglogicalstream
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 const (
 	TlsNoVerify      = "none"
@@ -19,11 +22,42 @@ type Config struct {
 	TlsVerify                  string   `mapstructure:"tls_verify"`
 	StreamOldData              bool     `mapstructure:"stream_old_data"`
 	SeparateChanges            bool     `mapstructure:"separate_changes"`
+	EmitTransactions           bool     `mapstructure:"emit_transactions"` // emit all changes of a transaction as one batch
 	SnapshotMemorySafetyFactor float64  `mapstructure:"snapshot_memory_safety_factor"`
 	BatchSize                  int      `mapstructure:"batch_size"`
 	AutoAck                    bool     `mapstructure:"auto_ack"`
 	LastLsn                    string   `mapstructure:"last_lsn"`
-	SnapshotOffset             int64    `mapstructure:"snapshot_offset"`
+	SnapshotOffset             int64    `mapstructure:"snapshot_offset"` // deprecated, snapshots resume from the checkpoint
+	SnapshotWorkers            int      `mapstructure:"snapshot_workers"`
+	Plugin                     string   `mapstructure:"plugin"` // wal2json (default) or pgoutput
+
+	Checkpoint           string          `mapstructure:"checkpoint"`         // postgres or redis, empty disables checkpoints
+	CheckpointTable      string          `mapstructure:"checkpoint_table"`   // postgres table or redis key prefix
+	RetryMaxAttempts     int             `mapstructure:"retry_max_attempts"` // 0 retries forever
+	RetryInitialInterval time.Duration   `mapstructure:"retry_initial_interval"`
+	RetryMaxInterval     time.Duration   `mapstructure:"retry_max_interval"`
+	CheckpointStore      CheckpointStore `mapstructure:"-"`
+
+	// the slot is checked every SlotMonitorInterval (default 30s). Above SlotLagAlarmBytes of retained WAL the alarm
+	// is raised, above SlotLagPauseBytes the snapshot and the backfills pause until the retained WAL is lower again,
+	// e.g. after an abandoned slot was dropped. The WAL retained by the slot itself is only counted once the snapshot
+	// is done, as it is not confirmed before. 0 disables a threshold.
+	SlotMonitorInterval time.Duration           `mapstructure:"slot_monitor_interval"`
+	SlotLagAlarmBytes   int64                   `mapstructure:"slot_lag_alarm_bytes"`
+	SlotLagPauseBytes   int64                   `mapstructure:"slot_lag_pause_bytes"`
+	OnSlotAlarm         func(status SlotStatus) `mapstructure:"-"`
+	// StatusAddr is the listen address of the status API (/replication/status, /debug/vars), empty disables it
+	StatusAddr string `mapstructure:"status_addr"`
+
+	// TableFilters are the column filters, row predicates and masks by table name, applied to the streamed changes
+	// and the snapshot. MaskSalt is prepended to the values masked by hash.
+	TableFilters map[string]TableFilter `mapstructure:"table_filters"`
+	MaskSalt     string                 `mapstructure:"mask_salt"`
+	transforms   map[string]*tableTransform
+
+	// backfill requests (see BackfillRequest) are polled from BackfillTable every BackfillInterval, 0 disables backfills
+	BackfillInterval time.Duration `mapstructure:"backfill_interval"`
+	BackfillTable    string        `mapstructure:"backfill_table"`
 }
 
 func (c *Config) InitDefaultAndValidate() error {
@@ -52,12 +86,39 @@ func (c *Config) InitDefaultAndValidate() error {
 	if c.BatchSize < 1 {
 		c.BatchSize = 1000
 	}
+	if c.SnapshotWorkers < 1 {
+		c.SnapshotWorkers = 4
+	}
 	if c.SnapshotMemorySafetyFactor == 0 {
 		c.SnapshotMemorySafetyFactor = 0.7
 	}
 	if len(c.TlsVerify) == 0 {
 		c.TlsVerify = TlsNoVerify
 	}
+	if len(c.Plugin) == 0 {
+		c.Plugin = PluginWal2Json
+	}
+	if c.RetryInitialInterval <= 0 {
+		c.RetryInitialInterval = time.Second
+	}
+	if c.RetryMaxInterval <= 0 {
+		c.RetryMaxInterval = time.Minute
+	}
+	if len(c.BackfillTable) == 0 {
+		c.BackfillTable = DefaultBackfillTable
+	}
+	if c.SlotMonitorInterval <= 0 {
+		c.SlotMonitorInterval = 30 * time.Second
+	}
+	if c.Plugin != PluginWal2Json && c.Plugin != PluginPgOutput {
+		return fmt.Errorf("plugin must be %s or %s", PluginWal2Json, PluginPgOutput)
+	}
+
+	transforms, err := newTableTransforms(c.TableFilters, c.MaskSalt)
+	if err != nil {
+		return fmt.Errorf("invalid table_filters: %w", err)
+	}
+	c.transforms = transforms
 
 	return nil
 }
@@ -0,0 +1,102 @@
+package pglogicalstream
+
+import (
+	"time"
+
+	"github.com/nhdms/base-go/pkg/logger"
+	replication "github.com/nhdms/base-go/pkg/replication/defines"
+	"github.com/nhdms/base-go/pkg/utils/pg_converter"
+)
+
+var eventConverter = pg_converter.NewPostgreSQLTypeConverter(time.UTC)
+
+// ToTransaction converts the changes of a transaction emitted with EmitTransactions to one batch
+func (c Wal2JsonChanges) ToTransaction() *replication.Transaction {
+	tx := &replication.Transaction{
+		Xid:      c.Xid,
+		Messages: c.ToMessages(),
+	}
+	if c.Lsn != nil {
+		tx.CommitLSN = *c.Lsn
+	}
+	if len(tx.Messages) > 0 {
+		tx.CommitTime = tx.Messages[0].CommitTime
+	}
+	return tx
+}
+
+// ToMessages converts the changes to normalized events with typed values, one message per change
+func (c Wal2JsonChanges) ToMessages() replication.Messages {
+	var position string
+	if c.Lsn != nil {
+		position = *c.Lsn
+	}
+
+	var commitTime time.Time
+	if len(c.Timestamp) > 0 {
+		if t, err := eventConverter.ConvertValue("timestamptz", c.Timestamp); err == nil {
+			commitTime = t.(time.Time)
+		}
+	}
+
+	messages := make(replication.Messages, 0, len(c.Changes))
+	for _, change := range c.Changes {
+		msg := &replication.Message{
+			Position:      position,
+			Type:          replication.EventType(change.Kind),
+			Table:         replication.Table{Name: change.Table, Schema: change.Schema},
+			Types:         make(map[string]string, len(change.ColumnNames)),
+			Xid:           c.Xid,
+			CommitTime:    commitTime,
+			SchemaVersion: change.SchemaVersion,
+			Backfill:      c.Backfill != nil,
+		}
+
+		if msg.Type == replication.EventSchemaChange {
+			for i, name := range change.ColumnNames {
+				if i < len(change.ColumnTypes) {
+					msg.Types[name] = change.ColumnTypes[i]
+				}
+			}
+			messages = append(messages, msg)
+			continue
+		}
+
+		if msg.Type != replication.EventDelete && msg.Type != replication.EventTruncate {
+			msg.Data = convertColumns(change.ColumnNames, change.ColumnTypes, change.ColumnValues, msg.Types)
+		}
+		if len(change.OldData.Keynames) > 0 {
+			msg.OldData = convertColumns(change.OldData.Keynames, change.OldData.Keytypes, change.OldData.Keyvalues, msg.Types)
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func convertColumns(names, types []string, values []interface{}, columnTypes map[string]string) map[string]interface{} {
+	data := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		if i >= len(values) {
+			break
+		}
+
+		var typeName string
+		if i < len(types) {
+			typeName = types[i]
+		}
+		columnTypes[name] = typeName
+
+		if len(typeName) == 0 {
+			data[name] = values[i]
+			continue
+		}
+
+		value, err := eventConverter.ConvertValue(typeName, values[i])
+		if err != nil {
+			logger.DefaultLogger.Debugf("Can not convert column %s of type %s: %v", name, typeName, err)
+			value = values[i]
+		}
+		data[name] = value
+	}
+	return data
+}
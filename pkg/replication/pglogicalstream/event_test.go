@@ -0,0 +1,160 @@
+package pglogicalstream
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	replication "github.com/nhdms/base-go/pkg/replication/defines"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+)
+
+func TestToMessages(t *testing.T) {
+	lsn := "0/16B3748"
+	changes := Wal2JsonChanges{
+		Lsn:       &lsn,
+		Xid:       771,
+		Timestamp: "2024-11-18 11:29:46.781285+00",
+		Changes: []Wal2JsonChange{{
+			Kind:         "update",
+			Schema:       "public",
+			Table:        "users",
+			ColumnNames:  []string{"id", "name", "created_at", "countries", "category_ids", "reset"},
+			ColumnTypes:  []string{"bigint", "character varying", "timestamp with time zone", "text[]", "_int8", "jsonb"},
+			ColumnValues: []interface{}{float64(1), "John Doe", "2024-11-18 11:29:46.781285+00", `{"VN","TH"}`, "{1,2}", `{"a": 1}`},
+			OldData: OldKeys{
+				Keynames:  []string{"id"},
+				Keytypes:  []string{"bigint"},
+				Keyvalues: []interface{}{float64(1)},
+			},
+		}},
+	}
+
+	messages := changes.ToMessages()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+
+	msg := messages[0]
+	if msg.Type != replication.EventUpdate || msg.Position != lsn || msg.Xid != 771 || msg.CommitTime.IsZero() {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	if id, ok := msg.Data["id"].(int64); !ok || id != 1 {
+		t.Fatalf("expected int64 id, got %T %v", msg.Data["id"], msg.Data["id"])
+	}
+	if _, ok := msg.Data["created_at"].(time.Time); !ok {
+		t.Fatalf("expected time created_at, got %T", msg.Data["created_at"])
+	}
+	if _, ok := msg.Data["reset"].(map[string]interface{}); !ok {
+		t.Fatalf("expected decoded json reset, got %T", msg.Data["reset"])
+	}
+
+	// handlers receive the messages as JSON
+	b, err := json.Marshal(messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received replication.Messages
+	if err = json.Unmarshal(b, &received); err != nil {
+		t.Fatal(err)
+	}
+
+	user := &models.User{}
+	if err = received[0].Decode(user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Id != 1 || user.Name != "John Doe" || user.CreatedAt.AsTime().Unix() != 1731929386 ||
+		len(user.CategoryIds) != 2 || user.CategoryIds[1] != 2 || user.Reset_ != `{"a":1}` {
+		t.Fatalf("unexpected user %+v", user)
+	}
+}
+
+func TestFilterTransaction(t *testing.T) {
+	filter := NewChangeFilter([]string{"users"}, "public")
+	changes := Wal2JsonChanges{
+		Xid:       42,
+		Timestamp: "2024-11-18 11:29:46.781285+00",
+		Changes: []Wal2JsonChange{
+			{Kind: "insert", Schema: "public", Table: "users", ColumnNames: []string{"id"}, ColumnTypes: []string{"bigint"}, ColumnValues: []interface{}{float64(1)}},
+			{Kind: "insert", Schema: "public", Table: "orders", ColumnNames: []string{"id"}, ColumnTypes: []string{"bigint"}, ColumnValues: []interface{}{float64(7)}},
+			{Kind: "update", Schema: "public", Table: "users", ColumnNames: []string{"id"}, ColumnTypes: []string{"bigint"}, ColumnValues: []interface{}{float64(2)}},
+		},
+	}
+
+	var batches []Wal2JsonChanges
+	filter.FilterTransaction("0/16B3748", changes, func(change Wal2JsonChanges) {
+		batches = append(batches, change)
+	})
+	if len(batches) != 1 || len(batches[0].Changes) != 2 {
+		t.Fatalf("expected one batch with 2 changes, got %+v", batches)
+	}
+
+	tx := batches[0].ToTransaction()
+	if tx.Xid != 42 || tx.CommitLSN != "0/16B3748" || tx.CommitTime.IsZero() || len(tx.Messages) != 2 {
+		t.Fatalf("unexpected transaction %+v", tx)
+	}
+
+	routing := replication.RoutingConfig{Partitions: 4}
+	if key := routing.RoutingKey(tx.Messages[0]); key != fmt.Sprintf("public.users.%d", routing.Partition(tx.Messages[0])) {
+		t.Fatalf("unexpected routing key %s", key)
+	}
+	if routing.Partition(tx.Messages[0]) != routing.Partition(&replication.Message{Table: tx.Messages[0].Table, OldData: map[string]interface{}{"id": int64(1)}}) {
+		t.Fatal("changes of a row must have the same partition")
+	}
+	if key := (replication.RoutingConfig{}).RoutingKey(tx.Messages[1]); key != "public.users" {
+		t.Fatalf("unexpected routing key %s", key)
+	}
+}
+
+func TestTableFilters(t *testing.T) {
+	transforms, err := newTableTransforms(map[string]TableFilter{
+		"users": {
+			ExcludeColumns: []string{"password"},
+			Where:          []string{"status = 1", "type in (1, 2)"},
+			Mask:           map[string]string{"email": MaskHash, "phone": "truncate:4", "name": MaskRedact},
+		},
+	}, "salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := NewChangeFilter([]string{"users"}, "public").WithTransforms(transforms)
+	names := []string{"id", "status", "type", "password", "email", "phone", "name"}
+	types := []string{"bigint", "smallint", "smallint", "text", "text", "text", "text"}
+	changes := Wal2JsonChanges{Changes: []Wal2JsonChange{
+		{Kind: "insert", Schema: "public", Table: "users", ColumnNames: names, ColumnTypes: types,
+			ColumnValues: []interface{}{float64(1), float64(1), float64(2), "secret", "a@b.c", "0901234567", "John"}},
+		{Kind: "insert", Schema: "public", Table: "users", ColumnNames: names, ColumnTypes: types,
+			ColumnValues: []interface{}{float64(2), float64(0), float64(2), "secret", "a@b.c", "0901234567", "John"}},
+		{Kind: "update", Schema: "public", Table: "users", ColumnNames: names, ColumnTypes: types,
+			ColumnValues: []interface{}{float64(3), float64(1), float64(3), "secret", "a@b.c", "0901234567", "John"},
+			OldData:      OldKeys{Keynames: []string{"id"}, Keytypes: []string{"bigint"}, Keyvalues: []interface{}{float64(3)}}},
+	}}
+
+	var filtered []Wal2JsonChange
+	filter.FilterTransaction("0/16B3748", changes, func(change Wal2JsonChanges) {
+		filtered = append(filtered, change.Changes...)
+	})
+	if len(filtered) != 2 {
+		t.Fatalf("expected 2 changes, got %+v", filtered)
+	}
+
+	messages := Wal2JsonChanges{Changes: filtered}.ToMessages()
+	inserted := messages[0].Data
+	if _, ok := inserted["password"]; ok || inserted["name"] != redactedValue || inserted["phone"] != "0901" ||
+		inserted["email"] != transforms["users"].mask(columnMask{kind: MaskHash}, "a@b.c") || len(inserted["email"].(string)) != 64 {
+		t.Fatalf("unexpected masked row %+v", inserted)
+	}
+
+	// the row left the filter, it is deleted by the consumers
+	if messages[1].Type != replication.EventDelete || messages[1].OldData["id"] != int64(3) {
+		t.Fatalf("expected delete of the updated row, got %+v", messages[1])
+	}
+
+	for _, invalid := range []TableFilter{{Where: []string{"status ~ 1"}}, {Mask: map[string]string{"email": "truncate"}}} {
+		if _, err = newTableTransforms(map[string]TableFilter{"users": invalid}, ""); err == nil {
+			t.Fatalf("expected error for %+v", invalid)
+		}
+	}
+}
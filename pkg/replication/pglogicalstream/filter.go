@@ -1,8 +1,14 @@
 package pglogicalstream
 
+import "sync"
+
 type ChangeFilter struct {
+	// tables can be changed at runtime, the lock is shared by the copies of the filter
+	m               *sync.RWMutex
 	tablesWhiteList map[string]bool
 	schemaWhiteList string
+	// transforms of the tables with a TableFilter
+	transforms map[string]*tableTransform
 }
 
 type Filtered func(change Wal2JsonChanges)
@@ -14,53 +20,125 @@ func NewChangeFilter(tableSchemas []string, schema string) ChangeFilter {
 	}
 
 	return ChangeFilter{
+		m:               &sync.RWMutex{},
 		tablesWhiteList: tablesMap,
 		schemaWhiteList: schema,
 	}
 }
 
+// WithTransforms returns the filter applying the column filters, row predicates and masks of the tables
+func (c ChangeFilter) WithTransforms(transforms map[string]*tableTransform) ChangeFilter {
+	c.transforms = transforms
+	return c
+}
+
+// FilterChange calls OnFiltered for each allowed change of the transaction, lsn is the commit LSN.
+// All changes but the last one are Partial, so the transaction is acknowledged after its last change.
 func (c ChangeFilter) FilterChange(lsn string, changes Wal2JsonChanges, OnFiltered Filtered) {
 	if len(changes.Changes) == 0 {
 		return
 	}
 
+	filtered := make([]Wal2JsonChange, 0, len(changes.Changes))
 	for _, ch := range changes.Changes {
-		var filteredChanges = Wal2JsonChanges{
-			Lsn:     &lsn,
-			Changes: []Wal2JsonChange{},
+		if !c.isAllowed(ch) {
+			continue
 		}
-		if ch.Schema != c.schemaWhiteList {
+
+		ch, keep := c.transform(ch)
+		if !keep {
 			continue
 		}
 
-		var (
-			tableExist bool
-		)
+		filtered = append(filtered, filterChange(ch))
+	}
 
-		if _, tableExist = c.tablesWhiteList[ch.Table]; !tableExist {
+	for i, ch := range filtered {
+		OnFiltered(Wal2JsonChanges{
+			Lsn:       &lsn,
+			Xid:       changes.Xid,
+			Timestamp: changes.Timestamp,
+			Changes:   []Wal2JsonChange{ch},
+			Partial:   i < len(filtered)-1,
+		})
+	}
+}
+
+// FilterTransaction calls OnFiltered once with the allowed changes of the transaction in commit order,
+// lsn is the commit LSN. Transactions without allowed changes are skipped.
+func (c ChangeFilter) FilterTransaction(lsn string, changes Wal2JsonChanges, OnFiltered Filtered) {
+	var filteredChanges = Wal2JsonChanges{
+		Lsn:       &lsn,
+		Xid:       changes.Xid,
+		Timestamp: changes.Timestamp,
+		Changes:   make([]Wal2JsonChange, 0, len(changes.Changes)),
+	}
+
+	for _, ch := range changes.Changes {
+		if !c.isAllowed(ch) {
 			continue
 		}
 
-		if ch.Kind == "delete" {
-			ch.ColumnValues = make([]interface{}, len(ch.OldData.Keyvalues))
-			for i, changedValue := range ch.OldData.Keyvalues {
-				if len(ch.ColumnValues) == 0 {
-					break
-				}
-				ch.ColumnValues[i] = changedValue
-			}
+		if ch, keep := c.transform(ch); keep {
+			filteredChanges.Changes = append(filteredChanges.Changes, filterChange(ch))
 		}
+	}
 
-		filteredChanges.Changes = append(filteredChanges.Changes, Wal2JsonChange{
-			Kind:         ch.Kind,
-			Schema:       ch.Schema,
-			Table:        ch.Table,
-			ColumnNames:  ch.ColumnNames,
-			ColumnTypes:  ch.ColumnTypes,
-			ColumnValues: ch.ColumnValues,
-			OldData:      ch.OldData,
-		})
-
+	if len(filteredChanges.Changes) > 0 {
 		OnFiltered(filteredChanges)
 	}
 }
+
+func (c ChangeFilter) isAllowed(ch Wal2JsonChange) bool {
+	if ch.Schema != c.schemaWhiteList {
+		return false
+	}
+
+	c.m.RLock()
+	defer c.m.RUnlock()
+	_, tableExist := c.tablesWhiteList[ch.Table]
+	return tableExist
+}
+
+// transform applies the TableFilter of the table, keep is false when the row is filtered out
+func (c ChangeFilter) transform(ch Wal2JsonChange) (Wal2JsonChange, bool) {
+	t, ok := c.transforms[ch.Table]
+	if !ok {
+		return ch, true
+	}
+	return t.Apply(ch)
+}
+
+// SetTable allows or denies the changes of table
+func (c ChangeFilter) SetTable(table string, allowed bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if allowed {
+		c.tablesWhiteList[table] = true
+	} else {
+		delete(c.tablesWhiteList, table)
+	}
+}
+
+func filterChange(ch Wal2JsonChange) Wal2JsonChange {
+	if ch.Kind == "delete" {
+		ch.ColumnValues = make([]interface{}, len(ch.OldData.Keyvalues))
+		for i, changedValue := range ch.OldData.Keyvalues {
+			if len(ch.ColumnValues) == 0 {
+				break
+			}
+			ch.ColumnValues[i] = changedValue
+		}
+	}
+
+	return Wal2JsonChange{
+		Kind:          ch.Kind,
+		Schema:        ch.Schema,
+		Table:         ch.Table,
+		ColumnNames:   ch.ColumnNames,
+		ColumnTypes:   ch.ColumnTypes,
+		ColumnValues:  ch.ColumnValues,
+		OldData:       ch.OldData,
+		SchemaVersion: ch.SchemaVersion,
+	}
+}
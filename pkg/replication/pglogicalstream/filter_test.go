@@ -0,0 +1,81 @@
+package pglogicalstream
+
+import (
+	"context"
+	"testing"
+)
+
+type memoryCheckpointStore struct {
+	lsn map[string]string
+}
+
+func (m *memoryCheckpointStore) LoadLSN(ctx context.Context, slot string) (string, error) {
+	return m.lsn[slot], nil
+}
+
+func (m *memoryCheckpointStore) SaveLSN(ctx context.Context, slot, lsn string) error {
+	m.lsn[slot] = lsn
+	return nil
+}
+
+func (m *memoryCheckpointStore) LoadSnapshotProgress(ctx context.Context, slot, table string) (*SnapshotProgress, error) {
+	return nil, nil
+}
+
+func (m *memoryCheckpointStore) SaveSnapshotProgress(ctx context.Context, slot string, progress SnapshotProgress) error {
+	return nil
+}
+
+func (m *memoryCheckpointStore) Reset(ctx context.Context, slot string) error {
+	delete(m.lsn, slot)
+	return nil
+}
+
+func TestFilterChangeStopMidTransaction(t *testing.T) {
+	const slot, checkpointLSN, commitLSN = "replica", "0/100", "0/200"
+	store := &memoryCheckpointStore{lsn: map[string]string{slot: checkpointLSN}}
+	s := &Stream{slotName: slot, checkpoint: store}
+
+	filter := NewChangeFilter([]string{"users", "orders"}, "public")
+	tx := Wal2JsonChanges{Xid: 7, Changes: []Wal2JsonChange{
+		{Kind: KindInsert, Schema: "public", Table: "users", ColumnNames: []string{"id"}, ColumnValues: []interface{}{1}},
+		{Kind: KindInsert, Schema: "public", Table: "orders", ColumnNames: []string{"id"}, ColumnValues: []interface{}{2}},
+		{Kind: KindInsert, Schema: "public", Table: "skipped", ColumnNames: []string{"id"}, ColumnValues: []interface{}{3}},
+		{Kind: KindInsert, Schema: "public", Table: "users", ColumnNames: []string{"id"}, ColumnValues: []interface{}{4}},
+	}}
+
+	var sent []Wal2JsonChanges
+	filter.FilterChange(commitLSN, tx, func(change Wal2JsonChanges) {
+		sent = append(sent, change)
+	})
+	if len(sent) != 3 {
+		t.Fatalf("expected 3 changes, got %d", len(sent))
+	}
+	for i, change := range sent {
+		if *change.Lsn != commitLSN || change.Partial != (i < 2) {
+			t.Fatalf("change %d: unexpected lsn %s partial %v", i, *change.Lsn, change.Partial)
+		}
+	}
+
+	// the process stops after handling the first two changes
+	handled := map[interface{}]int{}
+	for _, change := range sent[:2] {
+		handled[change.Changes[0].ColumnValues[0]]++
+		if err := s.Commit(change); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lsn, _ := store.LoadLSN(context.Background(), slot); lsn != checkpointLSN {
+		t.Fatalf("checkpoint must stay before the unfinished transaction, got %s", lsn)
+	}
+
+	// after restart the stream resumes from the checkpoint, so the transaction is delivered again
+	filter.FilterChange(commitLSN, tx, func(change Wal2JsonChanges) {
+		handled[change.Changes[0].ColumnValues[0]]++
+	})
+	for _, id := range []interface{}{1, 2, 4} {
+		if handled[id] == 0 {
+			t.Fatalf("change %v was lost", id)
+		}
+	}
+}
@@ -10,8 +10,7 @@ import (
 	"fmt"
 	"github.com/nhdms/base-go/pkg/logger"
 	"github.com/nhdms/base-go/pkg/utils"
-	"log"
-	"os"
+	"github.com/nhdms/base-go/pkg/utils/pg_converter"
 	"strings"
 	"sync"
 	"time"
@@ -21,7 +20,10 @@ import (
 	"github.com/jackc/pgx/v5/pgproto3"
 )
 
-var pluginArguments = []string{"\"pretty-print\" 'true'"}
+var pluginArguments = []string{"\"pretty-print\" 'true'", "\"include-xids\" 'true'", "\"include-timestamp\" 'true'"}
+
+// commitTimeFormat is the wal2json timestamp format, pgoutput commit times are formatted the same way
+const commitTimeFormat = "2006-01-02 15:04:05.999999-07"
 
 type Stream struct {
 	pgConn *pgconn.PgConn
@@ -50,6 +52,17 @@ type Stream struct {
 	stopped                    bool
 	autoAck                    bool
 	conf                       *Config
+	publicationName            string
+	pgOutput                   *pgOutputDecoder
+	checkpoint                 CheckpointStore
+	converter                  *pg_converter.PostgreSQLTypeConverter
+	schemas                    *schemaTracker
+	snapshotProgress           map[string]SnapshotProgress
+	slotStatus                 SlotStatus
+	snapshotting               bool // the slot is not confirmed before the snapshot is done
+	err                        error
+	backfills                  chan *backfillBatch
+	backfillDB                 *sql.DB
 }
 
 func NewPgStream(config *Config) (*Stream, error) {
@@ -109,32 +122,32 @@ func NewPgStream(config *Config) (*Stream, error) {
 		separateChanges:            config.SeparateChanges,
 		snapshotBatchSize:          config.BatchSize,
 		tableNames:                 tableNames,
-		changeFilter:               NewChangeFilter(tableNames, config.DbSchema),
+		changeFilter:               NewChangeFilter(tableNames, config.DbSchema).WithTransforms(config.transforms),
 		m:                          sync.Mutex{},
 		stopped:                    false,
 		autoAck:                    config.AutoAck,
 		conf:                       config,
+		publicationName:            fmt.Sprintf("pglog_stream_%s", config.ReplicationSlotName),
+		checkpoint:                 config.CheckpointStore,
+		converter:                  pg_converter.NewPostgreSQLTypeConverter(time.UTC),
+		schemas:                    newSchemaTracker(),
+		snapshotProgress:           make(map[string]SnapshotProgress),
+		backfills:                  make(chan *backfillBatch),
+		snapshotting:               config.StreamOldData,
 	}
 
-	result := stream.pgConn.Exec(context.Background(), fmt.Sprintf("DROP PUBLICATION IF EXISTS pglog_stream_%s;", config.ReplicationSlotName))
-	_, err = result.ReadAll()
-	if err != nil {
-		logger.DefaultLogger.Errorf("drop publication if exists error %s", err.Error())
-		return nil, err
+	if config.Plugin == PluginPgOutput {
+		stream.pgOutput = newPgOutputDecoder()
 	}
 
 	for i, table := range tableNames {
 		tableNames[i] = fmt.Sprintf("%s.%s", config.DbSchema, table)
 	}
 
-	tablesSchemaFilter := fmt.Sprintf("FOR TABLE %s", strings.Join(tableNames, ","))
-	logger.DefaultLogger.Infof("Create publication for table schemas with query %s", fmt.Sprintf("CREATE PUBLICATION pglog_stream_%s %s;", config.ReplicationSlotName, tablesSchemaFilter))
-	result = stream.pgConn.Exec(context.Background(), fmt.Sprintf("CREATE PUBLICATION pglog_stream_%s %s;", config.ReplicationSlotName, tablesSchemaFilter))
-	_, err = result.ReadAll()
-	if err != nil {
-		logger.DefaultLogger.Fatalf("create publication error %s", err.Error())
+	// the publication is kept between restarts, only its tables are synced with the config
+	if err = stream.syncPublication(context.Background(), tableNames); err != nil {
+		return nil, err
 	}
-	logger.DefaultLogger.Info("Created Postgresql publication", "publication_name", config.ReplicationSlotName)
 
 	sysident, err := pglogrepl.IdentifySystem(context.Background(), stream.pgConn)
 	if err != nil {
@@ -146,14 +159,14 @@ func NewPgStream(config *Config) (*Stream, error) {
 	var freshlyCreatedSlot = false
 	var confirmedLSNFromDB string
 	// check is replication slot exist to get last restart SLN
-	connExecResult := stream.pgConn.Exec(context.TODO(), fmt.Sprintf("SELECT confirmed_flush_lsn FROM pg_replication_slots WHERE slot_name = '%s'", config.ReplicationSlotName))
+	connExecResult := stream.pgConn.Exec(context.TODO(), fmt.Sprintf("SELECT confirmed_flush_lsn, plugin FROM pg_replication_slots WHERE slot_name = '%s'", config.ReplicationSlotName))
 	if slotCheckResults, err := connExecResult.ReadAll(); err != nil {
 		logger.DefaultLogger.Fatal(err)
 	} else {
 		if len(slotCheckResults) == 0 || len(slotCheckResults[0].Rows) == 0 {
 			// here we create a new replication slot because there is no slot found
 			var createSlotResult CreateReplicationSlotResult
-			createSlotResult, err = CreateReplicationSlot(context.Background(), stream.pgConn, stream.slotName, "wal2json",
+			createSlotResult, err = CreateReplicationSlot(context.Background(), stream.pgConn, stream.slotName, config.Plugin,
 				CreateReplicationSlotOptions{Temporary: false,
 					SnapshotAction: "export",
 				})
@@ -165,10 +178,21 @@ func NewPgStream(config *Config) (*Stream, error) {
 		} else {
 			slotCheckRow := slotCheckResults[0].Rows[0]
 			confirmedLSNFromDB = string(slotCheckRow[0])
+			if plugin := string(slotCheckRow[1]); plugin != config.Plugin {
+				logger.DefaultLogger.Fatalf("Replication slot %s uses plugin %s but %s is configured, drop the slot or change the config", config.ReplicationSlotName, plugin, config.Plugin)
+			}
 			logger.DefaultLogger.Infow("Replication slot restart LSN extracted from DB", "LSN", confirmedLSNFromDB)
 		}
 	}
 
+	// checkpoints of a dropped slot would skip the snapshot of the new one
+	if stream.checkpoint != nil && freshlyCreatedSlot {
+		if err = stream.checkpoint.Reset(context.Background(), stream.slotName); err != nil {
+			return nil, fmt.Errorf("failed to reset checkpoint: %w", err)
+		}
+		logger.DefaultLogger.Infow("Checkpoint of the new replication slot was reset", "slot", stream.slotName)
+	}
+
 	var lsnrestart pglogrepl.LSN
 	if freshlyCreatedSlot {
 		lsnrestart = sysident.XLogPos
@@ -176,6 +200,19 @@ func NewPgStream(config *Config) (*Stream, error) {
 		lsnrestart, _ = pglogrepl.ParseLSN(confirmedLSNFromDB)
 	}
 
+	// the checkpoint is ahead of the slot when the last acks were not flushed before a crash
+	if stream.checkpoint != nil && !freshlyCreatedSlot {
+		checkpointLSN, err := stream.checkpoint.LoadLSN(context.Background(), stream.slotName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+		}
+
+		if lsn, err := pglogrepl.ParseLSN(checkpointLSN); err == nil && lsn > lsnrestart {
+			logger.DefaultLogger.Infow("Resume from checkpoint LSN", "LSN", checkpointLSN)
+			lsnrestart = lsn
+		}
+	}
+
 	stream.lsnrestart = lsnrestart
 
 	if freshlyCreatedSlot {
@@ -189,6 +226,10 @@ func NewPgStream(config *Config) (*Stream, error) {
 	stream.standbyMessageTimeout = time.Second * 10
 	stream.nextStandbyMessageDeadline = time.Now().Add(stream.standbyMessageTimeout)
 	stream.streamCtx, stream.streamCancel = context.WithCancel(context.Background())
+	go stream.monitorSlot()
+	if config.BackfillInterval > 0 {
+		go stream.runBackfills()
+	}
 
 	if config.StreamOldData {
 		go stream.processSnapshot()
@@ -203,7 +244,12 @@ func NewPgStream(config *Config) (*Stream, error) {
 
 func (s *Stream) startLr() {
 	var err error
-	err = pglogrepl.StartReplication(context.Background(), s.pgConn, s.slotName, s.lsnrestart, pglogrepl.StartReplicationOptions{PluginArgs: pluginArguments})
+	args := pluginArguments
+	if s.pgOutput != nil {
+		args = []string{"proto_version '1'", fmt.Sprintf("publication_names '%s'", s.publicationName)}
+	}
+
+	err = pglogrepl.StartReplication(context.Background(), s.pgConn, s.slotName, s.lsnrestart, pglogrepl.StartReplicationOptions{PluginArgs: args})
 	if err != nil {
 		logger.DefaultLogger.Fatalf("Starting replication slot failed: %s", err.Error())
 	}
@@ -233,13 +279,72 @@ func (s *Stream) AckLSN(lsn string) error {
 	return nil
 }
 
+// Commit acknowledges changes once they are handled and saves the checkpoint,
+// it should be used instead of AckLSN so snapshot progress is saved as well
+func (s *Stream) Commit(changes Wal2JsonChanges) error {
+	s.m.Lock()
+	stopped := s.stopped
+	s.m.Unlock()
+	if stopped {
+		// the connection is closed, changes are delivered again after restart
+		return nil
+	}
+
+	ctx := context.Background()
+	if changes.Lsn != nil && !changes.Partial {
+		if err := s.AckLSN(*changes.Lsn); err != nil {
+			return err
+		}
+
+		if s.checkpoint != nil {
+			if err := s.checkpoint.SaveLSN(ctx, s.slotName, *changes.Lsn); err != nil {
+				return fmt.Errorf("failed to save checkpoint LSN: %w", err)
+			}
+		}
+	}
+
+	if changes.Snapshot != nil && s.checkpoint != nil {
+		if err := s.checkpoint.SaveSnapshotProgress(ctx, s.slotName, *changes.Snapshot); err != nil {
+			return fmt.Errorf("failed to save snapshot progress: %w", err)
+		}
+	}
+
+	// backfill rows are not acknowledged, their progress is saved by the marker
+	if changes.Backfill != nil && len(changes.Changes) == 0 {
+		if err := s.saveBackfillProgress(ctx, *changes.Backfill); err != nil {
+			return fmt.Errorf("failed to save backfill progress: %w", err)
+		}
+	}
+	return nil
+}
+
 func (s *Stream) streamMessagesAsync() {
+	var (
+		// receivedLSN is the WAL position whose changes were all sent to the messages channel
+		receivedLSN pglogrepl.LSN
+		backfill    *backfillBatch
+	)
 	for {
 		select {
 		case <-s.streamCtx.Done():
 			logger.DefaultLogger.Warn("Stream was cancelled...exiting...")
 			return
 		default:
+			if backfill == nil {
+				select {
+				case backfill = <-s.backfills:
+				default:
+				}
+			}
+
+			// changes committed before the backfill rows were read are sent before them, later changes after them
+			if backfill != nil && receivedLSN >= backfill.lsn {
+				for _, change := range backfill.changes {
+					s.messages <- change
+				}
+				backfill = nil
+			}
+
 			if time.Now().After(s.nextStandbyMessageDeadline) {
 				var err error
 				err = pglogrepl.SendStandbyStatusUpdate(context.Background(), s.pgConn, pglogrepl.StandbyStatusUpdate{
@@ -290,6 +395,9 @@ func (s *Stream) streamMessagesAsync() {
 				if pkm.ReplyRequested {
 					s.nextStandbyMessageDeadline = time.Time{}
 				}
+				if pkm.ServerWALEnd > receivedLSN {
+					receivedLSN = pkm.ServerWALEnd
+				}
 
 			case pglogrepl.XLogDataByteID:
 				xld, err := pglogrepl.ParseXLogData(msg.Data[1:])
@@ -298,20 +406,44 @@ func (s *Stream) streamMessagesAsync() {
 				}
 				clientXLogPos := xld.WALStart + pglogrepl.LSN(len(xld.WALData))
 				var changes Wal2JsonChanges
-				bytesData := bytes.NewReader(xld.WALData)
-				if err := json.NewDecoder(bytesData).Decode(&changes); err != nil {
-					panic(fmt.Errorf("cant parse change from database to filter it %v", err))
+				if s.pgOutput != nil {
+					txChanges, endLSN, committed, err := s.pgOutput.Decode(xld.WALData)
+					if err != nil {
+						panic(fmt.Errorf("cant parse pgoutput message %v", err))
+					}
+					if !committed {
+						continue
+					}
+					clientXLogPos = pglogrepl.LSN(endLSN)
+					changes.Changes = txChanges
+
+					xid, commitTime := s.pgOutput.Transaction()
+					changes.Xid, changes.Timestamp = xid, commitTime.Format(commitTimeFormat)
+				} else {
+					bytesData := bytes.NewReader(xld.WALData)
+					if err := json.NewDecoder(bytesData).Decode(&changes); err != nil {
+						panic(fmt.Errorf("cant parse change from database to filter it %v", err))
+					}
+					changes.Changes = s.schemas.trackSchemaChanges(changes.Changes)
 				}
 
 				if len(changes.Changes) == 0 {
 					if s.autoAck {
 						s.AckLSN(clientXLogPos.String())
 					}
+				} else if s.conf.EmitTransactions {
+					s.changeFilter.FilterTransaction(clientXLogPos.String(), changes, func(change Wal2JsonChanges) {
+						s.messages <- change
+					})
 				} else {
 					s.changeFilter.FilterChange(clientXLogPos.String(), changes, func(change Wal2JsonChanges) {
 						s.messages <- change
 					})
 				}
+
+				if clientXLogPos > receivedLSN {
+					receivedLSN = clientXLogPos
+				}
 			}
 		}
 	}
@@ -319,138 +451,295 @@ func (s *Stream) streamMessagesAsync() {
 func (s *Stream) processSnapshot() {
 	snapshotter, err := NewSnapshotter(s.dbConfig, s.snapshotName)
 	if err != nil {
-		logger.DefaultLogger.Errorf("Failed to create database snapshot: %v", err.Error())
-		s.cleanUpOnFailure()
-		os.Exit(1)
+		s.fail(fmt.Errorf("failed to create database snapshot: %w", err))
+		return
 	}
-	if err = snapshotter.Prepare(); err != nil {
-		logger.DefaultLogger.Errorf("Failed to prepare database snapshot: %v", err.Error())
-		s.cleanUpOnFailure()
-		os.Exit(1)
+	defer snapshotter.CloseConn()
+
+	tableNames := s.Tables()
+	workers := s.conf.SnapshotWorkers
+	if workers > len(tableNames) {
+		workers = len(tableNames)
 	}
-	defer func() {
-		snapshotter.ReleaseSnapshot()
-		snapshotter.CloseConn()
-	}()
 
-	for _, table := range s.tableNames {
-		logger.DefaultLogger.Info("Processing snapshot for table", "table", table)
-
-		var (
-			avgRowSizeBytes sql.NullInt64
-			offset          = int64(0)
-		)
-		if s.conf.SnapshotOffset > 0 {
-			offset = s.conf.SnapshotOffset
+	// tables are shared by the workers, each one reads a table at a time in its own transaction on the exported snapshot
+	tables := make(chan string, len(tableNames))
+	for _, table := range tableNames {
+		tables <- table
+	}
+	close(tables)
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for table := range tables {
+				if err := s.snapshotTable(snapshotter, table, workers); err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("snapshot of table %s failed: %w", table, err)
+					})
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.m.Lock()
+	stopped := s.stopped
+	s.snapshotting = false
+	s.m.Unlock()
+	if stopped {
+		// queries of the workers are canceled by Stop
+		return
+	}
+
+	if firstErr != nil {
+		s.fail(firstErr)
+		return
+	}
+
+	s.startLr()
+	go s.streamMessagesAsync()
+}
+
+func (s *Stream) snapshotTable(snapshotter *Snapshotter, table string, workers int) error {
+	ctx := s.streamCtx
+	progress := &SnapshotProgress{Table: table}
+	if s.conf.SnapshotOffset > 0 {
+		logger.DefaultLogger.Warnw("snapshot_offset is ignored, snapshots resume from the checkpoint", "table", table)
+	}
+
+	if s.checkpoint != nil {
+		saved, err := s.checkpoint.LoadSnapshotProgress(ctx, s.slotName, table)
+		if err != nil {
+			return fmt.Errorf("failed to load snapshot progress: %w", err)
+		}
+
+		if saved != nil && saved.Done {
+			logger.DefaultLogger.Infow("Snapshot of table is already done", "table", table)
+			s.setSnapshotProgress(*saved)
+			return nil
+		}
+
+		if saved != nil {
+			logger.DefaultLogger.Infow("Resume snapshot of table", "table", table, "rows", saved.Offset, "last_key", saved.LastKey)
+			progress = saved
+		}
+	}
+
+	tx, err := snapshotter.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	avgRowSize, err := snapshotter.FindAvgRowSize(ctx, tx, table)
+	if err != nil {
+		return err
+	}
+
+	pk, err := snapshotter.GetPrimaryKeyColumns(ctx, tx, table)
+	if err != nil {
+		return err
+	}
+
+	memUsage := utils.GetAvailableMemory() / uint64(workers)
+	batchSize := int64(snapshotter.CalculateBatchSize(memUsage, uint64(avgRowSize)))
+	if batchSize > int64(s.snapshotBatchSize) {
+		batchSize = int64(s.snapshotBatchSize)
+	}
+
+	schema, tableName := s.schema, table
+	if before, after, found := strings.Cut(table, "."); found {
+		schema, tableName = before, after
+	}
+
+	startedAt := time.Now()
+	logger.DefaultLogger.Infow("Processing snapshot for table", "table", table, "pk", pk, "batch_size", batchSize, "avg_row_size", avgRowSize)
+	for {
+		if err = s.waitSnapshotResume(); err != nil {
+			return err
 		}
-		avgRowSizeBytes = snapshotter.FindAvgRowSize(table)
 
-		memUsage := utils.GetAvailableMemory()
-		batchSize := int64(snapshotter.CalculateBatchSize(memUsage, uint64(avgRowSizeBytes.Int64)))
-		logger.DefaultLogger.Info("Querying snapshot", "batch_side", batchSize, "available_memory", memUsage, "avg_row_size", avgRowSizeBytes.Int64)
+		rows, err := snapshotter.QuerySnapshotData(ctx, tx, table, pk, progress.LastKey, batchSize)
+		if err != nil {
+			return err
+		}
 
-		tablePk, err := s.getPrimaryKeyColumn(table)
+		count, lastKey, err := s.sendSnapshotRows(rows, schema, tableName, pk, s.sendSnapshotMessage)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
-		for {
-			var snapshotRows *sql.Rows
-			if snapshotRows, err = snapshotter.QuerySnapshotData(table, tablePk, batchSize, offset); err != nil {
-				log.Fatalf("Can't query snapshot data %v", err)
-			}
+		progress.Offset += count
+		if count > 0 {
+			progress.LastKey = lastKey
+		}
+		progress.Done = count < batchSize
+
+		// the marker is handled after the rows of the batch, its progress is saved by Commit
+		s.setSnapshotProgress(*progress)
+		marker := Wal2JsonChanges{Snapshot: &SnapshotProgress{
+			Table:   progress.Table,
+			Offset:  progress.Offset,
+			LastKey: progress.LastKey,
+			Done:    progress.Done,
+		}}
+		if err = s.sendSnapshotMessage(marker); err != nil {
+			return err
+		}
 
-			columnTypes, err := snapshotRows.ColumnTypes()
-			var columnTypesString = make([]string, len(columnTypes))
-			columnNames, err := snapshotRows.Columns()
-			for i, _ := range columnNames {
-				columnTypesString[i] = columnTypes[i].DatabaseTypeName()
-			}
+		logger.DefaultLogger.Infow("Snapshot progress", "table", table, "rows", progress.Offset, "done", progress.Done, "elapsed", time.Since(startedAt).String())
+		if progress.Done {
+			return nil
+		}
+	}
+}
 
-			if err != nil {
-				panic(err)
-			}
+// sendSnapshotRows sends the rows as insert changes with values converted by pg_converter, it returns the row count and the key of the last row
+func (s *Stream) sendSnapshotRows(rows *sql.Rows, schema, table string, pk []string, send func(msg Wal2JsonChanges) error) (int64, []string, error) {
+	defer rows.Close()
 
-			count := len(columnTypes)
-			var rowsCount = 0
-			for snapshotRows.Next() {
-				rowsCount += 1
-				scanArgs := make([]interface{}, count)
-				for i, v := range columnTypes {
-					switch v.DatabaseTypeName() {
-					case "VARCHAR", "TEXT", "UUID", "TIMESTAMP":
-						scanArgs[i] = new(sql.NullString)
-						break
-					case "BOOL":
-						scanArgs[i] = new(sql.NullBool)
-						break
-					case "INT4":
-						scanArgs[i] = new(sql.NullInt64)
-						break
-					default:
-						scanArgs[i] = new(sql.NullString)
-					}
-				}
+	columnNames, err := rows.Columns()
+	if err != nil {
+		return 0, nil, err
+	}
 
-				err := snapshotRows.Scan(scanArgs...)
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, nil, err
+	}
 
-				if err != nil {
-					panic(err)
-				}
+	typeNames := make([]string, len(columnTypes))
+	column2index := make(map[string]int, len(columnNames))
+	for i, columnType := range columnTypes {
+		typeNames[i] = strings.ToLower(columnType.DatabaseTypeName())
+		column2index[columnNames[i]] = i
+	}
 
-				var columnValues = make([]interface{}, len(columnTypes))
-				for i, _ := range columnTypes {
-					if z, ok := (scanArgs[i]).(*sql.NullBool); ok {
-						columnValues[i] = z.Bool
-						continue
-					}
-					if z, ok := (scanArgs[i]).(*sql.NullString); ok {
-						columnValues[i] = z.String
-						continue
-					}
-					if z, ok := (scanArgs[i]).(*sql.NullInt64); ok {
-						columnValues[i] = z.Int64
-						continue
-					}
-					if z, ok := (scanArgs[i]).(*sql.NullFloat64); ok {
-						columnValues[i] = z.Float64
-						continue
-					}
-					if z, ok := (scanArgs[i]).(*sql.NullInt32); ok {
-						columnValues[i] = z.Int32
-						continue
-					}
+	var (
+		count   int64
+		lastKey []string
+	)
+	for rows.Next() {
+		raw := make([]interface{}, len(columnNames))
+		scanArgs := make([]interface{}, len(columnNames))
+		for i := range raw {
+			scanArgs[i] = &raw[i]
+		}
 
-					columnValues[i] = scanArgs[i]
-				}
+		if err = rows.Scan(scanArgs...); err != nil {
+			return count, lastKey, err
+		}
 
-				var snapshotChanges []Wal2JsonChange
-				snapshotChanges = append(snapshotChanges, Wal2JsonChange{
-					Kind:         "insert",
-					Schema:       s.schema,
-					Table:        table,
-					ColumnNames:  columnNames,
-					ColumnValues: columnValues,
-				})
-				var lsn *string
-				snapshotChangePacket := Wal2JsonChanges{
-					Lsn:     lsn,
-					Changes: snapshotChanges,
-				}
+		columnValues := make([]interface{}, len(raw))
+		for i, v := range raw {
+			columnValues[i] = s.convertSnapshotValue(typeNames[i], v)
+		}
 
-				s.snapshotMessages <- snapshotChangePacket
-			}
+		lastKey = make([]string, len(pk))
+		for i, column := range pk {
+			lastKey[i] = keyString(raw[column2index[column]])
+		}
 
-			offset += batchSize
+		// rows filtered out by the table filter are still counted to page through the table
+		count++
+		change, keep := s.changeFilter.transform(Wal2JsonChange{
+			Kind:         KindInsert,
+			Schema:       schema,
+			Table:        table,
+			ColumnNames:  columnNames,
+			ColumnTypes:  typeNames,
+			ColumnValues: columnValues,
+		})
+		if !keep {
+			continue
+		}
 
-			if batchSize != int64(rowsCount) {
-				break
-			}
+		if err = send(Wal2JsonChanges{Changes: []Wal2JsonChange{change}}); err != nil {
+			return count, lastKey, err
 		}
+	}
+	return count, lastKey, rows.Err()
+}
 
+// sendSnapshotMessage blocks until OnMessage takes msg, it fails when the stream is stopped
+func (s *Stream) sendSnapshotMessage(msg Wal2JsonChanges) error {
+	select {
+	case s.snapshotMessages <- msg:
+		return nil
+	case <-s.streamCtx.Done():
+		return s.streamCtx.Err()
 	}
-	s.startLr()
-	go s.streamMessagesAsync()
+}
+
+func (s *Stream) convertSnapshotValue(typeName string, v interface{}) interface{} {
+	// bytea is kept as bytes, other text values come as bytes from the driver
+	if typeName == "bytea" {
+		return v
+	}
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+
+	converted, err := s.converter.ConvertValue(typeName, v)
+	if err != nil {
+		logger.DefaultLogger.Debugf("Can not convert snapshot value of type %s: %v", typeName, err)
+		return v
+	}
+	return converted
+}
+
+func (s *Stream) setSnapshotProgress(progress SnapshotProgress) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.snapshotProgress[progress.Table] = progress
+}
+
+// GetSnapshotProgress returns the snapshot progress of the tables processed so far
+func (s *Stream) GetSnapshotProgress() []SnapshotProgress {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	resp := make([]SnapshotProgress, 0, len(s.snapshotProgress))
+	for _, table := range s.tableNames {
+		if progress, ok := s.snapshotProgress[table]; ok {
+			resp = append(resp, progress)
+		}
+	}
+	return resp
+}
+
+// Context is canceled when the stream is stopped
+func (s *Stream) Context() context.Context {
+	return s.streamCtx
+}
+
+// Err returns the error which stopped the stream, nil if it was stopped by Stop
+func (s *Stream) Err() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.err
+}
+
+// fail stops the stream on an unrecoverable error
+func (s *Stream) fail(err error) {
+	logger.DefaultLogger.Errorf("Replication stream failed: %v", err)
+	s.m.Lock()
+	s.err = err
+	s.m.Unlock()
+
+	// without checkpoint the slot is dropped, so the next start takes a new snapshot
+	if s.checkpoint == nil && len(s.snapshotName) > 0 {
+		s.cleanUpOnFailure()
+	}
+	_ = s.Stop()
 }
 
 func (s *Stream) OnMessage(callback OnMessage) {
@@ -484,27 +773,6 @@ func (s *Stream) cleanUpOnFailure() {
 	s.pgConn.Close(context.TODO())
 }
 
-func (s *Stream) getPrimaryKeyColumn(tableName string) (string, error) {
-	q := fmt.Sprintf(`
-		SELECT a.attname
-		FROM   pg_index i
-		JOIN   pg_attribute a ON a.attrelid = i.indrelid
-							 AND a.attnum = ANY(i.indkey)
-		WHERE  i.indrelid = '%s'::regclass
-		AND    i.indisprimary;
-	`, tableName)
-
-	reader := s.pgConn.Exec(context.Background(), q)
-	data, err := reader.ReadAll()
-	if err != nil {
-		return "", err
-	}
-
-	pkResultRow := data[0].Rows[0]
-	pkColName := string(pkResultRow[0])
-	return pkColName, nil
-}
-
 func (s *Stream) Stop() error {
 	s.m.Lock()
 	s.stopped = true
@@ -513,6 +781,8 @@ func (s *Stream) Stop() error {
 	if s.pgConn != nil {
 		if s.streamCtx != nil {
 			s.streamCancel()
+		}
+		if s.standbyCtxCancel != nil {
 			s.standbyCtxCancel()
 		}
 		return s.pgConn.Close(context.Background())
@@ -0,0 +1,204 @@
+package pglogicalstream
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	PluginWal2Json = "wal2json"
+	PluginPgOutput = "pgoutput"
+)
+
+// relation column flag marking the column as part of the replica identity
+const relationColumnKeyFlag = uint8(1)
+
+// pgOutputDecoder converts pgoutput messages to the wal2json shape. pgoutput sends one message per XLogData,
+// so changes are buffered from Begin to Commit and emitted as one Wal2JsonChanges per transaction, like wal2json does.
+type pgOutputDecoder struct {
+	relations map[uint32]*RelationMessage
+	versions  map[uint32]int
+	schemas   *schemaTracker
+	types     map[uint32]string
+	typeMap   *pgtype.Map
+	changes   []Wal2JsonChange
+	// transaction of the buffered changes, from the Begin message
+	xid        uint32
+	commitTime time.Time
+}
+
+func newPgOutputDecoder() *pgOutputDecoder {
+	return &pgOutputDecoder{
+		relations: make(map[uint32]*RelationMessage),
+		versions:  make(map[uint32]int),
+		schemas:   newSchemaTracker(),
+		types:     make(map[uint32]string),
+		typeMap:   pgtype.NewMap(),
+	}
+}
+
+// Decode handles one pgoutput message, committed is true when data is a commit message,
+// then changes holds all changes of the transaction and endLSN is the position to acknowledge
+func (d *pgOutputDecoder) Decode(data []byte) (changes []Wal2JsonChange, endLSN LSN, committed bool, err error) {
+	msg, err := Parse(data)
+	if err != nil {
+		if err == errMsgNotSupported {
+			// streaming of in-progress transactions is not requested, other messages are not needed
+			return nil, 0, false, nil
+		}
+		return nil, 0, false, err
+	}
+
+	switch m := msg.(type) {
+	case *BeginMessage:
+		d.changes = nil
+		d.xid, d.commitTime = m.Xid, m.CommitTime
+	case *CommitMessage:
+		changes, d.changes = d.changes, nil
+		return changes, m.TransactionEndLSN, true, nil
+	case *RelationMessage:
+		// relations are sent before the first change of a table and again after its schema changed
+		d.relations[m.RelationID] = m
+
+		names, types := d.relationColumns(m)
+		version, changed := d.schemas.Track(m.Namespace, m.RelationName, names, types)
+		d.versions[m.RelationID] = version
+		if changed {
+			d.changes = append(d.changes, schemaChange(m.Namespace, m.RelationName, names, types, version))
+		}
+	case *TypeMessage:
+		d.types[m.DataType] = m.Name
+	case *InsertMessage:
+		rel, err := d.getRelation(m.RelationID)
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		change := Wal2JsonChange{Kind: KindInsert, Schema: rel.Namespace, Table: rel.RelationName, SchemaVersion: d.versions[m.RelationID]}
+		change.ColumnNames, change.ColumnTypes, change.ColumnValues = d.decodeTuple(rel, m.Tuple, false)
+		d.changes = append(d.changes, change)
+	case *UpdateMessage:
+		rel, err := d.getRelation(m.RelationID)
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		change := Wal2JsonChange{Kind: KindUpdate, Schema: rel.Namespace, Table: rel.RelationName, SchemaVersion: d.versions[m.RelationID]}
+		change.ColumnNames, change.ColumnTypes, change.ColumnValues = d.decodeTuple(rel, m.NewTuple, false)
+
+		// the old tuple is only sent when the key changed or with REPLICA IDENTITY FULL,
+		// otherwise the key is taken from the new tuple like wal2json does
+		oldTuple, keyOnly := m.NewTuple, true
+		if m.OldTuple != nil {
+			oldTuple, keyOnly = m.OldTuple, m.OldTupleType == UpdateMessageTupleTypeKey
+		}
+		change.OldData.Keynames, change.OldData.Keytypes, change.OldData.Keyvalues = d.decodeTuple(rel, oldTuple, keyOnly)
+		d.changes = append(d.changes, change)
+	case *DeleteMessage:
+		rel, err := d.getRelation(m.RelationID)
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		change := Wal2JsonChange{Kind: KindDelete, Schema: rel.Namespace, Table: rel.RelationName, SchemaVersion: d.versions[m.RelationID]}
+		change.OldData.Keynames, change.OldData.Keytypes, change.OldData.Keyvalues = d.decodeTuple(rel, m.OldTuple, m.OldTupleType == DeleteMessageTupleTypeKey)
+		d.changes = append(d.changes, change)
+	case *TruncateMessage:
+		// one change per table, tables truncated by CASCADE are listed too
+		for _, id := range m.RelationIDs {
+			rel, err := d.getRelation(id)
+			if err != nil {
+				return nil, 0, false, err
+			}
+			d.changes = append(d.changes, Wal2JsonChange{Kind: KindTruncate, Schema: rel.Namespace, Table: rel.RelationName, SchemaVersion: d.versions[id]})
+		}
+	}
+
+	return nil, 0, false, nil
+}
+
+// Transaction returns the XID and commit time of the last decoded transaction
+func (d *pgOutputDecoder) Transaction() (xid uint32, commitTime time.Time) {
+	return d.xid, d.commitTime
+}
+
+func (d *pgOutputDecoder) getRelation(id uint32) (*RelationMessage, error) {
+	rel, ok := d.relations[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown relation %d, relation message must be received before changes", id)
+	}
+	return rel, nil
+}
+
+func (d *pgOutputDecoder) relationColumns(rel *RelationMessage) ([]string, []string) {
+	names := make([]string, len(rel.Columns))
+	types := make([]string, len(rel.Columns))
+	for i, col := range rel.Columns {
+		names[i] = col.Name
+		types[i] = d.getTypeName(col.DataType)
+	}
+	return names, types
+}
+
+// decodeTuple returns names, types and values of the tuple columns, unchanged TOAST columns are skipped as their value is not sent
+func (d *pgOutputDecoder) decodeTuple(rel *RelationMessage, tuple *TupleData, keyOnly bool) ([]string, []string, []interface{}) {
+	if tuple == nil {
+		return nil, nil, nil
+	}
+
+	names := make([]string, 0, len(tuple.Columns))
+	types := make([]string, 0, len(tuple.Columns))
+	values := make([]interface{}, 0, len(tuple.Columns))
+	for i, col := range tuple.Columns {
+		if i >= len(rel.Columns) || col.DataType == TupleDataTypeToast {
+			continue
+		}
+
+		relCol := rel.Columns[i]
+		if keyOnly && relCol.Flags&relationColumnKeyFlag == 0 {
+			continue
+		}
+
+		typeName := d.getTypeName(relCol.DataType)
+		names = append(names, relCol.Name)
+		types = append(types, typeName)
+		values = append(values, decodeTextValue(typeName, col))
+	}
+	return names, types, values
+}
+
+// getTypeName returns the pg_type name of oid (int8, timestamptz, _text...), custom types come from Type messages
+func (d *pgOutputDecoder) getTypeName(oid uint32) string {
+	if t, ok := d.typeMap.TypeForOID(oid); ok {
+		return t.Name
+	}
+	if name, ok := d.types[oid]; ok {
+		return name
+	}
+	return "text"
+}
+
+// decodeTextValue converts the text representation of a column to the JSON value wal2json would send
+func decodeTextValue(typeName string, col *TupleDataColumn) interface{} {
+	if col.DataType == TupleDataTypeNull {
+		return nil
+	}
+
+	text := string(col.Data)
+	switch typeName {
+	case "int2", "int4", "int8", "oid":
+		if v, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return v
+		}
+	case "float4", "float8", "numeric":
+		if v, err := strconv.ParseFloat(text, 64); err == nil {
+			return v
+		}
+	case "bool":
+		return text == "t"
+	}
+	return text
+}
@@ -0,0 +1,106 @@
+package pglogicalstream
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+type pgOutputBuilder []byte
+
+func (b pgOutputBuilder) byte(v byte) pgOutputBuilder { return append(b, v) }
+func (b pgOutputBuilder) uint16(v uint16) pgOutputBuilder {
+	return binary.BigEndian.AppendUint16(b, v)
+}
+func (b pgOutputBuilder) uint32(v uint32) pgOutputBuilder {
+	return binary.BigEndian.AppendUint32(b, v)
+}
+func (b pgOutputBuilder) uint64(v uint64) pgOutputBuilder {
+	return binary.BigEndian.AppendUint64(b, v)
+}
+func (b pgOutputBuilder) string(v string) pgOutputBuilder { return append(append(b, v...), 0) }
+func (b pgOutputBuilder) text(v string) pgOutputBuilder {
+	return b.byte(TupleDataTypeText).uint32(uint32(len(v))).bytes(v)
+}
+func (b pgOutputBuilder) bytes(v string) pgOutputBuilder { return append(b, v...) }
+
+func TestPgOutputDecoder(t *testing.T) {
+	relation := pgOutputBuilder{'R'}.uint32(16384).string("public").string("users").byte('d').uint16(3).
+		byte(1).string("id").uint32(20).uint32(0xffffffff).
+		byte(0).string("name").uint32(25).uint32(0xffffffff).
+		byte(0).string("is_online").uint32(16).uint32(0xffffffff)
+	insert := pgOutputBuilder{'I'}.uint32(16384).byte('N').uint16(3).text("1").text("john").text("t")
+	update := pgOutputBuilder{'U'}.uint32(16384).byte('N').uint16(3).text("1").byte(TupleDataTypeToast).byte(TupleDataTypeNull)
+	del := pgOutputBuilder{'D'}.uint32(16384).byte('K').uint16(3).text("1").byte(TupleDataTypeNull).byte(TupleDataTypeNull)
+	commit := pgOutputBuilder{'C'}.byte(0).uint64(100).uint64(200).uint64(0)
+
+	d := newPgOutputDecoder()
+	for _, msg := range []pgOutputBuilder{relation, insert, update, del} {
+		if _, _, committed, err := d.Decode(msg); err != nil || committed {
+			t.Fatalf("unexpected decode result %v %v", committed, err)
+		}
+	}
+
+	changes, endLSN, committed, err := d.Decode(commit)
+	if err != nil || !committed || endLSN != 200 || len(changes) != 3 {
+		t.Fatalf("unexpected commit result %v %v %v %d", err, committed, endLSN, len(changes))
+	}
+
+	insertChange := changes[0]
+	if insertChange.Kind != "insert" || insertChange.Table != "users" || insertChange.ColumnValues[0] != int64(1) ||
+		insertChange.ColumnValues[1] != "john" || insertChange.ColumnValues[2] != true || insertChange.ColumnTypes[0] != "int8" {
+		t.Fatalf("unexpected insert change %+v", insertChange)
+	}
+
+	updateChange := changes[1]
+	if len(updateChange.ColumnNames) != 2 || updateChange.ColumnValues[1] != nil || updateChange.OldData.Keynames[0] != "id" {
+		t.Fatalf("unexpected update change %+v", updateChange)
+	}
+
+	deleteChange := changes[2]
+	if deleteChange.Kind != "delete" || len(deleteChange.OldData.Keynames) != 1 || deleteChange.OldData.Keyvalues[0] != int64(1) {
+		t.Fatalf("unexpected delete change %+v", deleteChange)
+	}
+}
+
+func TestPgOutputDecoderSchemaChangeAndTruncate(t *testing.T) {
+	relation := pgOutputBuilder{'R'}.uint32(16384).string("public").string("users").byte('d').uint16(1).
+		byte(1).string("id").uint32(20).uint32(0xffffffff)
+	altered := pgOutputBuilder{'R'}.uint32(16384).string("public").string("users").byte('d').uint16(2).
+		byte(1).string("id").uint32(20).uint32(0xffffffff).
+		byte(0).string("email").uint32(25).uint32(0xffffffff)
+	insert := pgOutputBuilder{'I'}.uint32(16384).byte('N').uint16(2).text("2").text("a@b.c")
+	truncate := pgOutputBuilder{'T'}.uint32(1).byte(0).uint32(16384)
+	commit := pgOutputBuilder{'C'}.byte(0).uint64(100).uint64(200).uint64(0)
+
+	d := newPgOutputDecoder()
+	for _, msg := range []pgOutputBuilder{relation, altered, insert, truncate} {
+		if _, _, _, err := d.Decode(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes, _, _, err := d.Decode(commit)
+	if err != nil || len(changes) != 3 {
+		t.Fatalf("unexpected commit result %v %+v", err, changes)
+	}
+
+	if changes[0].Kind != KindSchemaChange || changes[0].SchemaVersion != 2 || len(changes[0].ColumnNames) != 2 || changes[0].ColumnTypes[1] != "text" {
+		t.Fatalf("unexpected schema change %+v", changes[0])
+	}
+	if changes[1].Kind != KindInsert || changes[1].SchemaVersion != 2 {
+		t.Fatalf("unexpected insert change %+v", changes[1])
+	}
+	if changes[2].Kind != KindTruncate || changes[2].Table != "users" {
+		t.Fatalf("unexpected truncate change %+v", changes[2])
+	}
+
+	// wal2json changes are versioned from inserts
+	tracker := newSchemaTracker()
+	tracked := tracker.trackSchemaChanges([]Wal2JsonChange{
+		{Kind: KindInsert, Schema: "public", Table: "users", ColumnNames: []string{"id"}, ColumnTypes: []string{"bigint"}},
+		{Kind: KindInsert, Schema: "public", Table: "users", ColumnNames: []string{"id", "email"}, ColumnTypes: []string{"bigint", "text"}},
+	})
+	if len(tracked) != 3 || tracked[1].Kind != KindSchemaChange || tracked[2].SchemaVersion != 2 {
+		t.Fatalf("unexpected tracked changes %+v", tracked)
+	}
+}
@@ -0,0 +1,124 @@
+package pglogicalstream
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/nhdms/base-go/pkg/utils"
+)
+
+// syncPublication creates the publication or adds and removes its tables to match tables (schema qualified).
+// It runs on the replication connection, so it must be called before the replication starts.
+func (s *Stream) syncPublication(ctx context.Context, tables []string) error {
+	results, err := s.pgConn.Exec(ctx, fmt.Sprintf("SELECT 1 FROM pg_publication WHERE pubname = '%s';", s.publicationName)).ReadAll()
+	if err != nil {
+		return fmt.Errorf("failed to check publication %s: %w", s.publicationName, err)
+	}
+
+	if len(results) == 0 || len(results[0].Rows) == 0 {
+		query := fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s;", s.publicationName, strings.Join(tables, ","))
+		logger.DefaultLogger.Infof("Create publication for table schemas with query %s", query)
+		if _, err = s.pgConn.Exec(ctx, query).ReadAll(); err != nil {
+			return fmt.Errorf("failed to create publication %s: %w", s.publicationName, err)
+		}
+		return nil
+	}
+
+	results, err = s.pgConn.Exec(ctx, fmt.Sprintf("SELECT schemaname || '.' || tablename FROM pg_publication_tables WHERE pubname = '%s';", s.publicationName)).ReadAll()
+	if err != nil {
+		return fmt.Errorf("failed to get tables of publication %s: %w", s.publicationName, err)
+	}
+
+	var published []string
+	for _, row := range results[0].Rows {
+		published = append(published, string(row[0]))
+	}
+
+	var queries []string
+	for _, table := range tables {
+		if !utils.StringSliceContains(published, table) {
+			queries = append(queries, fmt.Sprintf("ALTER PUBLICATION %s ADD TABLE %s;", s.publicationName, table))
+		}
+	}
+	for _, table := range published {
+		if !utils.StringSliceContains(tables, table) {
+			queries = append(queries, fmt.Sprintf("ALTER PUBLICATION %s DROP TABLE %s;", s.publicationName, table))
+		}
+	}
+
+	for _, query := range queries {
+		logger.DefaultLogger.Infof("Sync publication tables with query %s", query)
+		if _, err = s.pgConn.Exec(ctx, query).ReadAll(); err != nil {
+			return fmt.Errorf("failed to sync publication %s: %w", s.publicationName, err)
+		}
+	}
+	return nil
+}
+
+// AddTables adds tables of the stream schema to the publication and the filter while streaming, the slot is kept.
+// Changes are streamed from the next transaction, existing rows are not snapshotted.
+// Add the tables to the config too, tables not in the config are removed from the publication on the next start.
+func (s *Stream) AddTables(ctx context.Context, tables ...string) error {
+	return s.alterPublicationTables(ctx, tables, true)
+}
+
+// RemoveTables removes tables from the publication and the filter while streaming, the slot is kept
+func (s *Stream) RemoveTables(ctx context.Context, tables ...string) error {
+	return s.alterPublicationTables(ctx, tables, false)
+}
+
+// Tables returns the schema qualified tables of the stream
+func (s *Stream) Tables() []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]string(nil), s.tableNames...)
+}
+
+func (s *Stream) alterPublicationTables(ctx context.Context, tables []string, add bool) error {
+	// the replication connection is busy with streaming, a regular connection is used
+	db, err := sql.Open("postgres", connectionString(s.dbConfig))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	action := "DROP"
+	if add {
+		action = "ADD"
+	}
+
+	for _, table := range tables {
+		qualified := fmt.Sprintf("%s.%s", s.schema, table)
+		s.m.Lock()
+		exists := utils.StringSliceContains(s.tableNames, qualified)
+		s.m.Unlock()
+		if exists == add {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER PUBLICATION %s %s TABLE %s;", s.publicationName, action, qualified)
+		logger.DefaultLogger.Infof("Alter publication tables with query %s", query)
+		if _, err = db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to %s table %s: %w", strings.ToLower(action), qualified, err)
+		}
+
+		s.changeFilter.SetTable(table, add)
+		s.m.Lock()
+		if add {
+			s.tableNames = append(s.tableNames, qualified)
+		} else {
+			tableNames := make([]string, 0, len(s.tableNames))
+			for _, t := range s.tableNames {
+				if t != qualified {
+					tableNames = append(tableNames, t)
+				}
+			}
+			s.tableNames = tableNames
+		}
+		s.m.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package pglogicalstream
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	KindInsert       = "insert"
+	KindUpdate       = "update"
+	KindDelete       = "delete"
+	KindTruncate     = "truncate"
+	KindSchemaChange = "schema_change"
+)
+
+type tableSchema struct {
+	version int
+	columns string
+}
+
+// schemaTracker versions the column layout of tables. The first layout seen after start is version 1
+// and is not reported, every following layout change increments the version.
+type schemaTracker struct {
+	m      sync.Mutex
+	tables map[string]*tableSchema
+}
+
+func newSchemaTracker() *schemaTracker {
+	return &schemaTracker{tables: make(map[string]*tableSchema)}
+}
+
+// Track records the columns of table, changed is true when they differ from the last layout
+func (t *schemaTracker) Track(schema, table string, names, types []string) (version int, changed bool) {
+	columns := strings.Join(names, ",") + "|" + strings.Join(types, ",")
+	key := schema + "." + table
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	s, ok := t.tables[key]
+	if !ok {
+		t.tables[key] = &tableSchema{version: 1, columns: columns}
+		return 1, false
+	}
+
+	if s.columns != columns {
+		s.version++
+		s.columns = columns
+		return s.version, true
+	}
+	return s.version, false
+}
+
+// schemaChange is the change emitted before the first change with a new column layout, it has no values
+func schemaChange(schema, table string, names, types []string, version int) Wal2JsonChange {
+	return Wal2JsonChange{
+		Kind:          KindSchemaChange,
+		Schema:        schema,
+		Table:         table,
+		ColumnNames:   names,
+		ColumnTypes:   types,
+		SchemaVersion: version,
+	}
+}
+
+// trackSchemaChanges inserts schema changes for wal2json, which has no relation messages. Only inserts are
+// compared as they always have all columns, updates skip unchanged TOAST columns.
+func (t *schemaTracker) trackSchemaChanges(changes []Wal2JsonChange) []Wal2JsonChange {
+	tracked := make([]Wal2JsonChange, 0, len(changes))
+	for _, ch := range changes {
+		if ch.Kind == KindInsert {
+			version, changed := t.Track(ch.Schema, ch.Table, ch.ColumnNames, ch.ColumnTypes)
+			if changed {
+				tracked = append(tracked, schemaChange(ch.Schema, ch.Table, ch.ColumnNames, ch.ColumnTypes, version))
+			}
+			ch.SchemaVersion = version
+		}
+		tracked = append(tracked, ch)
+	}
+	return tracked
+}
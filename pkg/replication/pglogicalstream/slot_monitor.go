@@ -0,0 +1,203 @@
+package pglogicalstream
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nhdms/base-go/pkg/logger"
+)
+
+// slotMetrics publishes the status of the monitored slots by slot name, served by expvar at /debug/vars
+var slotMetrics = expvar.NewMap("replication_slots")
+
+// SlotStatus is the state of a replication slot, LagBytes is the WAL not confirmed by the consumer
+// and RetainedBytes the WAL postgres keeps on disk for the slot
+type SlotStatus struct {
+	SlotName          string    `json:"slot_name"`
+	Plugin            string    `json:"plugin"`
+	Active            bool      `json:"active"`
+	ConfirmedFlushLSN string    `json:"confirmed_flush_lsn"`
+	RestartLSN        string    `json:"restart_lsn"`
+	CurrentLSN        string    `json:"current_lsn"`
+	LagBytes          int64     `json:"lag_bytes"`
+	RetainedBytes     int64     `json:"retained_bytes"`
+	CheckedAt         time.Time `json:"checked_at"`
+	Alarm             bool      `json:"alarm"`
+	SnapshotPaused    bool      `json:"snapshot_paused"`
+}
+
+const slotStatusQuery = `SELECT slot_name, COALESCE(plugin, ''), active,
+		COALESCE(confirmed_flush_lsn::text, ''), COALESCE(restart_lsn::text, ''), pg_current_wal_lsn()::text,
+		COALESCE(pg_wal_lsn_diff(pg_current_wal_lsn(), confirmed_flush_lsn), 0)::bigint,
+		COALESCE(pg_wal_lsn_diff(pg_current_wal_lsn(), restart_lsn), 0)::bigint
+	FROM pg_replication_slots`
+
+// ListSlots returns the status of all replication slots of the database
+func ListSlots(ctx context.Context, db *sql.DB) ([]SlotStatus, error) {
+	rows, err := db.QueryContext(ctx, slotStatusQuery+" ORDER BY slot_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var slots []SlotStatus
+	for rows.Next() {
+		slot, err := scanSlotStatus(rows)
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, slot)
+	}
+	return slots, rows.Err()
+}
+
+// GetSlotStatus returns the status of slot, sql.ErrNoRows if it does not exist
+func GetSlotStatus(ctx context.Context, db *sql.DB, slot string) (SlotStatus, error) {
+	return scanSlotStatus(db.QueryRowContext(ctx, slotStatusQuery+" WHERE slot_name = $1", slot))
+}
+
+// DropSlot drops an inactive slot, the publication NewPgStream created for it and, with checkpoint, its checkpoints
+func DropSlot(ctx context.Context, db *sql.DB, slot string, checkpoint CheckpointStore) error {
+	if _, err := db.ExecContext(ctx, "SELECT pg_drop_replication_slot($1)", slot); err != nil {
+		return fmt.Errorf("failed to drop replication slot %s: %w", slot, err)
+	}
+
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("DROP PUBLICATION IF EXISTS pglog_stream_%s", slot)); err != nil {
+		return fmt.Errorf("failed to drop publication of slot %s: %w", slot, err)
+	}
+
+	if checkpoint != nil {
+		if err := checkpoint.Reset(ctx, slot); err != nil {
+			return fmt.Errorf("failed to reset checkpoint of slot %s: %w", slot, err)
+		}
+	}
+	return nil
+}
+
+func scanSlotStatus(row interface{ Scan(...interface{}) error }) (SlotStatus, error) {
+	s := SlotStatus{CheckedAt: time.Now()}
+	err := row.Scan(&s.SlotName, &s.Plugin, &s.Active, &s.ConfirmedFlushLSN, &s.RestartLSN, &s.CurrentLSN, &s.LagBytes, &s.RetainedBytes)
+	return s, err
+}
+
+// monitorSlot checks the slot every SlotMonitorInterval until the stream stops. Above SlotLagAlarmBytes
+// the alarm is logged and OnSlotAlarm is called, above SlotLagPauseBytes the snapshot is paused until the lag is lower.
+func (s *Stream) monitorSlot() {
+	db, err := sql.Open("postgres", connectionString(s.dbConfig))
+	if err != nil {
+		logger.DefaultLogger.Errorf("Failed to open connection for slot monitoring: %v", err)
+		return
+	}
+	defer db.Close()
+
+	slotMetrics.Set(s.slotName, expvar.Func(func() interface{} {
+		return s.SlotStatus()
+	}))
+
+	ticker := time.NewTicker(s.conf.SlotMonitorInterval)
+	defer ticker.Stop()
+	for {
+		s.checkSlot(db)
+
+		select {
+		case <-s.streamCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Stream) checkSlot(db *sql.DB) {
+	ctx, cancel := context.WithTimeout(s.streamCtx, s.conf.SlotMonitorInterval)
+	defer cancel()
+
+	slots, err := ListSlots(ctx, db)
+	if err != nil {
+		logger.DefaultLogger.Errorf("Failed to get status of replication slot %s: %v", s.slotName, err)
+		return
+	}
+	s.updateSlotStatus(slots)
+}
+
+// updateSlotStatus sets the status of the slot of the stream from the status of all slots of the database.
+// The slot is not confirmed before the snapshot is done, so pausing the snapshot can not lower its retained WAL:
+// while the snapshot runs, only the WAL retained by the other slots pauses it, the slot itself only raises the alarm.
+func (s *Stream) updateSlotStatus(slots []SlotStatus) {
+	var (
+		status        SlotStatus
+		found         bool
+		otherRetained int64
+	)
+	for _, slot := range slots {
+		if slot.SlotName == s.slotName {
+			status, found = slot, true
+		} else if slot.RetainedBytes > otherRetained {
+			otherRetained = slot.RetainedBytes
+		}
+	}
+	if !found {
+		logger.DefaultLogger.Errorf("Replication slot %s not found", s.slotName)
+		return
+	}
+
+	s.m.Lock()
+	retained := otherRetained
+	if !s.snapshotting && status.RetainedBytes > retained {
+		retained = status.RetainedBytes
+	}
+	status.Alarm = s.conf.SlotLagAlarmBytes > 0 && status.RetainedBytes > s.conf.SlotLagAlarmBytes
+	status.SnapshotPaused = s.conf.SlotLagPauseBytes > 0 && retained > s.conf.SlotLagPauseBytes
+	wasPaused := s.slotStatus.SnapshotPaused
+	s.slotStatus = status
+	s.m.Unlock()
+
+	if status.Alarm {
+		logger.DefaultLogger.Errorw("Replication slot lag exceeds alarm threshold", "slot", s.slotName,
+			"lag_bytes", status.LagBytes, "retained_bytes", status.RetainedBytes, "threshold", s.conf.SlotLagAlarmBytes)
+		if s.conf.OnSlotAlarm != nil {
+			s.conf.OnSlotAlarm(status)
+		}
+	}
+
+	if status.SnapshotPaused != wasPaused {
+		logger.DefaultLogger.Warnw("Snapshot pause changed by replication slot lag", "slot", s.slotName,
+			"paused", status.SnapshotPaused, "retained_bytes", status.RetainedBytes, "other_retained_bytes", otherRetained,
+			"threshold", s.conf.SlotLagPauseBytes)
+	}
+}
+
+// SlotStatus returns the last checked status of the slot of the stream
+func (s *Stream) SlotStatus() SlotStatus {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.slotStatus
+}
+
+// waitSnapshotResume blocks while the snapshot is paused by the slot lag
+func (s *Stream) waitSnapshotResume() error {
+	for s.SlotStatus().SnapshotPaused {
+		select {
+		case <-s.streamCtx.Done():
+			return s.streamCtx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+	return nil
+}
+
+// StatusHandler serves the slot status, the snapshot progress and the tables of the stream as JSON
+func (s *Stream) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"slot":     s.SlotStatus(),
+			"snapshot": s.GetSnapshotProgress(),
+			"tables":   s.Tables(),
+		})
+	})
+}
@@ -0,0 +1,56 @@
+package pglogicalstream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSnapshotPause(t *testing.T) {
+	s := &Stream{
+		slotName:     "replica",
+		conf:         &Config{SlotLagAlarmBytes: 100, SlotLagPauseBytes: 200},
+		snapshotting: true,
+	}
+
+	waitResume := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		s.streamCtx = ctx
+		return s.waitSnapshotResume()
+	}
+
+	// the slot is not confirmed during the snapshot, its lag stays above the threshold
+	var alarms int
+	s.conf.OnSlotAlarm = func(status SlotStatus) { alarms++ }
+	for i := 0; i < 3; i++ {
+		s.updateSlotStatus([]SlotStatus{{SlotName: "replica", RetainedBytes: 1000}, {SlotName: "other", RetainedBytes: 50}})
+		if status := s.SlotStatus(); !status.Alarm || status.SnapshotPaused {
+			t.Fatalf("snapshot must not pause on its own slot lag, got %+v", status)
+		}
+		if err := waitResume(); err != nil {
+			t.Fatalf("snapshot must go on, got %v", err)
+		}
+	}
+	if alarms != 3 {
+		t.Fatalf("expected 3 alarms, got %d", alarms)
+	}
+
+	// other slots are not lowered by the snapshot
+	s.updateSlotStatus([]SlotStatus{{SlotName: "replica", RetainedBytes: 10}, {SlotName: "abandoned", RetainedBytes: 1000}})
+	if err := waitResume(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("snapshot must pause on other slots lag, got %v", err)
+	}
+
+	// after the snapshot, backfills pause on the slot lag, it is lowered by streaming
+	s.snapshotting = false
+	s.updateSlotStatus([]SlotStatus{{SlotName: "replica", RetainedBytes: 1000}})
+	if !s.SlotStatus().SnapshotPaused {
+		t.Fatalf("backfills must pause on the slot lag")
+	}
+	s.updateSlotStatus([]SlotStatus{{SlotName: "replica", RetainedBytes: 10}})
+	if err := waitResume(); err != nil {
+		t.Fatalf("backfills must resume, got %v", err)
+	}
+}
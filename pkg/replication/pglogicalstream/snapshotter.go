@@ -1,76 +1,88 @@
 package pglogicalstream
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"github.com/nhdms/base-go/pkg/logger"
-	"log"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/nhdms/base-go/pkg/logger"
 )
 
+const defaultAvgRowSize = 1024
+
 type Snapshotter struct {
 	pgConnection *sql.DB
 	snapshotName string
 }
 
 func NewSnapshotter(dbConf pgconn.Config, snapshotName string) (*Snapshotter, error) {
+	pgConn, err := sql.Open("postgres", connectionString(dbConf))
+
+	return &Snapshotter{
+		pgConnection: pgConn,
+		snapshotName: snapshotName,
+	}, err
+}
+
+// connectionString returns the DSN of a regular (not replication) connection to the database of dbConf
+func connectionString(dbConf pgconn.Config) string {
 	var sslMode = "none"
 	if dbConf.TLSConfig != nil {
 		sslMode = "require"
 	} else {
 		sslMode = "disable"
 	}
-	connStr := fmt.Sprintf("user=%s password=%s host=%s port=%d dbname=%s sslmode=%s", dbConf.User,
+	return fmt.Sprintf("user=%s password=%s host=%s port=%d dbname=%s sslmode=%s", dbConf.User,
 		dbConf.Password, dbConf.Host, dbConf.Port, dbConf.Database, sslMode,
 	)
-
-	pgConn, err := sql.Open("postgres", connStr)
-
-	return &Snapshotter{
-		pgConnection: pgConn,
-		snapshotName: snapshotName,
-	}, err
 }
 
-func (s *Snapshotter) Prepare() error {
-	createSnapShot := fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s';", s.snapshotName)
-	if len(s.snapshotName) == 0 {
-		return nil
-	}
-	if _, err := s.pgConnection.Exec("BEGIN TRANSACTION ISOLATION LEVEL REPEATABLE READ;"); err != nil {
-		return err
+// BeginTx starts a read only transaction on the exported snapshot, every worker uses its own transaction.
+// Without snapshot name (resumed snapshot) the transaction reads the current data.
+func (s *Snapshotter) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	tx, err := s.pgConnection.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
 	}
-	if _, err := s.pgConnection.Exec(createSnapShot); err != nil {
-		return err
+
+	if len(s.snapshotName) == 0 {
+		return tx, nil
 	}
 
-	return nil
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s';", s.snapshotName)); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
 }
 
-func (s *Snapshotter) FindAvgRowSize(table string) sql.NullInt64 {
-	var avgRowSize sql.NullInt64
-
-	if rows, err := s.pgConnection.Query(fmt.Sprintf(`SELECT SUM(pg_column_size('%s.*')) / COUNT(*) FROM %s;`, table, table)); err != nil {
-		log.Fatal("Can get avg row size", err)
-	} else {
-		if rows.Next() {
-			if err = rows.Scan(&avgRowSize); err != nil {
-				log.Fatal("Can get avg row size", err)
-			}
-		} else {
-			log.Fatal("Can get avg row size; 0 rows returned")
-		}
+// FindAvgRowSize estimates the row size from the table statistics, it does not scan the table
+func (s *Snapshotter) FindAvgRowSize(ctx context.Context, tx *sql.Tx, table string) (int64, error) {
+	var avgRowSize sql.NullFloat64
+	err := tx.QueryRowContext(ctx, `SELECT CASE WHEN reltuples > 0 THEN pg_relation_size(oid) / reltuples END
+		FROM pg_class WHERE oid = $1::regclass`, table).Scan(&avgRowSize)
+	if err != nil {
+		return 0, fmt.Errorf("can not get avg row size of %s: %w", table, err)
 	}
 
-	return avgRowSize
+	if !avgRowSize.Valid || avgRowSize.Float64 < 1 {
+		// never analyzed
+		return defaultAvgRowSize, nil
+	}
+	return int64(avgRowSize.Float64), nil
 }
 
 func (s *Snapshotter) CalculateBatchSize(availableMemory uint64, estimatedRowSize uint64) int {
 	// Adjust this factor based on your system's memory constraints.
 	// This example uses a safety factor of 0.8 to leave some memory headroom.
 	safetyFactor := 0.6
+	if estimatedRowSize == 0 {
+		estimatedRowSize = 1
+	}
 	batchSize := int(float64(availableMemory) * safetyFactor / float64(estimatedRowSize))
 	if batchSize < 1 {
 		batchSize = 1
@@ -78,15 +90,81 @@ func (s *Snapshotter) CalculateBatchSize(availableMemory uint64, estimatedRowSiz
 	return batchSize
 }
 
-func (s *Snapshotter) QuerySnapshotData(table string, pk string, limit, offset int64) (rows *sql.Rows, err error) {
-	// fmt.Sprintf("SELECT * FROM %s ORDER BY %s LIMIT %d OFFSET %d;", table, pk, limit, offset)
-	logger.DefaultLogger.Infow("Query snapshot", "table", table, "limit", limit, "offset", offset, "pk", pk)
-	return s.pgConnection.Query(fmt.Sprintf("SELECT * FROM %s ORDER BY %s LIMIT %d OFFSET %d;", table, pk, limit, offset))
+// GetPrimaryKeyColumns returns the primary key columns of table in index order
+func (s *Snapshotter) GetPrimaryKeyColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT a.attname
+		FROM   pg_index i
+		JOIN   LATERAL unnest(i.indkey) WITH ORDINALITY AS k(attnum, ord) ON TRUE
+		JOIN   pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+		WHERE  i.indrelid = $1::regclass
+		AND    i.indisprimary
+		ORDER  BY k.ord;
+	`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err = rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s has no primary key", table)
+	}
+	return columns, rows.Err()
+}
+
+// QuerySnapshotData reads the next batch after the key lastKey (keyset pagination), an empty lastKey reads from the start
+func (s *Snapshotter) QuerySnapshotData(ctx context.Context, tx *sql.Tx, table string, pk []string, lastKey []string, limit int64) (rows *sql.Rows, err error) {
+	return s.QueryRangeData(ctx, tx, table, pk, nil, nil, lastKey, limit)
 }
 
-func (s *Snapshotter) ReleaseSnapshot() error {
-	_, err := s.pgConnection.Exec("COMMIT;")
-	return err
+// QueryRangeData reads the next batch after lastKey of the key range fromKey..toKey (inclusive),
+// empty keys are unbounded. fromKey is only used for the first batch, when lastKey is empty.
+func (s *Snapshotter) QueryRangeData(ctx context.Context, tx *sql.Tx, table string, pk []string, fromKey, toKey, lastKey []string, limit int64) (rows *sql.Rows, err error) {
+	quoted := make([]string, len(pk))
+	for i, column := range pk {
+		quoted[i] = pq.QuoteIdentifier(column)
+	}
+	columns := strings.Join(quoted, ", ")
+
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	keyCondition := func(op string, key []string) {
+		placeholders := make([]string, len(key))
+		for i, v := range key {
+			args = append(args, v)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s) %s (%s)", columns, op, strings.Join(placeholders, ", ")))
+	}
+
+	if len(lastKey) == len(pk) {
+		keyCondition(">", lastKey)
+	} else if len(fromKey) == len(pk) {
+		keyCondition(">=", fromKey)
+	}
+	if len(toKey) == len(pk) {
+		keyCondition("<=", toKey)
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s", table)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT %d;", columns, limit)
+
+	logger.DefaultLogger.Debugw("Query snapshot", "table", table, "limit", limit, "last_key", lastKey, "from_key", fromKey, "to_key", toKey)
+	return tx.QueryContext(ctx, query, args...)
 }
 
 func (s *Snapshotter) CloseConn() error {
@@ -96,3 +174,15 @@ func (s *Snapshotter) CloseConn() error {
 
 	return nil
 }
+
+// keyString converts a scanned key value to the text accepted by postgres as query parameter
+func keyString(v interface{}) string {
+	switch val := v.(type) {
+	case []byte:
+		return string(val)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(val)
+	}
+}
@@ -0,0 +1,319 @@
+package pglogicalstream
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+const (
+	MaskHash     = "hash"
+	MaskRedact   = "redact"
+	MaskTruncate = "truncate"
+
+	redactedValue = "***"
+)
+
+// TableFilter limits what is replicated from a table. Columns is an allow list (empty allows all) and
+// ExcludeColumns a deny list. Where holds row predicates which must all match, e.g. "status = 1",
+// "type in (1, 2)" or "deleted_at is null". Mask transforms columns: hash (sha256 hex with the MaskSalt),
+// redact or truncate:<n> (keeps the first n characters).
+type TableFilter struct {
+	Columns        []string          `mapstructure:"columns"`
+	ExcludeColumns []string          `mapstructure:"exclude_columns"`
+	Where          []string          `mapstructure:"where"`
+	Mask           map[string]string `mapstructure:"mask"`
+}
+
+type rowPredicate struct {
+	column string
+	op     string
+	values []string
+}
+
+type columnMask struct {
+	kind   string
+	length int
+}
+
+type tableTransform struct {
+	allow      map[string]bool
+	deny       map[string]bool
+	predicates []rowPredicate
+	masks      map[string]columnMask
+	salt       string
+}
+
+func newTableTransforms(filters map[string]TableFilter, salt string) (map[string]*tableTransform, error) {
+	transforms := make(map[string]*tableTransform, len(filters))
+	for table, filter := range filters {
+		t := &tableTransform{
+			allow: make(map[string]bool),
+			deny:  make(map[string]bool),
+			masks: make(map[string]columnMask),
+			salt:  salt,
+		}
+
+		for _, column := range filter.Columns {
+			t.allow[column] = true
+		}
+		for _, column := range filter.ExcludeColumns {
+			t.deny[column] = true
+		}
+
+		for _, where := range filter.Where {
+			predicate, err := parseRowPredicate(where)
+			if err != nil {
+				return nil, fmt.Errorf("table %s: %w", table, err)
+			}
+			t.predicates = append(t.predicates, predicate)
+		}
+
+		for column, mask := range filter.Mask {
+			m, err := parseColumnMask(mask)
+			if err != nil {
+				return nil, fmt.Errorf("table %s column %s: %w", table, column, err)
+			}
+			t.masks[column] = m
+		}
+		transforms[table] = t
+	}
+	return transforms, nil
+}
+
+func parseRowPredicate(where string) (rowPredicate, error) {
+	fields := strings.Fields(where)
+	if len(fields) < 2 {
+		return rowPredicate{}, fmt.Errorf("invalid predicate %q", where)
+	}
+
+	p := rowPredicate{column: fields[0]}
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(where), fields[0]))
+	lower := strings.ToLower(rest)
+	switch {
+	case lower == "is null", lower == "is not null":
+		p.op = lower
+		return p, nil
+	case strings.HasPrefix(lower, "not in"), strings.HasPrefix(lower, "in"):
+		p.op = "in"
+		if strings.HasPrefix(lower, "not in") {
+			p.op, rest = "not in", rest[len("not in"):]
+		} else {
+			rest = rest[len("in"):]
+		}
+
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, "(") || !strings.HasSuffix(rest, ")") {
+			return rowPredicate{}, fmt.Errorf("invalid predicate %q, values of in must be in parentheses", where)
+		}
+		for _, v := range strings.Split(rest[1:len(rest)-1], ",") {
+			p.values = append(p.values, unquoteValue(v))
+		}
+		return p, nil
+	}
+
+	for _, op := range []string{">=", "<=", "!=", "<>", "=", ">", "<"} {
+		if strings.HasPrefix(rest, op) {
+			p.op = op
+			if op == "<>" {
+				p.op = "!="
+			}
+			p.values = []string{unquoteValue(rest[len(op):])}
+			return p, nil
+		}
+	}
+	return rowPredicate{}, fmt.Errorf("invalid predicate %q, supported operators are = != > >= < <= in, not in, is null, is not null", where)
+}
+
+func unquoteValue(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) > 1 && v[0] == '\'' && v[len(v)-1] == '\'' {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+func parseColumnMask(mask string) (columnMask, error) {
+	kind, arg, _ := strings.Cut(mask, ":")
+	switch kind {
+	case MaskHash, MaskRedact:
+		return columnMask{kind: kind}, nil
+	case MaskTruncate:
+		length, err := strconv.Atoi(arg)
+		if err != nil || length < 0 {
+			return columnMask{}, fmt.Errorf("truncate mask needs a length, e.g. truncate:4")
+		}
+		return columnMask{kind: kind, length: length}, nil
+	}
+	return columnMask{}, fmt.Errorf("unknown mask %q, supported masks are hash, redact and truncate:<n>", mask)
+}
+
+// Apply filters and masks the change, keep is false when the row does not match the predicates.
+// An update whose new row does not match becomes a delete, so consumers drop the row which left the filter.
+// Deletes are only filtered when their old data has the predicate columns (REPLICA IDENTITY FULL).
+func (t *tableTransform) Apply(ch Wal2JsonChange) (Wal2JsonChange, bool) {
+	switch ch.Kind {
+	case KindInsert:
+		if !t.match(ch.ColumnNames, ch.ColumnValues, false) {
+			return ch, false
+		}
+	case KindUpdate:
+		if !t.match(ch.ColumnNames, ch.ColumnValues, false) {
+			ch.Kind = KindDelete
+			ch.ColumnNames, ch.ColumnTypes, ch.ColumnValues = nil, nil, nil
+		}
+	case KindDelete:
+		if !t.match(ch.OldData.Keynames, ch.OldData.Keyvalues, true) {
+			return ch, false
+		}
+	}
+
+	ch.ColumnNames, ch.ColumnTypes, ch.ColumnValues = t.transformColumns(ch.ColumnNames, ch.ColumnTypes, ch.ColumnValues)
+	ch.OldData.Keynames, ch.OldData.Keytypes, ch.OldData.Keyvalues = t.transformColumns(ch.OldData.Keynames, ch.OldData.Keytypes, ch.OldData.Keyvalues)
+	return ch, true
+}
+
+// match evaluates the predicates, missing columns match when partial is set
+func (t *tableTransform) match(names []string, values []interface{}, partial bool) bool {
+	for _, p := range t.predicates {
+		idx := -1
+		for i, name := range names {
+			if name == p.column {
+				idx = i
+				break
+			}
+		}
+
+		if idx < 0 || idx >= len(values) {
+			if partial {
+				continue
+			}
+			return false
+		}
+
+		if !p.match(values[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p rowPredicate) match(value interface{}) bool {
+	switch p.op {
+	case "is null":
+		return value == nil
+	case "is not null":
+		return value != nil
+	}
+
+	if value == nil {
+		return false
+	}
+
+	switch p.op {
+	case "in", "not in":
+		found := false
+		for _, v := range p.values {
+			if compareValue(value, v) == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (p.op == "in")
+	}
+
+	c := compareValue(value, p.values[0])
+	switch p.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	}
+	return false
+}
+
+// compareValue compares numerically when both sides are numbers, as text otherwise
+func compareValue(value interface{}, literal string) int {
+	if b, ok := value.(bool); ok {
+		if lb, err := strconv.ParseBool(literal); err == nil {
+			if b == lb {
+				return 0
+			}
+			return 1
+		}
+	}
+
+	if f, err := cast.ToFloat64E(value); err == nil {
+		if lf, err := strconv.ParseFloat(literal, 64); err == nil {
+			switch {
+			case f < lf:
+				return -1
+			case f > lf:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(value), literal)
+}
+
+func (t *tableTransform) transformColumns(names, types []string, values []interface{}) ([]string, []string, []interface{}) {
+	if names == nil {
+		return names, types, values
+	}
+
+	outNames := make([]string, 0, len(names))
+	outTypes := make([]string, 0, len(names))
+	outValues := make([]interface{}, 0, len(names))
+	for i, name := range names {
+		if t.deny[name] || (len(t.allow) > 0 && !t.allow[name]) {
+			continue
+		}
+
+		var typeName string
+		if i < len(types) {
+			typeName = types[i]
+		}
+		var value interface{}
+		if i < len(values) {
+			value = values[i]
+		}
+
+		if mask, ok := t.masks[name]; ok && value != nil {
+			value, typeName = t.mask(mask, value), "text"
+		}
+
+		outNames = append(outNames, name)
+		outTypes = append(outTypes, typeName)
+		outValues = append(outValues, value)
+	}
+	return outNames, outTypes, outValues
+}
+
+func (t *tableTransform) mask(mask columnMask, value interface{}) interface{} {
+	text := fmt.Sprint(value)
+	switch mask.kind {
+	case MaskHash:
+		sum := sha256.Sum256([]byte(t.salt + text))
+		return hex.EncodeToString(sum[:])
+	case MaskTruncate:
+		runes := []rune(text)
+		if len(runes) > mask.length {
+			return string(runes[:mask.length])
+		}
+		return text
+	}
+	return redactedValue
+}
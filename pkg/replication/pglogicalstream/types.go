@@ -1,8 +1,18 @@
 package pglogicalstream
 
 type Wal2JsonChanges struct {
-	Lsn     *string          `json:"lsn"`
-	Changes []Wal2JsonChange `json:"change"`
+	Lsn *string `json:"lsn"`
+	Xid uint32  `json:"xid,omitempty"`
+	// Timestamp is the commit time of the transaction, e.g. 2024-11-18 11:29:46.781285+00
+	Timestamp string           `json:"timestamp,omitempty"`
+	Changes   []Wal2JsonChange `json:"change"`
+	// Partial is set on the changes of a transaction sent before its last one, they share the commit LSN
+	// so Commit does not acknowledge them, the transaction is delivered again if it stops before the last one
+	Partial bool `json:"-"`
+	// Snapshot is set on the marker sent after each snapshot batch, it has no changes
+	Snapshot *SnapshotProgress `json:"-"`
+	// Backfill is set on backfill rows and on the marker sent after each backfill batch
+	Backfill *BackfillProgress `json:"-"`
 }
 
 type OldKeys struct {
@@ -19,6 +29,8 @@ type Wal2JsonChange struct {
 	ColumnTypes  []string      `json:"columntypes"`
 	ColumnValues []interface{} `json:"columnvalues"`
 	OldData      OldKeys       `json:"oldkeys"`
+	// SchemaVersion is the version of the column layout, see schemaTracker
+	SchemaVersion int `json:"schemaversion,omitempty"`
 }
 type OnMessage = func(message Wal2JsonChanges)
 
@@ -0,0 +1,190 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/lib/pq"
+	replication "github.com/nhdms/base-go/pkg/replication/defines"
+	"github.com/nhdms/base-go/pkg/utils"
+)
+
+// postgresSink applies changes to another database to build read models, a batch is applied in one transaction.
+// Inserts and updates are upserted by the key columns, deletes and truncates are applied, schema changes are
+// ignored as the target tables are managed by migrations.
+type postgresSink struct {
+	db           *sql.DB
+	targetTables map[string]string
+	keyColumns   map[string][]string
+}
+
+func newPostgresSink(name string, conf SinkConfig, deps Dependencies) (Sink, error) {
+	if len(conf.DSN) == 0 {
+		return nil, fmt.Errorf("postgres sink needs a dsn")
+	}
+
+	db, err := sql.Open("postgres", conf.DSN)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresSink{db: db, targetTables: conf.TargetTables, keyColumns: conf.KeyColumns}, nil
+}
+
+func (s *postgresSink) Write(ctx context.Context, messages replication.Messages) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, m := range messages {
+		if err = s.apply(ctx, tx, m); err != nil {
+			return fmt.Errorf("failed to apply %s of %s.%s: %w", m.Type, m.Table.Schema, m.Table.Name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *postgresSink) apply(ctx context.Context, tx *sql.Tx, m *replication.Message) error {
+	table := s.getTargetTable(m.Table)
+	keys := s.getKeyColumns(m.Table)
+
+	switch m.Type {
+	case replication.EventInsert, replication.EventUpdate:
+		// a changed key moves the row, the old one is removed first
+		if m.Type == replication.EventUpdate && keyChanged(m, keys) {
+			if err := s.delete(ctx, tx, table, keys, m.OldData, m.Types); err != nil {
+				return err
+			}
+		}
+		return s.upsert(ctx, tx, table, keys, m.Data, m.Types)
+	case replication.EventDelete:
+		return s.delete(ctx, tx, table, keys, m.OldData, m.Types)
+	case replication.EventTruncate:
+		_, err := tx.ExecContext(ctx, "TRUNCATE "+table)
+		return err
+	}
+	return nil
+}
+
+func (s *postgresSink) upsert(ctx context.Context, tx *sql.Tx, table string, keys []string, data map[string]interface{}, types map[string]string) error {
+	columns := make([]string, 0, len(data))
+	for column := range data {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	quoted := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	var updates []string
+	for i, column := range columns {
+		quoted[i] = pq.QuoteIdentifier(column)
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = sqlValue(types[column], data[column])
+		if !utils.StringSliceContains(keys, column) {
+			updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", quoted[i], quoted[i]))
+		}
+	}
+
+	quotedKeys := make([]string, len(keys))
+	for i, key := range keys {
+		quotedKeys[i] = pq.QuoteIdentifier(key)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO ", table, strings.Join(quoted, ", "),
+		strings.Join(placeholders, ", "), strings.Join(quotedKeys, ", "))
+	if len(updates) == 0 {
+		query += "NOTHING"
+	} else {
+		query += "UPDATE SET " + strings.Join(updates, ", ")
+	}
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (s *postgresSink) delete(ctx context.Context, tx *sql.Tx, table string, keys []string, data map[string]interface{}, types map[string]string) error {
+	conditions := make([]string, len(keys))
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		value, ok := data[key]
+		if !ok {
+			return fmt.Errorf("key column %s is missing, check the replica identity of the table", key)
+		}
+		conditions[i] = fmt.Sprintf("%s = $%d", pq.QuoteIdentifier(key), i+1)
+		args[i] = sqlValue(types[key], value)
+	}
+
+	_, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s", table, strings.Join(conditions, " AND ")), args...)
+	return err
+}
+
+func (s *postgresSink) getTargetTable(table replication.Table) string {
+	name, ok := s.targetTables[table.Name]
+	if !ok {
+		name = fmt.Sprintf("%s.%s", table.Schema, table.Name)
+	}
+
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = pq.QuoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+func (s *postgresSink) getKeyColumns(table replication.Table) []string {
+	if keys, ok := s.keyColumns[table.Name]; ok && len(keys) > 0 {
+		return keys
+	}
+	return []string{"id"}
+}
+
+func (s *postgresSink) Close() error {
+	return s.db.Close()
+}
+
+func keyChanged(m *replication.Message, keys []string) bool {
+	for _, key := range keys {
+		old, ok := m.OldData[key]
+		if ok && fmt.Sprint(old) != fmt.Sprint(m.Data[key]) {
+			return true
+		}
+	}
+	return false
+}
+
+// sqlValue converts decoded JSON and arrays to values lib/pq can send
+func sqlValue(typeName string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, int64, float64, bool, string, []byte:
+		return v
+	case []interface{}:
+		if strings.HasPrefix(typeName, "_") || strings.HasSuffix(typeName, "[]") {
+			elems := make([]sql.NullString, len(v))
+			for i, elem := range v {
+				if elem != nil {
+					elems[i] = sql.NullString{String: fmt.Sprint(elem), Valid: true}
+				}
+			}
+			return pq.GenericArray{A: elems}
+		}
+		b, _ := json.Marshal(v)
+		return string(b)
+	case map[string]interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	case driver.Valuer:
+		return v
+	default:
+		if _, err := driver.DefaultParameterConverter.ConvertValue(v); err == nil {
+			return v
+		}
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,88 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+	replication "github.com/nhdms/base-go/pkg/replication/defines"
+)
+
+const defaultRoutingKey = "{schema}.{table}.{type}"
+
+// rabbitMQSink publishes one persistent message per change, table level events are published to every partition
+type rabbitMQSink struct {
+	publisher  Publisher
+	exchange   string
+	routingKey string
+	routing    replication.RoutingConfig
+}
+
+func newRabbitMQSink(name string, conf SinkConfig, deps Dependencies) (Sink, error) {
+	if deps.Publisher == nil {
+		return nil, fmt.Errorf("rabbitmq sink needs a publisher")
+	}
+
+	s := &rabbitMQSink{publisher: deps.Publisher, exchange: conf.Exchange, routingKey: conf.RoutingKey, routing: conf.Routing}
+	if len(s.exchange) == 0 {
+		s.exchange = name
+	}
+	if len(s.routingKey) == 0 {
+		s.routingKey = defaultRoutingKey
+	}
+	return s, nil
+}
+
+func (s *rabbitMQSink) Write(ctx context.Context, messages replication.Messages) error {
+	for _, m := range messages {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+
+		for _, routingKey := range s.getRoutingKeys(m) {
+			if err = s.publisher.PublishRoutingPersist(s.exchange, routingKey, data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteTransaction publishes the transaction as one message with the routing key transactions
+func (s *rabbitMQSink) WriteTransaction(ctx context.Context, tx *replication.Transaction) error {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	return s.publisher.PublishRoutingPersist(s.exchange, replication.TransactionRoutingKey, data)
+}
+
+func (s *rabbitMQSink) getRoutingKeys(m *replication.Message) []string {
+	replacer := strings.NewReplacer("{schema}", m.Table.Schema, "{table}", m.Table.Name, "{type}", string(m.Type))
+	routingKey := replacer.Replace(s.routingKey)
+	if !strings.Contains(routingKey, "{partition}") {
+		return []string{routingKey}
+	}
+
+	partitions := []int{s.routing.Partition(m)}
+	if s.routing.Partitions > 1 && (m.Type == replication.EventTruncate || m.Type == replication.EventSchemaChange) {
+		// table level events are ordered with the row changes of every partition
+		partitions = make([]int, s.routing.Partitions)
+		for i := range partitions {
+			partitions[i] = i
+		}
+	}
+
+	keys := make([]string, len(partitions))
+	for i, partition := range partitions {
+		keys[i] = strings.ReplaceAll(routingKey, "{partition}", strconv.Itoa(partition))
+	}
+	return keys
+}
+
+func (s *rabbitMQSink) Close() error {
+	return nil
+}
@@ -0,0 +1,66 @@
+package sink
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/goccy/go-json"
+	"github.com/nhdms/base-go/pkg/dbtool"
+	replication "github.com/nhdms/base-go/pkg/replication/defines"
+)
+
+const defaultRedisStream = "replication:{schema}.{table}"
+
+// redisSink adds every change to a redis stream with the fields type and data (the message JSON),
+// a batch is sent in one pipeline
+type redisSink struct {
+	client *redis.Client
+	owned  bool
+	stream string
+	maxLen int64
+}
+
+func newRedisSink(name string, conf SinkConfig, deps Dependencies) (Sink, error) {
+	s := &redisSink{client: deps.Redis, stream: conf.Stream, maxLen: conf.MaxLen}
+	if s.client == nil {
+		var err error
+		if s.client, err = dbtool.CreateRedisConnection(nil); err != nil {
+			return nil, err
+		}
+		s.owned = true
+	}
+
+	if len(s.stream) == 0 {
+		s.stream = defaultRedisStream
+	}
+	return s, nil
+}
+
+func (s *redisSink) Write(ctx context.Context, messages replication.Messages) error {
+	pipe := s.client.Pipeline()
+	for _, m := range messages {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: strings.NewReplacer("{schema}", m.Table.Schema, "{table}", m.Table.Name).Replace(s.stream),
+			MaxLen: s.maxLen,
+			Approx: s.maxLen > 0,
+			Values: map[string]interface{}{"type": string(m.Type), "data": data},
+		})
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *redisSink) Close() error {
+	// a shared client is closed by its owner
+	if s.owned {
+		return s.client.Close()
+	}
+	return nil
+}
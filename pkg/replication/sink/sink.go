@@ -0,0 +1,302 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nhdms/base-go/pkg/config"
+	"github.com/nhdms/base-go/pkg/logger"
+	replication "github.com/nhdms/base-go/pkg/replication/defines"
+	"github.com/spf13/viper"
+)
+
+const (
+	TypeRabbitMQ = "rabbitmq"
+	TypeRedis    = "redis"
+	TypeWebhook  = "webhook"
+	TypePostgres = "postgres"
+
+	// OnErrorFail returns the error, the replication retries the change and stops without ack when it keeps failing
+	OnErrorFail = "fail"
+	// OnErrorSkip logs the error and drops the batch
+	OnErrorSkip = "skip"
+)
+
+// Sink writes replicated changes to a destination, messages are in commit order
+type Sink interface {
+	Write(ctx context.Context, messages replication.Messages) error
+	Close() error
+}
+
+// TransactionSink is implemented by sinks which deliver a transaction as one unit instead of its messages
+type TransactionSink interface {
+	WriteTransaction(ctx context.Context, tx *replication.Transaction) error
+}
+
+// Publisher is the part of app.PublisherInterface used by the rabbitmq sink
+type Publisher interface {
+	PublishRoutingPersist(exchName, routingKey string, data []byte) error
+}
+
+// Dependencies are the shared connections given to the sink factories, nil ones are created from the config when needed
+type Dependencies struct {
+	Publisher Publisher
+	Redis     *redis.Client
+}
+
+// Factory creates a sink of a type from its config
+type Factory func(name string, conf SinkConfig, deps Dependencies) (Sink, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register registers the factory of a sink type, the built in types are registered in init()
+func Register(typ string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[typ] = factory
+}
+
+func init() {
+	Register(TypeRabbitMQ, newRabbitMQSink)
+	Register(TypeRedis, newRedisSink)
+	Register(TypeWebhook, newWebhookSink)
+	Register(TypePostgres, newPostgresSink)
+}
+
+// Config routes the tables to sinks, Tables keys are table names or * for the other tables
+type Config struct {
+	Sinks  map[string]SinkConfig `mapstructure:"sinks"`
+	Tables map[string][]string   `mapstructure:"tables"`
+}
+
+// SinkConfig is the config of one sink, the fields used depend on Type
+type SinkConfig struct {
+	Type string `mapstructure:"type"`
+	// BatchSize is the max number of messages per write, 0 writes all messages of a change set at once
+	BatchSize int `mapstructure:"batch_size"`
+	// OnError is fail (default) or skip, it is applied after MaxRetries retries
+	OnError       string        `mapstructure:"on_error"`
+	MaxRetries    int           `mapstructure:"max_retries"`
+	RetryInterval time.Duration `mapstructure:"retry_interval"`
+
+	// rabbitmq: RoutingKey supports {schema}, {table}, {type} and {partition} (Routing.Partitions)
+	Exchange   string                    `mapstructure:"exchange"`
+	RoutingKey string                    `mapstructure:"routing_key"`
+	Routing    replication.RoutingConfig `mapstructure:"routing"`
+
+	// redis: Stream supports {schema} and {table}
+	Stream string `mapstructure:"stream"`
+	MaxLen int64  `mapstructure:"max_len"`
+
+	// webhook: the body is signed with Secret, see webhookSink
+	URL     string            `mapstructure:"url"`
+	Secret  string            `mapstructure:"secret"`
+	Timeout time.Duration     `mapstructure:"timeout"`
+	Headers map[string]string `mapstructure:"headers"`
+
+	// postgres: rows are upserted by KeyColumns (default id) into TargetTables (default same table name)
+	DSN          string              `mapstructure:"dsn"`
+	TargetTables map[string]string   `mapstructure:"target_tables"`
+	KeyColumns   map[string][]string `mapstructure:"key_columns"`
+}
+
+// ErrConfigNotFound is returned by LoadConfig when the key is not set, the caller may fall back to its default sinks
+var ErrConfigNotFound = errors.New("replication sinks config not found")
+
+// LoadConfig loads the sinks config from the sub config key, e.g. replication_sinks.
+// A config which is set but can not be decoded, or has no sink or table, is an error, not ErrConfigNotFound.
+func LoadConfig(key string) (*Config, error) {
+	if !viper.IsSet(key) {
+		return nil, fmt.Errorf("%w: %s", ErrConfigNotFound, key)
+	}
+
+	conf := &Config{}
+	if err := config.LoadConfigToVar(conf, key); err != nil {
+		return nil, fmt.Errorf("invalid replication sinks config %s: %w", key, err)
+	}
+	if len(conf.Sinks) == 0 || len(conf.Tables) == 0 {
+		return nil, fmt.Errorf("invalid replication sinks config %s: sinks and tables are required", key)
+	}
+	return conf, nil
+}
+
+type routedSink struct {
+	name string
+	conf SinkConfig
+	sink Sink
+}
+
+// Router writes messages to the sinks configured for their table
+type Router struct {
+	sinks  map[string]*routedSink
+	tables map[string][]string
+}
+
+func NewRouter(conf *Config, deps Dependencies) (*Router, error) {
+	r := &Router{sinks: make(map[string]*routedSink), tables: conf.Tables}
+	for name, sinkConf := range conf.Sinks {
+		factoriesMu.RLock()
+		factory, ok := factories[sinkConf.Type]
+		factoriesMu.RUnlock()
+		if !ok {
+			_ = r.Close()
+			return nil, fmt.Errorf("sink %s has unknown type %s", name, sinkConf.Type)
+		}
+
+		if len(sinkConf.OnError) == 0 {
+			sinkConf.OnError = OnErrorFail
+		}
+		if sinkConf.OnError != OnErrorFail && sinkConf.OnError != OnErrorSkip {
+			_ = r.Close()
+			return nil, fmt.Errorf("sink %s: on_error must be %s or %s", name, OnErrorFail, OnErrorSkip)
+		}
+		if sinkConf.RetryInterval <= 0 {
+			sinkConf.RetryInterval = time.Second
+		}
+
+		s, err := factory(name, sinkConf, deps)
+		if err != nil {
+			_ = r.Close()
+			return nil, fmt.Errorf("failed to create sink %s: %w", name, err)
+		}
+		r.sinks[name] = &routedSink{name: name, conf: sinkConf, sink: s}
+	}
+
+	for table, names := range conf.Tables {
+		for _, name := range names {
+			if _, ok := r.sinks[name]; !ok {
+				_ = r.Close()
+				return nil, fmt.Errorf("table %s is routed to unknown sink %s", table, name)
+			}
+		}
+	}
+	return r, nil
+}
+
+// Write groups messages by sink, keeping their order, and writes them in batches of the sink
+func (r *Router) Write(ctx context.Context, messages replication.Messages) error {
+	grouped := make(map[string]replication.Messages)
+	for _, m := range messages {
+		for _, name := range r.getSinkNames(m.Table) {
+			grouped[name] = append(grouped[name], m)
+		}
+	}
+
+	for _, name := range r.sortedNames(grouped) {
+		s := r.sinks[name]
+		batches := splitBatches(grouped[name], s.conf.BatchSize)
+		for _, batch := range batches {
+			err := r.apply(ctx, s, func() error {
+				return s.sink.Write(ctx, batch)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteTransaction writes the messages of tx to their sinks, sinks implementing TransactionSink receive tx
+// with only the messages routed to them. Transactions are not split in batches.
+func (r *Router) WriteTransaction(ctx context.Context, tx *replication.Transaction) error {
+	grouped := make(map[string]replication.Messages)
+	for _, m := range tx.Messages {
+		for _, name := range r.getSinkNames(m.Table) {
+			grouped[name] = append(grouped[name], m)
+		}
+	}
+
+	for _, name := range r.sortedNames(grouped) {
+		s := r.sinks[name]
+		routed := *tx
+		routed.Messages = grouped[name]
+		err := r.apply(ctx, s, func() error {
+			if txSink, ok := s.sink.(TransactionSink); ok {
+				return txSink.WriteTransaction(ctx, &routed)
+			}
+			return s.sink.Write(ctx, routed.Messages)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Router) Close() error {
+	var firstErr error
+	for name, s := range r.sinks {
+		if err := s.sink.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close sink %s: %w", name, err)
+		}
+	}
+	return firstErr
+}
+
+func (r *Router) getSinkNames(table replication.Table) []string {
+	if names, ok := r.tables[fmt.Sprintf("%s.%s", table.Schema, table.Name)]; ok {
+		return names
+	}
+	if names, ok := r.tables[table.Name]; ok {
+		return names
+	}
+	return r.tables["*"]
+}
+
+// sortedNames makes the write order of sinks stable
+func (r *Router) sortedNames(grouped map[string]replication.Messages) []string {
+	names := make([]string, 0, len(grouped))
+	for name := range grouped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// apply retries fn MaxRetries times then applies the error policy of the sink
+func (r *Router) apply(ctx context.Context, s *routedSink, fn func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt >= s.conf.MaxRetries {
+			break
+		}
+
+		logger.DefaultLogger.Warnf("Sink %s write failed (attempt %d), retry in %v: %v", s.name, attempt+1, s.conf.RetryInterval, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.conf.RetryInterval):
+		}
+	}
+
+	if s.conf.OnError == OnErrorSkip {
+		logger.DefaultLogger.Errorf("Sink %s write failed, batch is skipped: %v", s.name, err)
+		return nil
+	}
+	return fmt.Errorf("sink %s: %w", s.name, err)
+}
+
+func splitBatches(messages replication.Messages, size int) []replication.Messages {
+	if size <= 0 || len(messages) <= size {
+		return []replication.Messages{messages}
+	}
+
+	batches := make([]replication.Messages, 0, (len(messages)+size-1)/size)
+	for len(messages) > size {
+		batches = append(batches, messages[:size])
+		messages = messages[size:]
+	}
+	return append(batches, messages)
+}
@@ -0,0 +1,169 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	replication "github.com/nhdms/base-go/pkg/replication/defines"
+	"github.com/spf13/viper"
+)
+
+type recordSink struct {
+	batches []replication.Messages
+	err     error
+}
+
+func (s *recordSink) Write(ctx context.Context, messages replication.Messages) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.batches = append(s.batches, messages)
+	return nil
+}
+
+func (s *recordSink) Close() error { return nil }
+
+type recordPublisher struct {
+	keys []string
+}
+
+func (p *recordPublisher) PublishRoutingPersist(exchName, routingKey string, data []byte) error {
+	p.keys = append(p.keys, exchName+":"+routingKey)
+	return nil
+}
+
+func newMessage(table string, id int64, typ replication.EventType) *replication.Message {
+	return &replication.Message{
+		Type:  typ,
+		Table: replication.Table{Schema: "public", Name: table},
+		Data:  map[string]interface{}{"id": id},
+		Types: map[string]string{"id": "int8"},
+	}
+}
+
+func TestRouter(t *testing.T) {
+	records := map[string]*recordSink{"users_sink": {}, "all_sink": {}, "failing": {err: errors.New("down")}}
+	Register("record", func(name string, conf SinkConfig, deps Dependencies) (Sink, error) {
+		return records[name], nil
+	})
+
+	router, err := NewRouter(&Config{
+		Sinks: map[string]SinkConfig{
+			"users_sink": {Type: "record", BatchSize: 2},
+			"all_sink":   {Type: "record"},
+			"failing":    {Type: "record", OnError: OnErrorSkip},
+		},
+		Tables: map[string][]string{"users": {"users_sink", "failing"}, "*": {"all_sink"}},
+	}, Dependencies{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = router.Write(context.Background(), replication.Messages{
+		newMessage("users", 1, replication.EventInsert),
+		newMessage("orders", 1, replication.EventInsert),
+		newMessage("users", 2, replication.EventInsert),
+		newMessage("users", 3, replication.EventUpdate),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if batches := records["users_sink"].batches; len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Fatalf("unexpected users batches %v", batches)
+	}
+	if batches := records["all_sink"].batches; len(batches) != 1 || batches[0][0].Table.Name != "orders" {
+		t.Fatalf("unexpected all batches %v", batches)
+	}
+
+	records["users_sink"].err = errors.New("down")
+	if err = router.Write(context.Background(), replication.Messages{newMessage("users", 4, replication.EventInsert)}); err == nil {
+		t.Fatal("expected error of fail policy")
+	}
+
+	if _, err = NewRouter(&Config{Tables: map[string][]string{"users": {"unknown"}}}, Dependencies{}); err == nil {
+		t.Fatal("expected error for unknown sink")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	if _, err := LoadConfig("test_sinks_absent"); !errors.Is(err, ErrConfigNotFound) {
+		t.Fatalf("expected config not found, got %v", err)
+	}
+
+	// set but invalid configs must not fall back to the default sinks
+	viper.Set("test_sinks_malformed", "rabbitmq")
+	viper.Set("test_sinks_empty", map[string]interface{}{"tables": map[string]interface{}{"*": []string{"all"}}})
+	viper.Set("test_sinks_bad_type", map[string]interface{}{"sinks": map[string]interface{}{"all": map[string]interface{}{"batch_size": "many"}}})
+	for _, key := range []string{"test_sinks_malformed", "test_sinks_empty", "test_sinks_bad_type"} {
+		if _, err := LoadConfig(key); err == nil || errors.Is(err, ErrConfigNotFound) {
+			t.Fatalf("expected invalid config error for %s, got %v", key, err)
+		}
+	}
+
+	viper.Set("test_sinks", map[string]interface{}{
+		"sinks":  map[string]interface{}{"all": map[string]interface{}{"type": TypeRabbitMQ}},
+		"tables": map[string]interface{}{"*": []string{"all"}},
+	})
+	conf, err := LoadConfig("test_sinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Sinks["all"].Type != TypeRabbitMQ || len(conf.Tables["*"]) != 1 {
+		t.Fatalf("unexpected config %+v", conf)
+	}
+}
+
+func TestRabbitMQSink(t *testing.T) {
+	publisher := &recordPublisher{}
+	s, err := newRabbitMQSink("binlog", SinkConfig{
+		RoutingKey: "{table}.{type}.{partition}",
+		Routing:    replication.RoutingConfig{Partitions: 2},
+	}, Dependencies{Publisher: publisher})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Write(context.Background(), replication.Messages{
+		newMessage("users", 1, replication.EventInsert),
+		newMessage("users", 0, replication.EventTruncate),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	partition := replication.RoutingConfig{Partitions: 2}.Partition(newMessage("users", 1, replication.EventInsert))
+	if len(publisher.keys) != 3 || publisher.keys[0] != "binlog:users.insert."+strconv.Itoa(partition) ||
+		publisher.keys[1] != "binlog:users.truncate.0" || publisher.keys[2] != "binlog:users.truncate.1" {
+		t.Fatalf("unexpected routing keys %v", publisher.keys)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(HeaderWebhookTimestamp), 10, 64)
+		if r.Header.Get(HeaderWebhookSignature) != SignWebhook("secret", timestamp, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	messages := replication.Messages{newMessage("users", 1, replication.EventInsert)}
+	s, _ := newWebhookSink("hook", SinkConfig{URL: server.URL, Secret: "secret"}, Dependencies{})
+	if err := s.Write(context.Background(), messages); err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ = newWebhookSink("hook", SinkConfig{URL: server.URL, Secret: "wrong"}, Dependencies{})
+	if err := s.Write(context.Background(), messages); err == nil {
+		t.Fatal("expected error for rejected signature")
+	}
+}
@@ -0,0 +1,92 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	replication "github.com/nhdms/base-go/pkg/replication/defines"
+)
+
+const (
+	HeaderWebhookTimestamp = "X-Webhook-Timestamp"
+	HeaderWebhookSignature = "X-Webhook-Signature"
+)
+
+// webhookSink posts a batch as a JSON array. With a secret the request has the headers X-Webhook-Timestamp
+// (unix seconds) and X-Webhook-Signature: sha256=<hex HMAC-SHA256 of "<timestamp>.<body>">, see SignWebhook.
+// Any status other than 2xx is an error.
+type webhookSink struct {
+	client  *http.Client
+	url     string
+	secret  string
+	headers map[string]string
+}
+
+func newWebhookSink(name string, conf SinkConfig, deps Dependencies) (Sink, error) {
+	if len(conf.URL) == 0 {
+		return nil, fmt.Errorf("webhook sink needs an url")
+	}
+
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &webhookSink{client: &http.Client{Timeout: timeout}, url: conf.URL, secret: conf.Secret, headers: conf.Headers}, nil
+}
+
+// SignWebhook returns the signature of body sent at timestamp, receivers compare it with hmac.Equal
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *webhookSink) Write(ctx context.Context, messages replication.Messages) error {
+	body, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	if len(s.secret) > 0 {
+		timestamp := time.Now().Unix()
+		req.Header.Set(HeaderWebhookTimestamp, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(HeaderWebhookSignature, SignWebhook(s.secret, timestamp, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook %s responded %d: %s", s.url, resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -2,9 +2,17 @@ package main
 
 import (
 	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/nhdms/base-go/pkg/dbtool"
+	"github.com/nhdms/base-go/pkg/replication/pglogicalstream"
 	"github.com/nhdms/base-go/pkg/toolkit/generator"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/urfave/cli/v2"
 )
@@ -95,6 +103,266 @@ func main() {
 							return nil
 						},
 					},
+					{
+						Name:      "permissions",
+						Usage:     "Generate the permission registry (stable keys) of the permissions package",
+						ArgsUsage: "[internal/permissions]",
+						Action: func(c *cli.Context) error {
+							dir := c.Args().First()
+							if dir == "" {
+								dir = "internal/permissions"
+							}
+							return generator.GeneratePermissions(dir)
+						},
+					},
+					{
+						Name:      "table",
+						Usage:     "Generate dbtool table and codec from a proto model",
+						ArgsUsage: "proto/models/<model>.proto",
+						Flags: []cli.Flag{
+							&cli.StringFlag{Name: "out", Usage: "output package directory, e.g. cmd/services/user-service/tables", Required: true},
+							&cli.StringFlag{Name: "message", Usage: "proto message, default is the first message"},
+							&cli.StringFlag{Name: "table", Usage: "table name, default is snake case plural of the message"},
+							&cli.StringFlag{Name: "func", Usage: "table getter name, default is Get<Message>Table"},
+							&cli.StringFlag{Name: "alias", Usage: "default alias of the table"},
+							&cli.StringSliceFlag{Name: "ignore", Usage: "columns ignored on insert/update"},
+							&cli.StringFlag{Name: "dsn", Usage: "postgres dsn to validate columns against the live table", EnvVars: []string{"GCLI_DSN"}},
+							&cli.StringFlag{Name: "schema", Usage: "postgres schema", Value: "public"},
+						},
+						Action: func(c *cli.Context) error {
+							protoPath := c.Args().First()
+							if protoPath == "" {
+								return fmt.Errorf("proto path is required")
+							}
+							fmt.Printf("Generating table from: %s\n", protoPath)
+							return generator.GenerateTable(generator.TableOptions{
+								ProtoPath:     protoPath,
+								Message:       c.String("message"),
+								TableName:     c.String("table"),
+								FuncName:      c.String("func"),
+								OutDir:        c.String("out"),
+								Alias:         c.String("alias"),
+								IgnoreColumns: c.StringSlice("ignore"),
+								DSN:           c.String("dsn"),
+								Schema:        c.String("schema"),
+							})
+						},
+					},
+				},
+			},
+			{
+				Name:  "migrate",
+				Usage: "Manage database migrations",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "dir", Usage: "migrations directory", Value: "migrations"},
+					&cli.StringFlag{Name: "service", Usage: "use migrations of cmd/services/<service>, applied versions are kept per service"},
+					&cli.StringFlag{Name: "dsn", Usage: "postgres dsn", EnvVars: []string{"DATABASE_URL"}},
+					&cli.BoolFlag{Name: "dry-run", Usage: "print statements without executing them"},
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name:      "new",
+						Usage:     "Create a new migration file",
+						ArgsUsage: "<name>",
+						Action: func(c *cli.Context) error {
+							name := c.Args().First()
+							if name == "" {
+								return fmt.Errorf("name is required")
+							}
+							path, err := dbtool.NewMigrationFile(getMigrationDir(c), name)
+							if err != nil {
+								return err
+							}
+							fmt.Printf("Created migration: %s\n", path)
+							return nil
+						},
+					},
+					{
+						Name:  "up",
+						Usage: "Apply all pending migrations",
+						Action: func(c *cli.Context) error {
+							return withMigrator(c, func(m *dbtool.Migrator) error {
+								migrations, err := m.Up(c.Context)
+								fmt.Printf("Applied %d migrations\n", len(migrations))
+								return err
+							})
+						},
+					},
+					{
+						Name:  "down",
+						Usage: "Roll back the latest migration",
+						Action: func(c *cli.Context) error {
+							return withMigrator(c, func(m *dbtool.Migrator) error {
+								migration, err := m.Down(c.Context)
+								if err == nil && migration == nil {
+									fmt.Println("No migration to roll back")
+								}
+								return err
+							})
+						},
+					},
+					{
+						Name:  "status",
+						Usage: "Show applied and pending migrations",
+						Action: func(c *cli.Context) error {
+							return withMigrator(c, func(m *dbtool.Migrator) error {
+								migrations, err := m.Status(c.Context)
+								if err != nil {
+									return err
+								}
+								for _, migration := range migrations {
+									state := "pending"
+									if migration.Applied {
+										state = "applied"
+									}
+									fmt.Printf("[%s] %s_%s\n", state, migration.Version, migration.Name)
+								}
+								return nil
+							})
+						},
+					},
+				},
+			},
+			{
+				Name:  "db",
+				Usage: "Database tools",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "check",
+						Usage: "Check registered tables and models against the database schema",
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{Name: "service", Usage: "services to check, default is all cmd/services/*/tables"},
+							&cli.StringFlag{Name: "dsn", Usage: "postgres dsn", EnvVars: []string{"DATABASE_URL"}},
+							&cli.StringFlag{Name: "schema", Usage: "postgres schema", Value: "public"},
+						},
+						Action: func(c *cli.Context) error {
+							return generator.CheckDBSchema(c.StringSlice("service"), c.String("dsn"), c.String("schema"))
+						},
+					},
+				},
+			},
+			{
+				Name:  "replication",
+				Usage: "Logical replication tools",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "slots",
+						Usage: "List or drop replication slots",
+						Flags: []cli.Flag{
+							&cli.StringFlag{Name: "dsn", Usage: "postgres dsn", EnvVars: []string{"DATABASE_URL"}},
+						},
+						Subcommands: []*cli.Command{
+							{
+								Name:  "list",
+								Usage: "List replication slots with their lag",
+								Action: func(c *cli.Context) error {
+									return withDB(c, func(db *sqlx.DB) error {
+										slots, err := pglogicalstream.ListSlots(c.Context, db.DB)
+										if err != nil {
+											return err
+										}
+
+										w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+										fmt.Fprintln(w, "SLOT\tPLUGIN\tACTIVE\tCONFIRMED FLUSH LSN\tRESTART LSN\tLAG\tRETAINED WAL")
+										for _, slot := range slots {
+											fmt.Fprintf(w, "%s\t%s\t%v\t%s\t%s\t%s\t%s\n", slot.SlotName, slot.Plugin, slot.Active,
+												slot.ConfirmedFlushLSN, slot.RestartLSN, formatBytes(slot.LagBytes), formatBytes(slot.RetainedBytes))
+										}
+										return w.Flush()
+									})
+								},
+							},
+							{
+								Name:      "drop",
+								Usage:     "Drop an inactive replication slot, its publication and its checkpoints",
+								ArgsUsage: "<slot>",
+								Flags: []cli.Flag{
+									&cli.StringFlag{Name: "checkpoint", Usage: "checkpoint store of the stream, postgres or redis"},
+									&cli.StringFlag{Name: "checkpoint-table", Usage: "checkpoint table or redis key prefix, default of the store if empty"},
+									&cli.StringFlag{Name: "checkpoint-dsn", Usage: "postgres dsn of the checkpoint table, default is --dsn"},
+									&cli.StringFlag{Name: "redis-addr", Usage: "redis address of the checkpoints", Value: "localhost:6379"},
+								},
+								Action: func(c *cli.Context) error {
+									slot := c.Args().First()
+									if slot == "" {
+										return fmt.Errorf("slot name is required")
+									}
+									return withDB(c, func(db *sqlx.DB) error {
+										checkpoint, closeCheckpoint, err := openCheckpointStore(c, db)
+										if err != nil {
+											return err
+										}
+										defer closeCheckpoint()
+
+										if err = pglogicalstream.DropSlot(c.Context, db.DB, slot, checkpoint); err != nil {
+											return err
+										}
+										fmt.Printf("Dropped replication slot %s\n", slot)
+										return nil
+									})
+								},
+							},
+						},
+					},
+					{
+						Name:  "backfill",
+						Usage: "Re-emit rows of a replicated table, the stream of the slot runs the requests with backfill_interval set",
+						Flags: []cli.Flag{
+							&cli.StringFlag{Name: "dsn", Usage: "postgres dsn of the replicated database", EnvVars: []string{"DATABASE_URL"}},
+							&cli.StringFlag{Name: "backfill-table", Usage: "backfill control table", Value: pglogicalstream.DefaultBackfillTable},
+						},
+						Subcommands: []*cli.Command{
+							{
+								Name:  "request",
+								Usage: "Request a backfill of a table or a primary key range",
+								Flags: []cli.Flag{
+									&cli.StringFlag{Name: "slot", Usage: "replication slot of the stream", Required: true},
+									&cli.StringFlag{Name: "table", Usage: "table to backfill", Required: true},
+									&cli.StringSliceFlag{Name: "from", Usage: "first primary key (inclusive), one value per key column"},
+									&cli.StringSliceFlag{Name: "to", Usage: "last primary key (inclusive), one value per key column"},
+								},
+								Action: func(c *cli.Context) error {
+									return withDB(c, func(db *sqlx.DB) error {
+										id, err := pglogicalstream.RequestBackfill(c.Context, db.DB, c.String("backfill-table"), pglogicalstream.BackfillRequest{
+											SlotName: c.String("slot"),
+											Table:    c.String("table"),
+											FromKey:  c.StringSlice("from"),
+											ToKey:    c.StringSlice("to"),
+										})
+										if err != nil {
+											return err
+										}
+										fmt.Printf("Requested backfill %d of table %s\n", id, c.String("table"))
+										return nil
+									})
+								},
+							},
+							{
+								Name:  "list",
+								Usage: "List backfill requests of a slot",
+								Flags: []cli.Flag{
+									&cli.StringFlag{Name: "slot", Usage: "replication slot of the stream", Required: true},
+								},
+								Action: func(c *cli.Context) error {
+									return withDB(c, func(db *sqlx.DB) error {
+										requests, err := pglogicalstream.ListBackfills(c.Context, db.DB, c.String("backfill-table"), c.String("slot"))
+										if err != nil {
+											return err
+										}
+
+										w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+										fmt.Fprintln(w, "ID\tTABLE\tFROM\tTO\tSTATUS\tROWS\tLAST KEY\tUPDATED AT\tERROR")
+										for _, req := range requests {
+											fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", req.ID, req.Table, strings.Join(req.FromKey, ","),
+												strings.Join(req.ToKey, ","), req.Status, req.Rows, strings.Join(req.LastKey, ","),
+												req.UpdatedAt.Format(time.RFC3339), req.Error)
+										}
+										return w.Flush()
+									})
+								},
+							},
+						},
+					},
 				},
 			},
 		},
@@ -105,3 +373,72 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+func getMigrationDir(c *cli.Context) string {
+	if service := c.String("service"); service != "" {
+		return filepath.Join("cmd", "services", service, "migrations")
+	}
+	return c.String("dir")
+}
+
+func withMigrator(c *cli.Context, fn func(m *dbtool.Migrator) error) error {
+	return withDB(c, func(db *sqlx.DB) error {
+		return fn(dbtool.NewMigrator(db, getMigrationDir(c), c.String("service"), c.Bool("dry-run")))
+	})
+}
+
+func withDB(c *cli.Context, fn func(db *sqlx.DB) error) error {
+	dsn := c.String("dsn")
+	if dsn == "" {
+		return fmt.Errorf("dsn is required, set --dsn or DATABASE_URL")
+	}
+
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	return fn(db)
+}
+
+// openCheckpointStore opens the --checkpoint store of the drop command, it is nil without --checkpoint
+func openCheckpointStore(c *cli.Context, db *sqlx.DB) (pglogicalstream.CheckpointStore, func(), error) {
+	switch c.String("checkpoint") {
+	case "":
+		return nil, func() {}, nil
+	case pglogicalstream.CheckpointPostgres:
+		if dsn := c.String("checkpoint-dsn"); dsn != "" {
+			checkpointDB, err := sqlx.Connect("postgres", dsn)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to connect to checkpoint database: %w", err)
+			}
+			store, err := pglogicalstream.NewPostgresCheckpointStore(checkpointDB.DB, c.String("checkpoint-table"))
+			if err != nil {
+				checkpointDB.Close()
+				return nil, nil, err
+			}
+			return store, func() { checkpointDB.Close() }, nil
+		}
+		store, err := pglogicalstream.NewPostgresCheckpointStore(db.DB, c.String("checkpoint-table"))
+		return store, func() {}, err
+	case pglogicalstream.CheckpointRedis:
+		client := redis.NewClient(&redis.Options{Addr: c.String("redis-addr")})
+		return pglogicalstream.NewRedisCheckpointStore(client, c.String("checkpoint-table")), func() { client.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported checkpoint store %s", c.String("checkpoint"))
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
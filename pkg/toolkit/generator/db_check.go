@@ -0,0 +1,93 @@
+package generator
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/nhdms/base-go/pkg/toolkit/templates"
+)
+
+const dbCheckDir = ".gcli_db_check"
+
+// CheckDBSchema builds a temporary program importing the tables packages of the services,
+// so every table registered by dbtool.RegisterTable is checked against the database
+func CheckDBSchema(services []string, dsn, schema string) error {
+	if len(dsn) == 0 {
+		return fmt.Errorf("dsn is required, set --dsn or DATABASE_URL")
+	}
+
+	modulePath, err := getModulePath()
+	if err != nil {
+		return err
+	}
+
+	var dirs []string
+	if len(services) == 0 {
+		dirs, _ = filepath.Glob(filepath.Join("cmd", "services", "*", "tables"))
+	}
+	for _, service := range services {
+		dirs = append(dirs, filepath.Join("cmd", "services", service, "tables"))
+	}
+
+	var imports []string
+	for _, dir := range dirs {
+		if _, err = os.Stat(dir); err != nil {
+			return fmt.Errorf("tables package %s not found", dir)
+		}
+		imports = append(imports, modulePath+"/"+filepath.ToSlash(dir))
+	}
+
+	if len(imports) == 0 {
+		return fmt.Errorf("no tables package found in cmd/services")
+	}
+
+	t, err := template.New("db_check").Parse(templates.DBCheckTemplate)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(dbCheckDir, 0755); err != nil {
+		return err
+	}
+	defer os.RemoveAll(dbCheckDir)
+
+	f, err := os.Create(filepath.Join(dbCheckDir, "main.go"))
+	if err != nil {
+		return err
+	}
+
+	err = t.Execute(f, map[string]interface{}{"Imports": imports})
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("go", "run", "./"+dbCheckDir)
+	cmd.Env = append(os.Environ(), "DATABASE_URL="+dsn, "DATABASE_SCHEMA="+schema, "IGNORE_LOAD_CONFIG=true")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// getModulePath reads the module path from go.mod of the working directory
+func getModulePath() (string, error) {
+	f, err := os.Open("go.mod")
+	if err != nil {
+		return "", fmt.Errorf("go.mod not found, run gcli from the root directory: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "module ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "module ")), nil
+		}
+	}
+	return "", fmt.Errorf("module path not found in go.mod")
+}
@@ -0,0 +1,186 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/nhdms/base-go/pkg/toolkit/templates"
+)
+
+// PermissionModuleType is the type of the module constants of the permissions package
+const PermissionModuleType = "Permission"
+
+var permissionGroupComment = regexp.MustCompile(`^(\w+) Permissions`)
+
+type permissionModule struct {
+	Name string
+	Key  string
+}
+
+type permissionBit struct {
+	Module string
+	Name   string
+	Key    string
+}
+
+type permissionData struct {
+	Source      string
+	Package     string
+	Modules     []permissionModule
+	Permissions []permissionBit
+}
+
+// GeneratePermissions writes registry.gen.go in the permissions package dir: the stable key of each module constant
+// (typed Permission) and of each bit constant, e.g. OrderBulkUpdateStatus of the "// Order Permissions" block is
+// order.bulk_update_status. Keys are stored in roles, renaming a constant changes its key.
+func GeneratePermissions(dir string) error {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go") && !strings.HasSuffix(info.Name(), ".gen.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	if len(pkgs) != 1 {
+		return fmt.Errorf("expected one package in %s, found %d", dir, len(pkgs))
+	}
+
+	data := permissionData{Source: filepath.ToSlash(dir)}
+	var files []*ast.File
+	for name, pkg := range pkgs {
+		data.Package = name
+		for _, file := range pkg.Files {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return fset.File(files[i].Pos()).Name() < fset.File(files[j].Pos()).Name() })
+
+	// modules first, bit blocks refer to them by name
+	modules := make(map[string]bool)
+	for _, file := range files {
+		for _, spec := range constSpecs(file) {
+			if !spec.typed {
+				continue
+			}
+			for _, name := range spec.spec.Names {
+				modules[name.Name] = true
+				data.Modules = append(data.Modules, permissionModule{Name: name.Name, Key: toPermissionKey(name.Name)})
+			}
+		}
+	}
+	if len(data.Modules) == 0 {
+		return fmt.Errorf("no %s constant found in %s", PermissionModuleType, dir)
+	}
+
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST || gen.Doc == nil {
+				continue
+			}
+
+			module := ""
+			for _, line := range strings.Split(gen.Doc.Text(), "\n") {
+				if m := permissionGroupComment.FindStringSubmatch(line); m != nil && modules[m[1]] {
+					module = m[1]
+				}
+			}
+			if len(module) == 0 {
+				continue
+			}
+
+			for _, spec := range gen.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					if !strings.HasPrefix(name.Name, module) || name.Name == module {
+						return fmt.Errorf("permission %s of the %s block must start with the module name", name.Name, module)
+					}
+					data.Permissions = append(data.Permissions, permissionBit{
+						Module: module,
+						Name:   name.Name,
+						Key:    toPermissionKey(module) + "." + toPermissionKey(strings.TrimPrefix(name.Name, module)),
+					})
+				}
+			}
+		}
+	}
+
+	t, err := template.New("permissions").Parse(templates.PermissionRegistryTemplate)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, data); err != nil {
+		return err
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("format generated code: %w", err)
+	}
+
+	outputPath := filepath.Join(dir, "registry.gen.go")
+	if err = os.WriteFile(outputPath, src, 0644); err != nil {
+		return err
+	}
+
+	logger.DefaultLogger.Infof("%d modules and %d permissions generated at %s", len(data.Modules), len(data.Permissions), outputPath)
+	return nil
+}
+
+type constSpec struct {
+	spec  *ast.ValueSpec
+	typed bool
+}
+
+// constSpecs returns the const specs of file, a spec without type and value repeats the type of the previous one (iota)
+func constSpecs(file *ast.File) []*constSpec {
+	var specs []*constSpec
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+
+		typed := false
+		for _, s := range gen.Specs {
+			spec := s.(*ast.ValueSpec)
+			if spec.Type != nil || len(spec.Values) > 0 {
+				ident, ok := spec.Type.(*ast.Ident)
+				typed = ok && ident.Name == PermissionModuleType
+			}
+			specs = append(specs, &constSpec{spec: spec, typed: typed})
+		}
+	}
+	return specs
+}
+
+// toPermissionKey converts a Go name to snake case, acronyms are kept together: BulkSyncOrderToFFM is bulk_sync_order_to_ffm
+func toPermissionKey(s string) string {
+	runes := []rune(s)
+	var buf strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && !unicode.IsUpper(runes[i-1])
+			acronymEnd := i > 0 && unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || acronymEnd {
+				buf.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
@@ -0,0 +1,357 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/jmoiron/sqlx"
+	"github.com/nhdms/base-go/pkg/logger"
+	"github.com/nhdms/base-go/pkg/toolkit/templates"
+	"github.com/nhdms/base-go/pkg/utils"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	_ "github.com/lib/pq"
+)
+
+// TableOptions configures `gcli gen table`
+type TableOptions struct {
+	ProtoPath     string // proto/models/user.proto
+	Message       string // proto message, default is the first message of the file
+	TableName     string // default is snake case plural of the message
+	FuncName      string // default is Get<Message>Table
+	OutDir        string // package directory of the generated file, e.g. cmd/services/user-service/tables
+	Alias         string
+	IgnoreColumns []string
+	DSN           string // optional postgres dsn, fields missing in the live table are added to IgnoreColumns
+	Schema        string
+}
+
+type tableField struct {
+	Name      string
+	Column    string
+	ScanExpr  string
+	ValueExpr string
+}
+
+type tableData struct {
+	Source        string
+	Package       string
+	Message       string
+	FuncName      string
+	TableName     string
+	Alias         string
+	AIColumns     []string
+	IgnoreColumns []string
+	ColumnMapper  []tableField
+	Fields        []tableField
+}
+
+var (
+	timestampName = (&timestamppb.Timestamp{}).ProtoReflect().Descriptor().FullName()
+	structName    = (&structpb.Struct{}).ProtoReflect().Descriptor().FullName()
+)
+
+func GenerateTable(opts TableOptions) error {
+	if len(opts.OutDir) == 0 {
+		return fmt.Errorf("output directory is required")
+	}
+
+	fd, err := compileProto(opts.ProtoPath)
+	if err != nil {
+		return err
+	}
+
+	if fd.Messages().Len() == 0 {
+		return fmt.Errorf("no message found in %s", opts.ProtoPath)
+	}
+
+	md := fd.Messages().Get(0)
+	if len(opts.Message) > 0 {
+		md = fd.Messages().ByName(protoreflect.Name(opts.Message))
+		if md == nil {
+			return fmt.Errorf("message %s not found in %s", opts.Message, opts.ProtoPath)
+		}
+	}
+
+	data := tableData{
+		Source:        opts.ProtoPath,
+		Package:       filepath.Base(opts.OutDir),
+		Message:       string(md.Name()),
+		FuncName:      opts.FuncName,
+		TableName:     opts.TableName,
+		Alias:         opts.Alias,
+		IgnoreColumns: append([]string{}, opts.IgnoreColumns...),
+	}
+	if len(data.TableName) == 0 {
+		data.TableName = toSnakeCase(data.Message) + "s"
+	}
+	if len(data.FuncName) == 0 {
+		data.FuncName = fmt.Sprintf("Get%sTable", data.Message)
+	}
+	if len(data.Alias) == 0 {
+		data.Alias = data.TableName[:1]
+	}
+
+	var liveColumns map[string]bool
+	if len(opts.DSN) > 0 {
+		liveColumns, err = loadLiveColumns(opts.DSN, opts.Schema, data.TableName)
+		if err != nil {
+			return err
+		}
+	}
+
+	// fields are named as protoc-gen-go does: Go name in camel case, json tag (the column) is the proto name
+	fields := md.Fields()
+	goNames := goFieldNames(md)
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		f := tableField{
+			Name:   goNames[field.Name()],
+			Column: string(field.Name()),
+		}
+		f.ScanExpr, f.ValueExpr = getCodecExpr(field, f.Name)
+		if len(f.ScanExpr) == 0 {
+			logger.DefaultLogger.Warnf("Skip field %s.%s: unsupported type %s", data.Message, f.Name, fieldTypeName(field))
+			continue
+		}
+
+		if liveColumns != nil && !liveColumns[f.Column] && !utils.StringSliceContains(data.IgnoreColumns, f.Column) {
+			logger.DefaultLogger.Warnf("Column %s not found in table %s, it is added to IgnoreColumns", f.Column, data.TableName)
+			data.IgnoreColumns = append(data.IgnoreColumns, f.Column)
+		}
+
+		if f.Column == "id" {
+			data.AIColumns = append(data.AIColumns, f.Column)
+		}
+
+		// postgres folds unquoted identifiers to lower case
+		if strings.ToLower(f.Column) != f.Column {
+			data.ColumnMapper = append(data.ColumnMapper, f)
+		}
+
+		data.Fields = append(data.Fields, f)
+	}
+
+	t, err := template.New("table").Parse(templates.TableCodecTemplate)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, data); err != nil {
+		return err
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("format generated code: %w", err)
+	}
+
+	if err = os.MkdirAll(opts.OutDir, 0755); err != nil {
+		return err
+	}
+
+	outputPath := filepath.Join(opts.OutDir, toSnakeCase(data.Message)+"_table.gen.go")
+	if err = os.WriteFile(outputPath, src, 0644); err != nil {
+		return err
+	}
+
+	logger.DefaultLogger.Infof("Table %s generated successfully at %s", data.TableName, outputPath)
+	return nil
+}
+
+// compileProto parses the proto file, its imports are resolved from its directory (proto/models) and the
+// well-known types, as the models are compiled with proto_path=proto/models
+func compileProto(path string) (protoreflect.FileDescriptor, error) {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			ImportPaths: []string{filepath.Dir(path)},
+		}),
+	}
+
+	files, err := compiler.Compile(context.Background(), filepath.Base(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile %s (imports are resolved from %s): %w", path, filepath.Dir(path), err)
+	}
+	return files[0], nil
+}
+
+// getCodecExpr returns the scan target and value expressions of the Go field name of a proto field,
+// empty if the type is not supported
+func getCodecExpr(field protoreflect.FieldDescriptor, name string) (string, string) {
+	ref := "m." + name
+	// oneof and optional fields are wrappers or pointers in Go
+	if field.ContainingOneof() != nil || field.IsMap() {
+		return "", ""
+	}
+
+	if field.IsList() {
+		switch {
+		case field.Kind() == protoreflect.StringKind:
+			return fmt.Sprintf("dbtool.ScanStringArray(&%s)", ref), fmt.Sprintf("dbtool.StringArrayValue(%s)", ref)
+		case isIntKind(field.Kind()):
+			return fmt.Sprintf("dbtool.ScanIntArray(&%s)", ref), fmt.Sprintf("dbtool.IntArrayValue(%s)", ref)
+		}
+		return "", ""
+	}
+
+	switch kind := field.Kind(); {
+	case kind == protoreflect.MessageKind && field.Message().FullName() == timestampName:
+		return fmt.Sprintf("dbtool.ScanTimestamp(&%s)", ref), fmt.Sprintf("dbtool.TimestampValue(%s)", ref)
+	case kind == protoreflect.MessageKind && field.Message().FullName() == structName:
+		return fmt.Sprintf("dbtool.ScanStruct(&%s)", ref), fmt.Sprintf("dbtool.StructValue(%s)", ref)
+	case isIntKind(kind):
+		return fmt.Sprintf("dbtool.ScanInt(&%s)", ref), fmt.Sprintf("int64(%s)", ref)
+	case kind == protoreflect.FloatKind || kind == protoreflect.DoubleKind:
+		return fmt.Sprintf("dbtool.ScanFloat(&%s)", ref), fmt.Sprintf("float64(%s)", ref)
+	case kind == protoreflect.StringKind:
+		return fmt.Sprintf("dbtool.ScanString(&%s)", ref), fmt.Sprintf("string(%s)", ref)
+	case kind == protoreflect.BoolKind:
+		return fmt.Sprintf("dbtool.ScanBool(&%s)", ref), ref
+	case kind == protoreflect.BytesKind:
+		return fmt.Sprintf("dbtool.ScanBytes(&%s)", ref), ref
+	}
+
+	return "", ""
+}
+
+func isIntKind(kind protoreflect.Kind) bool {
+	switch kind {
+	case protoreflect.EnumKind, protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return true
+	}
+	return false
+}
+
+func fieldTypeName(field protoreflect.FieldDescriptor) string {
+	name := field.Kind().String()
+	if field.Message() != nil {
+		name = string(field.Message().FullName())
+	}
+	switch {
+	case field.IsMap():
+		return "map"
+	case field.IsList():
+		return "repeated " + name
+	case field.ContainingOneof() != nil:
+		return "oneof/optional " + name
+	}
+	return name
+}
+
+// goFieldNames returns the Go field names of the fields of md, names conflicting with the methods of the
+// message get a trailing '_' (e.g. Reset_) the same as protoc-gen-go
+func goFieldNames(md protoreflect.MessageDescriptor) map[protoreflect.Name]string {
+	used := map[string]bool{
+		"Reset": true, "String": true, "ProtoMessage": true, "Marshal": true, "Unmarshal": true,
+		"ExtensionRangeArray": true, "ExtensionMap": true, "Descriptor": true,
+	}
+	unique := func(name string, hasGetter bool) string {
+		for used[name] || (hasGetter && used["Get"+name]) {
+			name += "_"
+		}
+		used[name] = true
+		used["Get"+name] = hasGetter
+		return name
+	}
+
+	fields := md.Fields()
+	names := make(map[protoreflect.Name]string, fields.Len())
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		names[field.Name()] = unique(goCamelCase(string(field.Name())), true)
+		if oneof := field.ContainingOneof(); oneof != nil && oneof.Fields().Get(0) == field {
+			unique(goCamelCase(string(oneof.Name())), false)
+		}
+	}
+	return names
+}
+
+// goCamelCase is the Go field name of a proto field name, the same as protoc-gen-go
+func goCamelCase(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '.' && i+1 < len(s) && isASCIILower(s[i+1]):
+			// skip over '.' in ".{{lowercase}}"
+		case c == '.':
+			b = append(b, '_')
+		case c == '_' && (i == 0 || s[i-1] == '.'):
+			// an initial '_' starts with a capital letter
+			b = append(b, 'X')
+		case c == '_' && i+1 < len(s) && isASCIILower(s[i+1]):
+			// skip over '_' in "_{{lowercase}}"
+		case c >= '0' && c <= '9':
+			b = append(b, c)
+		default:
+			// a word starts upper case, the lower case sequence that follows is kept
+			if isASCIILower(c) {
+				c -= 'a' - 'A'
+			}
+			b = append(b, c)
+			for ; i+1 < len(s) && isASCIILower(s[i+1]); i++ {
+				b = append(b, s[i+1])
+			}
+		}
+	}
+	return string(b)
+}
+
+func isASCIILower(c byte) bool {
+	return 'a' <= c && c <= 'z'
+}
+
+func loadLiveColumns(dsn, schema, table string) (map[string]bool, error) {
+	if len(schema) == 0 {
+		schema = "public"
+	}
+
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var columns []string
+	err = db.Select(&columns, "SELECT column_name FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2", schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s.%s not found", schema, table)
+	}
+
+	resp := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		resp[c] = true
+	}
+	return resp, nil
+}
+
+func toSnakeCase(s string) string {
+	var buf strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				buf.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
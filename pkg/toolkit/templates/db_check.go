@@ -0,0 +1,43 @@
+package templates
+
+const DBCheckTemplate = `// Code generated by gcli db check. DO NOT EDIT.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nhdms/base-go/pkg/dbtool"
+{{- range .Imports}}
+	_ "{{.}}"
+{{- end}}
+)
+
+func main() {
+	db, err := sqlx.Connect("postgres", os.Getenv("DATABASE_URL"))
+	if err != nil {
+		fmt.Println("failed to connect to database:", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	issues, err := dbtool.CheckSchema(context.Background(), db, os.Getenv("DATABASE_SCHEMA"))
+	if err != nil {
+		fmt.Println("failed to check schema:", err)
+		os.Exit(1)
+	}
+
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+
+	if len(issues) > 0 {
+		fmt.Printf("found %d schema issues\n", len(issues))
+		os.Exit(1)
+	}
+	fmt.Println("schema is up to date")
+}
+`
@@ -0,0 +1,19 @@
+package templates
+
+const PermissionRegistryTemplate = `// Code generated by gcli gen permissions. DO NOT EDIT.
+// source: {{.Source}}
+
+package {{.Package}}
+
+var moduleKeys = map[Permission]string{
+{{- range .Modules}}
+	{{.Name}}: "{{.Key}}",
+{{- end}}
+}
+
+var definitions = []Definition{
+{{- range .Permissions}}
+	{Module: {{.Module}}, Bit: {{.Name}}, Key: "{{.Key}}"},
+{{- end}}
+}
+`
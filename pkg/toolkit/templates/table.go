@@ -0,0 +1,80 @@
+package templates
+
+const TableCodecTemplate = `// Code generated by gcli gen table. DO NOT EDIT.
+// source: {{.Source}}
+
+package {{.Package}}
+
+import (
+	"github.com/nhdms/base-go/pkg/dbtool"
+	"github.com/nhdms/base-go/proto/exmsg/models"
+)
+
+const (
+{{- range .Fields}}
+	{{$.Message}}Column{{.Name}} = "{{.Column}}"
+{{- end}}
+)
+
+func init() {
+	dbtool.RegisterModelCodec(&models.{{.Message}}{}, &dbtool.ModelCodec{
+		Fields: []dbtool.ModelField{
+{{- range .Fields}}
+			{Column: {{$.Message}}Column{{.Name}}, Name: "{{.Name}}"},
+{{- end}}
+		},
+		ScanTargets: scan{{.Message}}Columns,
+		Value:       get{{.Message}}Value,
+	})
+	dbtool.RegisterTable({{.FuncName}}(), &models.{{.Message}}{})
+}
+
+func {{.FuncName}}() *dbtool.Table {
+	return &dbtool.Table{
+		Name:      "{{.TableName}}",
+		AIColumns: []string{ {{- range $i, $c := .AIColumns}}{{if $i}}, {{end}}"{{$c}}"{{end -}} },
+		ColumnMapper: map[string]string{
+{{- range .ColumnMapper}}
+			{{$.Message}}Column{{.Name}}: ` + "`" + `"{{.Column}}"` + "`" + `,
+{{- end}}
+		},
+		IgnoreColumns: []string{ {{- range $i, $c := .IgnoreColumns}}{{if $i}}, {{end}}"{{$c}}"{{end -}} },
+		DefaultAlias:  "{{.Alias}}",
+	}
+}
+
+func scan{{.Message}}Columns(dest interface{}, columns []string) []interface{} {
+	m, ok := dest.(*models.{{.Message}})
+	if !ok {
+		return nil
+	}
+
+	targets := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch column {
+{{- range .Fields}}
+		case {{$.Message}}Column{{.Name}}:
+			targets[i] = {{.ScanExpr}}
+{{- end}}
+		default:
+			targets[i] = new(interface{})
+		}
+	}
+	return targets
+}
+
+func get{{.Message}}Value(item interface{}, field string) (interface{}, bool) {
+	m, ok := item.(*models.{{.Message}})
+	if !ok {
+		return nil, false
+	}
+
+	switch field {
+{{- range .Fields}}
+	case "{{.Name}}":
+		return {{.ValueExpr}}, true
+{{- end}}
+	}
+	return nil, false
+}
+`
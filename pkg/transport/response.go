@@ -3,6 +3,7 @@ package transhttp
 import (
 	"errors"
 	"github.com/goccy/go-json"
+	"github.com/nhdms/base-go/pkg/common"
 	"github.com/nhdms/base-go/pkg/utils/codec"
 	"github.com/spf13/viper"
 	"net/http"
@@ -156,6 +157,14 @@ func RespondFile(w http.ResponseWriter, r *http.Request, fileName string) {
 }
 
 func GetStatusCode(err error) int {
+	if common.IsConflictError(err) {
+		return http.StatusConflict
+	}
+
+	if common.IsInvalidFieldError(err) {
+		return http.StatusBadRequest
+	}
+
 	switch err.Error() {
 	case ErrorNotFound.Error():
 		return http.StatusNotFound
@@ -4,10 +4,12 @@ import (
 	"context"
 	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
+	"github.com/nhdms/base-go/pkg/common"
 	"github.com/nhdms/base-go/pkg/config"
 	middleware "github.com/nhdms/base-go/pkg/middlewares"
 	"go-micro.dev/v5/web"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -16,23 +18,46 @@ const (
 	NoTimeout      = -1
 )
 
+// token types accepted by a route in AuthInfo.TokenType, e.g. TokenTypeJWT + "," + TokenTypeAPIKey
+const (
+	TokenTypeJWT     = "jwt"     // Authorization: Bearer <token> of a user
+	TokenTypeAPIKey  = "api_key" // X-API-Key: <key> or Authorization: ApiKey <key>
+	TokenTypeService = "service" // Authorization: Service <token> of an internal caller
+)
+
 // Route -- Defines a single route, e.g. a human readable name, HTTP method,
 // pattern the function that will execute when the route is called.
 type Route struct {
-	Name        string              `json:"-"`
+	Name        string              `json:"n,omitempty"`
 	Method      string              `json:"m"`
 	Pattern     string              `json:"p"`
 	Handler     http.Handler        `json:"-"`
 	Middlewares []alice.Constructor `json:"-"`
 	AuthInfo    AuthInfo            `json:"a"`
 	Timeout     int64               `json:"t"`
+	Audit       bool                `json:"au,omitempty"` // the gateway emits an audit event for each request, see pkg/audit
 }
 
 // AuthInfo -- authentication and authorization for route
 type AuthInfo struct {
 	Enable             bool            `json:"e"`
-	TokenType          string          `json:"t"`
-	RequirePermissions map[int64]int64 `json:"r"`
+	TokenType          string          `json:"t"` // comma separated token types, TokenTypeJWT when empty
+	RequirePermissions map[int64]int64 `json:"r"` // module => bits, every module is required
+	// Permissions is declared by permission keys with AND/OR, e.g. permissions.Require(permissions.Order, permissions.OrderBulkUpdateStatus)
+	Permissions *common.PermissionRequirement `json:"p,omitempty"`
+}
+
+// TokenTypes returns the token types accepted by the route, in the order they are tried
+func (a AuthInfo) TokenTypes() []string {
+	if len(a.TokenType) == 0 {
+		return []string{TokenTypeJWT}
+	}
+
+	tokenTypes := strings.Split(a.TokenType, ",")
+	for i := range tokenTypes {
+		tokenTypes[i] = strings.TrimSpace(tokenTypes[i])
+	}
+	return tokenTypes
 }
 
 // Routes -- Defines the type Routes which is just an array (slice) of Route structs.
@@ -44,7 +69,7 @@ func InitRoutes(svc web.Service, routes Routes, path string) {
 	for _, route := range routes {
 		//fullPath := basePath + route.Pattern
 		// Start with the handler
-		chain := alice.New(middleware.NewRequestID("api"))
+		chain := alice.New(middleware.NewRequestID("api"), middleware.ForwardPrincipal)
 		// Add timeout middleware if set
 		if route.Timeout != NoTimeout {
 			timeout := globalTimeout
@@ -1,9 +1,12 @@
 package pg_converter
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"github.com/lib/pq"
 	"github.com/spf13/cast"
+	"strings"
 	"time"
 )
 
@@ -50,6 +53,10 @@ func (c *PostgreSQLTypeConverter) ConvertValue(pgType string, value interface{})
 	if len(pgType) > 2 && pgType[0] == '_' {
 		return c.convertArray(pgType[1:], value)
 	}
+	// wal2json names arrays like text[]
+	if len(pgType) > 2 && strings.HasSuffix(pgType, "[]") {
+		return c.convertArray(pgType[:len(pgType)-2], value)
+	}
 
 	switch pgType {
 	case "smallint", "int2":
@@ -76,6 +83,8 @@ func (c *PostgreSQLTypeConverter) ConvertValue(pgType string, value interface{})
 		return c.toJSON(value)
 	case "inet", "cidr", "uuid":
 		return cast.ToStringE(value)
+	case "bytea":
+		return value, nil
 	default:
 		if value == nil {
 			return nil, nil
@@ -157,7 +166,20 @@ func (c *PostgreSQLTypeConverter) convertArray(elemType string, v interface{}) (
 	switch val := v.(type) {
 	case string:
 		var result []interface{}
-		if err := json.Unmarshal([]byte(val), &result); err != nil {
+		if strings.HasPrefix(val, "{") {
+			// postgres array literal, e.g. {1,2,NULL} read from a query instead of the WAL
+			elems := []sql.NullString{}
+			if err := (pq.GenericArray{A: &elems}).Scan([]byte(val)); err != nil {
+				return nil, fmt.Errorf("parsing array: %v", err)
+			}
+
+			result = make([]interface{}, len(elems))
+			for i, elem := range elems {
+				if elem.Valid {
+					result[i] = elem.String
+				}
+			}
+		} else if err := json.Unmarshal([]byte(val), &result); err != nil {
 			return nil, fmt.Errorf("parsing array: %v", err)
 		}
 
@@ -169,6 +191,17 @@ func (c *PostgreSQLTypeConverter) convertArray(elemType string, v interface{}) (
 			result[i] = converted
 		}
 		return result, nil
+	case []interface{}:
+		// already decoded, e.g. from a JSON event
+		result := make([]interface{}, len(val))
+		for i, elem := range val {
+			converted, err := c.ConvertValue(elemType, elem)
+			if err != nil {
+				return nil, fmt.Errorf("converting array element %d: %v", i, err)
+			}
+			result[i] = converted
+		}
+		return result, nil
 	case nil:
 		return nil, nil
 	default:
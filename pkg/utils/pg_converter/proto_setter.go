@@ -57,11 +57,24 @@ func (p *ProtoFieldSetter) setField(field reflect.Value, fieldType reflect.Type,
 		field.SetFloat(cast.ToFloat64(value))
 
 	case reflect.String:
-		field.SetString(cast.ToString(value))
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			// json columns mapped to a string field keep their JSON text
+			b, err := json.Marshal(value)
+			if err != nil {
+				return fmt.Errorf("marshal JSON value: %v", err)
+			}
+			field.SetString(string(b))
+		default:
+			field.SetString(cast.ToString(value))
+		}
 
 	case reflect.Bool:
 		field.SetBool(cast.ToBool(value))
 
+	case reflect.Slice:
+		return p.setSliceField(field, fieldType, value)
+
 	case reflect.Ptr:
 		if field.IsNil() {
 			field.Set(reflect.New(field.Type().Elem()))
@@ -75,6 +88,38 @@ func (p *ProtoFieldSetter) setField(field reflect.Value, fieldType reflect.Type,
 	return nil
 }
 
+// setSliceField sets repeated fields from converted arrays or JSON arrays and bytes fields from bytea
+func (p *ProtoFieldSetter) setSliceField(field reflect.Value, fieldType reflect.Type, value interface{}) error {
+	if fieldType.Elem().Kind() == reflect.Uint8 {
+		switch v := value.(type) {
+		case []byte:
+			field.SetBytes(v)
+		case string:
+			field.SetBytes([]byte(v))
+		default:
+			return fmt.Errorf("unexpected type for bytes: %T", value)
+		}
+		return nil
+	}
+
+	elems, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("unexpected type for repeated field: %T", value)
+	}
+
+	slice := reflect.MakeSlice(fieldType, len(elems), len(elems))
+	for i, elem := range elems {
+		if elem == nil {
+			continue
+		}
+		if err := p.setField(slice.Index(i), fieldType.Elem(), elem); err != nil {
+			return fmt.Errorf("element %d: %v", i, err)
+		}
+	}
+	field.Set(slice)
+	return nil
+}
+
 func (p *ProtoFieldSetter) setTimestampField(field reflect.Value, pgType string, value interface{}) error {
 	var t time.Time
 	var err error
@@ -6,15 +6,43 @@ import (
 )
 
 const (
-	TokenHeader  = "Authorization"
-	BearerScheme = "Bearer "
+	TokenHeader   = "Authorization"
+	BearerScheme  = "Bearer "
+	APIKeyScheme  = "ApiKey "
+	ServiceScheme = "Service "
+	APIKeyHeader  = "X-API-Key"
 )
 
+// ExtractTokenFromRequest returns the user token of the Authorization header ("Bearer <token>" or the bare token)
 func ExtractTokenFromRequest(r *http.Request) string {
 	authHeader := r.Header.Get(TokenHeader)
+	if strings.HasPrefix(authHeader, APIKeyScheme) || strings.HasPrefix(authHeader, ServiceScheme) {
+		return ""
+	}
 	authHeader = strings.TrimPrefix(authHeader, BearerScheme)
 	if len(authHeader) > 0 {
 		return authHeader
 	}
 	return ""
 }
+
+// ExtractAPIKeyFromRequest returns the api key of the X-API-Key header or of "Authorization: ApiKey <key>"
+func ExtractAPIKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); len(key) > 0 {
+		return key
+	}
+	return extractScheme(r, APIKeyScheme)
+}
+
+// ExtractServiceTokenFromRequest returns the service token of "Authorization: Service <token>"
+func ExtractServiceTokenFromRequest(r *http.Request) string {
+	return extractScheme(r, ServiceScheme)
+}
+
+func extractScheme(r *http.Request, scheme string) string {
+	authHeader := r.Header.Get(TokenHeader)
+	if !strings.HasPrefix(authHeader, scheme) {
+		return ""
+	}
+	return strings.TrimPrefix(authHeader, scheme)
+}
@@ -30,6 +30,8 @@ var _ server.Option
 
 type UserService interface {
 	GetUserByID(ctx context.Context, in *UserRequest, opts ...client.CallOption) (*UserResponse, error)
+	GetUserClaims(ctx context.Context, in *UserRequest, opts ...client.CallOption) (*UserClaimsResponse, error)
+	GetAPIKey(ctx context.Context, in *APIKeyRequest, opts ...client.CallOption) (*APIKeyResponse, error)
 }
 
 type userService struct {
@@ -54,15 +56,39 @@ func (c *userService) GetUserByID(ctx context.Context, in *UserRequest, opts ...
 	return out, nil
 }
 
+func (c *userService) GetUserClaims(ctx context.Context, in *UserRequest, opts ...client.CallOption) (*UserClaimsResponse, error) {
+	req := c.c.NewRequest(c.name, "UserService.GetUserClaims", in)
+	out := new(UserClaimsResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) GetAPIKey(ctx context.Context, in *APIKeyRequest, opts ...client.CallOption) (*APIKeyResponse, error) {
+	req := c.c.NewRequest(c.name, "UserService.GetAPIKey", in)
+	out := new(APIKeyResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for UserService service
 
 type UserServiceHandler interface {
 	GetUserByID(context.Context, *UserRequest, *UserResponse) error
+	GetUserClaims(context.Context, *UserRequest, *UserClaimsResponse) error
+	GetAPIKey(context.Context, *APIKeyRequest, *APIKeyResponse) error
 }
 
 func RegisterUserServiceHandler(s server.Server, hdlr UserServiceHandler, opts ...server.HandlerOption) error {
 	type userService interface {
 		GetUserByID(ctx context.Context, in *UserRequest, out *UserResponse) error
+		GetUserClaims(ctx context.Context, in *UserRequest, out *UserClaimsResponse) error
+		GetAPIKey(ctx context.Context, in *APIKeyRequest, out *APIKeyResponse) error
 	}
 	type UserService struct {
 		userService
@@ -78,3 +104,11 @@ type userServiceHandler struct {
 func (h *userServiceHandler) GetUserByID(ctx context.Context, in *UserRequest, out *UserResponse) error {
 	return h.UserServiceHandler.GetUserByID(ctx, in, out)
 }
+
+func (h *userServiceHandler) GetUserClaims(ctx context.Context, in *UserRequest, out *UserClaimsResponse) error {
+	return h.UserServiceHandler.GetUserClaims(ctx, in, out)
+}
+
+func (h *userServiceHandler) GetAPIKey(ctx context.Context, in *APIKeyRequest, out *APIKeyResponse) error {
+	return h.UserServiceHandler.GetAPIKey(ctx, in, out)
+}